@@ -15,14 +15,14 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/analytics/products/{id}": {
+        "/analytics/categories": {
             "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Retrieve analytics data for a specific product (likes, dislikes, purchases).",
+                "description": "Retrieve the likes, dislikes, purchases and users of every category. Interactions are counted in the category a product had when they happened; active users are those who interacted with the category within the configured window.",
                 "consumes": [
                     "application/json"
                 ],
@@ -32,12 +32,59 @@ const docTemplate = `{
                 "tags": [
                     "analytics :8083"
                 ],
-                "summary": "Get product analytics",
+                "summary": "List category analytics",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Product ID",
-                        "name": "id",
+                        "type": "string",
+                        "description": "Bearer {token}",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.CategoryAnalytics"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/analytics/categories/{category}/funnel": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Retrieve the views, likes and purchases of all products of a category with the view → like → purchase conversion rates. The funnel sums the lifetime counters of the products currently in the category, so after a product changes category all of its history moves with it, while the category analytics keep counting each event under the category the product had at the time.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "analytics :8083"
+                ],
+                "summary": "Get category conversion funnel",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Product category",
+                        "name": "category",
                         "in": "path",
                         "required": true
                     },
@@ -53,8 +100,7 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/models.Funnel"
                         }
                     },
                     "400": {
@@ -64,8 +110,8 @@ const docTemplate = `{
                             "additionalProperties": true
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "500": {
+                        "description": "Internal Server Error",
                         "schema": {
                             "type": "object",
                             "additionalProperties": true
@@ -74,14 +120,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/analytics/users/{id}": {
+        "/analytics/categories/{name}": {
             "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Retrieve analytics data for a specific user (total likes, dislikes, purchases).",
+                "description": "Retrieve the likes, dislikes, purchases and users of one category.",
                 "consumes": [
                     "application/json"
                 ],
@@ -91,12 +137,12 @@ const docTemplate = `{
                 "tags": [
                     "analytics :8083"
                 ],
-                "summary": "Get user analytics",
+                "summary": "Get category analytics",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "User ID",
-                        "name": "id",
+                        "type": "string",
+                        "description": "Category",
+                        "name": "name",
                         "in": "path",
                         "required": true
                     },
@@ -112,8 +158,7 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/models.CategoryAnalytics"
                         }
                     },
                     "400": {
@@ -133,9 +178,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/auth/login": {
-            "post": {
-                "description": "Authenticate user and return JWT token.",
+        "/analytics/cohorts": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Group users by registration week (Monday to Sunday, UTC) and return, for each cohort, how many of its users interacted (viewed, liked, disliked or bought a product) in each week since registration, starting with the registration week, and their share. A cohort's rows end with the current week.",
                 "consumes": [
                     "application/json"
                 ],
@@ -143,25 +193,41 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "auth :8084"
+                    "analytics :8083"
                 ],
-                "summary": "User login",
+                "summary": "Get cohort retention",
                 "parameters": [
                     {
-                        "description": "User credentials",
-                        "name": "credentials",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.LoginRequest"
-                        }
+                        "type": "string",
+                        "description": "First registration week, RFC 3339 or YYYY-MM-DD (default: 12 weeks before to)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "End of the registration weeks (exclusive, rounded up to a week), RFC 3339 or YYYY-MM-DD (default: now)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Weeks of retention per cohort (1-104, default 12)",
+                        "name": "weeks",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bearer {token}",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.LoginResponse"
+                            "$ref": "#/definitions/models.CohortMatrix"
                         }
                     },
                     "400": {
@@ -171,13 +237,6 @@ const docTemplate = `{
                             "additionalProperties": true
                         }
                     },
-                    "401": {
-                        "description": "Unauthorized",
-                        "schema": {
-                            "type": "object",
-                            "additionalProperties": true
-                        }
-                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -188,35 +247,106 @@ const docTemplate = `{
                 }
             }
         },
-        "/auth/register": {
-            "post": {
-                "description": "Create a new user with name, email, and password.",
-                "consumes": [
-                    "application/json"
+        "/analytics/export/{dataset}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
                 ],
+                "description": "Stream a dataset as CSV, NDJSON or Parquet: product_analytics, user_analytics, product_hourly, product_daily, user_hourly, user_daily or category_revenue_daily. Rows are read in key order in pages, so the export is never held in memory. With a limit only one chunk of rows is exported and the X-Next-Cursor header, when present, is the cursor of the next chunk. From and to bound the bucket of time-bucketed datasets and the last update of the others. The response is sent before the rows are read, so a complete export ends with the X-Export-Rows trailer and a failed one with X-Export-Error; clients must check them.",
                 "produces": [
-                    "application/json"
+                    "text/csv",
+                    "application/x-ndjson",
+                    "application/vnd.apache.parquet"
                 ],
                 "tags": [
-                    "auth :8084"
+                    "analytics :8083"
                 ],
-                "summary": "Register a new user",
+                "summary": "Export analytics",
                 "parameters": [
                     {
-                        "description": "User to register",
-                        "name": "user",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.RegisterRequest"
-                        }
+                        "type": "string",
+                        "description": "Dataset to export",
+                        "name": "dataset",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "csv, ndjson or parquet (default csv)",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Product category",
+                        "name": "category",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Product ID",
+                        "name": "product_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "user_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Start of the range, RFC 3339 or YYYY-MM-DD",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "End of the range (exclusive), RFC 3339 or YYYY-MM-DD",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cursor returned in X-Next-Cursor by the previous chunk",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of rows of the chunk (default: all remaining rows)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bearer {token}",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.User"
+                            "type": "file"
+                        },
+                        "headers": {
+                            "X-Export-Error": {
+                                "type": "string",
+                                "description": "Trailer: why the export stopped part way"
+                            },
+                            "X-Export-Rows": {
+                                "type": "integer",
+                                "description": "Trailer: number of rows exported, sent only when the export is complete"
+                            },
+                            "X-Next-Cursor": {
+                                "type": "string",
+                                "description": "Cursor of the next chunk"
+                            }
                         }
                     },
                     "400": {
@@ -236,14 +366,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/products": {
+        "/analytics/leaderboards/products/{board}": {
             "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Retrieve a list of all products with pagination, including likes, dislikes, and purchase count.",
+                "description": "Retrieve the top products by likes, dislikes, purchases or rating. The rating board orders products by the lower bound of the Wilson score interval of their like/dislike ratio.",
                 "consumes": [
                     "application/json"
                 ],
@@ -251,20 +381,33 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "products :8081"
+                    "analytics :8083"
                 ],
-                "summary": "Get all products",
+                "summary": "Get product leaderboard",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Page number",
-                        "name": "page",
+                        "type": "string",
+                        "description": "likes, dislikes, purchases or rating",
+                        "name": "board",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Product category",
+                        "name": "category",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "1d, 7d, 30d or all (default 7d)",
+                        "name": "window",
                         "in": "query"
                     },
                     {
                         "type": "integer",
-                        "description": "Number of products per page",
-                        "name": "pageSize",
+                        "description": "Maximum number of products (1-100, default 10)",
+                        "name": "limit",
                         "in": "query"
                     },
                     {
@@ -281,7 +424,7 @@ const docTemplate = `{
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/models.Product"
+                                "$ref": "#/definitions/models.LeaderboardEntry"
                             }
                         }
                     },
@@ -300,14 +443,16 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "post": {
+            }
+        },
+        "/analytics/leaderboards/users": {
+            "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Create a new product with name, description, price, and category.",
+                "description": "Retrieve the users with the most likes, dislikes and purchases, optionally counting only products of one category.",
                 "consumes": [
                     "application/json"
                 ],
@@ -315,18 +460,27 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "products :8081"
+                    "analytics :8083"
                 ],
-                "summary": "Create a new product",
+                "summary": "Get most active users",
                 "parameters": [
                     {
-                        "description": "Product to create",
-                        "name": "product",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.Product"
-                        }
+                        "type": "string",
+                        "description": "Product category",
+                        "name": "category",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "1d, 7d, 30d or all (default 7d)",
+                        "name": "window",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of users (1-100, default 10)",
+                        "name": "limit",
+                        "in": "query"
                     },
                     {
                         "type": "string",
@@ -337,10 +491,13 @@ const docTemplate = `{
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.Product"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.LeaderboardEntry"
+                            }
                         }
                     },
                     "400": {
@@ -360,14 +517,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/products/{id}": {
+        "/analytics/products/{id}": {
             "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Retrieve product information by product ID, including likes, dislikes, and purchase count.",
+                "description": "Retrieve analytics data for a specific product (likes, dislikes, purchases, revenue). distinct_users holds approximate (HyperLogLog) numbers of distinct users who liked or bought the product today and in the last 7 days (UTC); it is omitted when Redis is unavailable.",
                 "consumes": [
                     "application/json"
                 ],
@@ -375,9 +532,9 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "products :8081"
+                    "analytics :8083"
                 ],
-                "summary": "Get product by ID",
+                "summary": "Get product analytics",
                 "parameters": [
                     {
                         "type": "integer",
@@ -398,7 +555,8 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.Product"
+                            "type": "object",
+                            "additionalProperties": true
                         }
                     },
                     "400": {
@@ -416,14 +574,16 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "put": {
+            }
+        },
+        "/analytics/products/{id}/funnel": {
+            "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Update product information by product ID (including category).",
+                "description": "Retrieve the views, likes and purchases of a product with the view → like → purchase conversion rates.",
                 "consumes": [
                     "application/json"
                 ],
@@ -431,9 +591,9 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "products :8081"
+                    "analytics :8083"
                 ],
-                "summary": "Update product information",
+                "summary": "Get product conversion funnel",
                 "parameters": [
                     {
                         "type": "integer",
@@ -442,15 +602,6 @@ const docTemplate = `{
                         "in": "path",
                         "required": true
                     },
-                    {
-                        "description": "Updated product information",
-                        "name": "product",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.Product"
-                        }
-                    },
                     {
                         "type": "string",
                         "description": "Bearer {token}",
@@ -463,7 +614,7 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.Product"
+                            "$ref": "#/definitions/models.Funnel"
                         }
                     },
                     "400": {
@@ -481,14 +632,16 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "delete": {
+            }
+        },
+        "/analytics/products/{id}/timeseries": {
+            "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Delete a product by its ID.",
+                "description": "Retrieve likes, dislikes and purchases of a product per hour or day. Hourly buckets are kept for a limited period, after which they are only available as daily buckets.",
                 "consumes": [
                     "application/json"
                 ],
@@ -496,9 +649,9 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "products :8081"
+                    "analytics :8083"
                 ],
-                "summary": "Delete a product",
+                "summary": "Get product analytics time series",
                 "parameters": [
                     {
                         "type": "integer",
@@ -507,6 +660,24 @@ const docTemplate = `{
                         "in": "path",
                         "required": true
                     },
+                    {
+                        "type": "string",
+                        "description": "Start of the range, RFC 3339 or YYYY-MM-DD (default: 30 days or 48 hours before to)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "End of the range (exclusive), RFC 3339 or YYYY-MM-DD (default: now)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "hour or day (default: day)",
+                        "name": "granularity",
+                        "in": "query"
+                    },
                     {
                         "type": "string",
                         "description": "Bearer {token}",
@@ -519,8 +690,7 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/models.TimeSeries"
                         }
                     },
                     "400": {
@@ -540,14 +710,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/recommendations/{user_id}/latest": {
-            "get": {
+        "/analytics/reconcile": {
+            "post": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Retrieve the most up-to-date recommended products for this user.",
+                "description": "Compare the lifetime counters of products and users with the likes, dislikes and purchases tables, which also reflect removed likes and dislikes, and report the discrepancies. With repair=true the counters that differ are overwritten. Products and users with activity in the last analytics.reconcile.settle are skipped. Repair assumes that older events have been applied, so it must only run while the analytics consumers and the outbox relay are caught up. Requires the X-Admin-Token header to match analytics.admin_token.",
                 "consumes": [
                     "application/json"
                 ],
@@ -555,16 +725,15 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "recommendations :8082"
+                    "analytics :8083"
                 ],
-                "summary": "Get the latest recommendation",
+                "summary": "Reconcile analytics counters",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "User ID",
-                        "name": "user_id",
-                        "in": "path",
-                        "required": true
+                        "type": "boolean",
+                        "description": "Overwrite the counters that differ (default false)",
+                        "name": "repair",
+                        "in": "query"
                     },
                     {
                         "type": "string",
@@ -572,14 +741,20 @@ const docTemplate = `{
                         "name": "Authorization",
                         "in": "header",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Admin token (analytics.admin_token)",
+                        "name": "X-Admin-Token",
+                        "in": "header",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/models.ReconcileReport"
                         }
                     },
                     "400": {
@@ -589,6 +764,13 @@ const docTemplate = `{
                             "additionalProperties": true
                         }
                     },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -599,14 +781,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/users": {
+        "/analytics/revenue": {
             "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Retrieve a list of all users with pagination.",
+                "description": "Retrieve the purchases and revenue per day of one category or of all products, with the totals and the average order value of the range. Revenue uses the price of a product at the time it was bought.",
                 "consumes": [
                     "application/json"
                 ],
@@ -614,20 +796,26 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "users :8080"
+                    "analytics :8083"
                 ],
-                "summary": "Get all users",
+                "summary": "Get daily revenue",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Page number",
-                        "name": "page",
+                        "type": "string",
+                        "description": "Product category (default: all)",
+                        "name": "category",
                         "in": "query"
                     },
                     {
-                        "type": "integer",
-                        "description": "Number of users per page",
-                        "name": "pageSize",
+                        "type": "string",
+                        "description": "Start of the range, RFC 3339 or YYYY-MM-DD (default: 30 days before to)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "End of the range (exclusive), RFC 3339 or YYYY-MM-DD (default: now)",
+                        "name": "to",
                         "in": "query"
                     },
                     {
@@ -642,10 +830,7 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/models.User"
-                            }
+                            "$ref": "#/definitions/models.RevenueSeries"
                         }
                     },
                     "400": {
@@ -665,14 +850,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/users/{id}": {
-            "put": {
+        "/analytics/trending": {
+            "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Update user information by user ID.",
+                "description": "Retrieve products whose like and purchase velocity in the recent window is highest compared with their baseline rate.",
                 "consumes": [
                     "application/json"
                 ],
@@ -680,25 +865,21 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "users :8080"
+                    "analytics :8083"
                 ],
-                "summary": "Update user profile",
+                "summary": "Get trending products",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "User ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "type": "string",
+                        "description": "Product category",
+                        "name": "category",
+                        "in": "query"
                     },
                     {
-                        "description": "Updated user information",
-                        "name": "user",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.User"
-                        }
+                        "type": "integer",
+                        "description": "Maximum number of products (1-100, default 20)",
+                        "name": "limit",
+                        "in": "query"
                     },
                     {
                         "type": "string",
@@ -712,7 +893,10 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.User"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.TrendingProduct"
+                            }
                         }
                     },
                     "400": {
@@ -732,14 +916,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/users/{id}/actions": {
+        "/analytics/users/{id}": {
             "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Retrieve all likes and dislikes of a user, with optional filtering by product ID.",
+                "description": "Retrieve analytics data for a specific user (total likes, dislikes, purchases, lifetime value and average order value).",
                 "consumes": [
                     "application/json"
                 ],
@@ -747,9 +931,9 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "users :8080"
+                    "analytics :8083"
                 ],
-                "summary": "Get user actions",
+                "summary": "Get user analytics",
                 "parameters": [
                     {
                         "type": "integer",
@@ -758,12 +942,6 @@ const docTemplate = `{
                         "in": "path",
                         "required": true
                     },
-                    {
-                        "type": "integer",
-                        "description": "Product ID to filter",
-                        "name": "product_id",
-                        "in": "query"
-                    },
                     {
                         "type": "string",
                         "description": "Bearer {token}",
@@ -787,8 +965,8 @@ const docTemplate = `{
                             "additionalProperties": true
                         }
                     },
-                    "500": {
-                        "description": "Internal Server Error",
+                    "404": {
+                        "description": "Not Found",
                         "schema": {
                             "type": "object",
                             "additionalProperties": true
@@ -797,14 +975,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/users/{id}/dislike": {
-            "post": {
+        "/analytics/users/{id}/timeseries": {
+            "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "User dislikes a product.",
+                "description": "Retrieve likes, dislikes and purchases of a user per hour or day. Hourly buckets are kept for a limited period, after which they are only available as daily buckets.",
                 "consumes": [
                     "application/json"
                 ],
@@ -812,9 +990,9 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "users :8080"
+                    "analytics :8083"
                 ],
-                "summary": "Dislike a product",
+                "summary": "Get user analytics time series",
                 "parameters": [
                     {
                         "type": "integer",
@@ -824,11 +1002,22 @@ const docTemplate = `{
                         "required": true
                     },
                     {
-                        "type": "integer",
-                        "description": "Product ID",
-                        "name": "product_id",
-                        "in": "query",
-                        "required": true
+                        "type": "string",
+                        "description": "Start of the range, RFC 3339 or YYYY-MM-DD (default: 30 days or 48 hours before to)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "End of the range (exclusive), RFC 3339 or YYYY-MM-DD (default: now)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "hour or day (default: day)",
+                        "name": "granularity",
+                        "in": "query"
                     },
                     {
                         "type": "string",
@@ -842,8 +1031,7 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/models.TimeSeries"
                         }
                     },
                     "400": {
@@ -863,14 +1051,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/users/{id}/like": {
+        "/auth/login": {
             "post": {
-                "security": [
-                    {
-                        "BearerAuth": []
-                    }
-                ],
-                "description": "User likes a product.",
+                "description": "Authenticate user and return JWT token.",
                 "consumes": [
                     "application/json"
                 ],
@@ -878,38 +1061,25 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "users :8080"
+                    "auth :8084"
                 ],
-                "summary": "Like a product",
+                "summary": "User login",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "User ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "type": "integer",
-                        "description": "Product ID",
-                        "name": "product_id",
-                        "in": "query",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "Bearer {token}",
-                        "name": "Authorization",
-                        "in": "header",
-                        "required": true
+                        "description": "User credentials",
+                        "name": "credentials",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.LoginRequest"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/models.LoginResponse"
                         }
                     },
                     "400": {
@@ -919,6 +1089,13 @@ const docTemplate = `{
                             "additionalProperties": true
                         }
                     },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -929,14 +1106,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/users/{id}/purchase": {
+        "/auth/register": {
             "post": {
-                "security": [
-                    {
-                        "BearerAuth": []
-                    }
-                ],
-                "description": "User purchases a product.",
+                "description": "Create a new user with name, email, and password.",
                 "consumes": [
                     "application/json"
                 ],
@@ -944,38 +1116,25 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "users :8080"
+                    "auth :8084"
                 ],
-                "summary": "Purchase a product",
+                "summary": "Register a new user",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "User ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "type": "integer",
-                        "description": "Product ID",
-                        "name": "product_id",
-                        "in": "query",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "Bearer {token}",
-                        "name": "Authorization",
-                        "in": "header",
-                        "required": true
+                        "description": "User to register",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.RegisterRequest"
+                        }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
+                    "201": {
+                        "description": "Created",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/models.User"
                         }
                     },
                     "400": {
@@ -995,32 +1154,1098 @@ const docTemplate = `{
                 }
             }
         },
-        "/users/{id}/purchases": {
+        "/events/schemas": {
             "get": {
                 "security": [
                     {
                         "BearerAuth": []
                     }
                 ],
-                "description": "Retrieve a list of purchases made by the user with pagination.",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Retrieve the JSON Schemas of the payloads of all events published to Kafka, keyed by event type.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "users :8080"
+                    "events :8083"
                 ],
-                "summary": "Get user purchases",
+                "summary": "List event schemas",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "User ID",
-                        "name": "id",
-                        "in": "path",
+                        "type": "string",
+                        "description": "Bearer {token}",
+                        "name": "Authorization",
+                        "in": "header",
                         "required": true
-                    },
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/events/schemas/{type}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Retrieve the JSON Schema of the payload of one event type.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "events :8083"
+                ],
+                "summary": "Get event schema",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Event type, e.g. user_liked",
+                        "name": "type",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bearer {token}",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/products": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Retrieve a list of all products with pagination, including likes, dislikes, and purchase count.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "products :8081"
+                ],
+                "summary": "Get all products",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Page number",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of products per page",
+                        "name": "pageSize",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bearer {token}",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Product"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Create a new product with name, description, price, and category.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "products :8081"
+                ],
+                "summary": "Create a new product",
+                "parameters": [
+                    {
+                        "description": "Product to create",
+                        "name": "product",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Product"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bearer {token}",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.Product"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/products/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Retrieve product information by product ID, including likes, dislikes, and purchase count.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "products :8081"
+                ],
+                "summary": "Get product by ID",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Product ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bearer {token}",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Product"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Update product information by product ID (including category).",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "products :8081"
+                ],
+                "summary": "Update product information",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Product ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Updated product information",
+                        "name": "product",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Product"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bearer {token}",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Product"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Delete a product by its ID.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "products :8081"
+                ],
+                "summary": "Delete a product",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Product ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bearer {token}",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/recommendations/batch": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Retrieve recommended products for a list of users in one call. Cached recommendations are reused, the rest are computed with bounded concurrency. Send \"Accept: application/x-ndjson\" or \"stream=true\" to receive one JSON object per line as soon as it is ready.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json",
+                    "application/x-ndjson"
+                ],
+                "tags": [
+                    "recommendations :8082"
+                ],
+                "summary": "Get recommendations for many users",
+                "parameters": [
+                    {
+                        "description": "User IDs",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.BatchRecommendationRequest"
+                        }
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Stream the response as NDJSON",
+                        "name": "stream",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bearer {token}",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/recommendations/stream": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Subscribe to the authenticated user's recommendations over Server-Sent Events. The current list is sent first, then a \"recommendations\" event is pushed every time the list is regenerated.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "recommendations :8082"
+                ],
+                "summary": "Stream recommendation updates",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer {token}",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "event stream",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/recommendations/{user_id}/latest": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Retrieve the most up-to-date recommended products for this user.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "recommendations :8082"
+                ],
+                "summary": "Get the latest recommendation",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bearer {token}",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/recommendations/{user_id}/price-band": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Retrieve the price band learned from the user's purchase history (quartiles of purchased product prices). The band is used for ranking only when it is reliable, i.e. backed by enough purchases.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "recommendations :8082"
+                ],
+                "summary": "Get the learned price band of a user",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bearer {token}",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.PriceBand"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/users": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Retrieve a list of all users with pagination.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users :8080"
+                ],
+                "summary": "Get all users",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Page number",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of users per page",
+                        "name": "pageSize",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bearer {token}",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.User"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Retrieve user information by user ID.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users :8080"
+                ],
+                "summary": "Get user by ID",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bearer {token}",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.User"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Update user information by user ID.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users :8080"
+                ],
+                "summary": "Update user profile",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Updated user information",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.User"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bearer {token}",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.User"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/actions": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Retrieve all likes and dislikes of a user, with optional filtering by product ID.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users :8080"
+                ],
+                "summary": "Get user actions",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Product ID to filter",
+                        "name": "product_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bearer {token}",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/dislike": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "User dislikes a product.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users :8080"
+                ],
+                "summary": "Dislike a product",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Product ID",
+                        "name": "product_id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bearer {token}",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/like": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "User likes a product.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users :8080"
+                ],
+                "summary": "Like a product",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Product ID",
+                        "name": "product_id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bearer {token}",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/purchase": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "User purchases a product.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users :8080"
+                ],
+                "summary": "Purchase a product",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Product ID",
+                        "name": "product_id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bearer {token}",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/purchases": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Retrieve a list of purchases made by the user with pagination.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users :8080"
+                ],
+                "summary": "Get user purchases",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
                     {
                         "type": "integer",
                         "description": "Page number",
@@ -1040,65 +2265,294 @@ const docTemplate = `{
                         "in": "header",
                         "required": true
                     }
-                ],
-                "responses": {
-                    "200": {
-                        "description": "OK",
-                        "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/models.Purchase"
-                            }
-                        }
-                    },
-                    "400": {
-                        "description": "Bad Request",
-                        "schema": {
-                            "type": "object",
-                            "additionalProperties": true
-                        }
-                    },
-                    "500": {
-                        "description": "Internal Server Error",
-                        "schema": {
-                            "type": "object",
-                            "additionalProperties": true
-                        }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Purchase"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/view": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Record that the user viewed a product. Views are counted by the analytics service for the conversion funnel.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users :8080"
+                ],
+                "summary": "View a product",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Product ID",
+                        "name": "product_id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bearer {token}",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "internal_product_models.Dislike": {
+            "type": "object",
+            "properties": {
+                "disliked_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "product_id": {
+                    "type": "integer"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "internal_product_models.Like": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "integer"
+                },
+                "liked_at": {
+                    "type": "string"
+                },
+                "product_id": {
+                    "type": "integer"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.BatchRecommendationRequest": {
+            "type": "object",
+            "properties": {
+                "user_ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                }
+            }
+        },
+        "models.CategoryAnalytics": {
+            "type": "object",
+            "properties": {
+                "active_users": {
+                    "type": "integer"
+                },
+                "category": {
+                    "type": "string"
+                },
+                "dislikes": {
+                    "type": "integer"
+                },
+                "likes": {
+                    "type": "integer"
+                },
+                "purchases": {
+                    "type": "integer"
+                },
+                "total_users": {
+                    "type": "integer"
+                },
+                "updated_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.Cohort": {
+            "type": "object",
+            "properties": {
+                "retained": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "retention": {
+                    "type": "array",
+                    "items": {
+                        "type": "number"
                     }
+                },
+                "users": {
+                    "type": "integer"
+                },
+                "week": {
+                    "type": "string"
                 }
             }
-        }
-    },
-    "definitions": {
-        "internal_product_models.Dislike": {
+        },
+        "models.CohortMatrix": {
             "type": "object",
             "properties": {
-                "disliked_at": {
+                "cohorts": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Cohort"
+                    }
+                },
+                "from": {
+                    "type": "string"
+                },
+                "to": {
                     "type": "string"
                 },
+                "weeks": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.CounterDiscrepancy": {
+            "type": "object",
+            "properties": {
+                "actual": {
+                    "$ref": "#/definitions/models.CounterValues"
+                },
+                "expected": {
+                    "$ref": "#/definitions/models.CounterValues"
+                },
                 "id": {
                     "type": "integer"
+                }
+            }
+        },
+        "models.CounterValues": {
+            "type": "object",
+            "properties": {
+                "dislikes": {
+                    "type": "integer"
+                },
+                "likes": {
+                    "type": "integer"
+                },
+                "purchases": {
+                    "type": "integer"
+                },
+                "revenue": {
+                    "type": "number"
+                }
+            }
+        },
+        "models.Funnel": {
+            "type": "object",
+            "properties": {
+                "category": {
+                    "type": "string"
+                },
+                "like_to_purchase": {
+                    "type": "number"
+                },
+                "likes": {
+                    "type": "integer"
                 },
                 "product_id": {
                     "type": "integer"
                 },
-                "user_id": {
+                "purchases": {
+                    "type": "integer"
+                },
+                "view_to_like": {
+                    "type": "number"
+                },
+                "view_to_purchase": {
+                    "type": "number"
+                },
+                "views": {
                     "type": "integer"
                 }
             }
         },
-        "internal_product_models.Like": {
+        "models.LeaderboardEntry": {
             "type": "object",
             "properties": {
-                "id": {
+                "dislikes": {
                     "type": "integer"
                 },
-                "liked_at": {
-                    "type": "string"
+                "likes": {
+                    "type": "integer"
                 },
                 "product_id": {
                     "type": "integer"
                 },
+                "rank": {
+                    "type": "integer"
+                },
+                "score": {
+                    "type": "number"
+                },
                 "user_id": {
                     "type": "integer"
                 }
@@ -1126,6 +2580,35 @@ const docTemplate = `{
                 }
             }
         },
+        "models.PriceBand": {
+            "type": "object",
+            "properties": {
+                "lower": {
+                    "type": "number"
+                },
+                "max": {
+                    "type": "number"
+                },
+                "median": {
+                    "type": "number"
+                },
+                "min": {
+                    "type": "number"
+                },
+                "purchases": {
+                    "type": "integer"
+                },
+                "reliable": {
+                    "type": "boolean"
+                },
+                "upper": {
+                    "type": "number"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
         "models.Product": {
             "type": "object",
             "properties": {
@@ -1173,6 +2656,9 @@ const docTemplate = `{
                 "id": {
                     "type": "integer"
                 },
+                "price": {
+                    "type": "number"
+                },
                 "product_id": {
                     "type": "integer"
                 },
@@ -1184,6 +2670,44 @@ const docTemplate = `{
                 }
             }
         },
+        "models.ReconcileReport": {
+            "type": "object",
+            "properties": {
+                "finished_at": {
+                    "type": "string"
+                },
+                "product_discrepancies": {
+                    "type": "integer"
+                },
+                "products": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.CounterDiscrepancy"
+                    }
+                },
+                "products_repaired": {
+                    "type": "integer"
+                },
+                "repair": {
+                    "type": "boolean"
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "user_discrepancies": {
+                    "type": "integer"
+                },
+                "users": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.CounterDiscrepancy"
+                    }
+                },
+                "users_repaired": {
+                    "type": "integer"
+                }
+            }
+        },
         "models.RegisterRequest": {
             "type": "object",
             "properties": {
@@ -1201,6 +2725,121 @@ const docTemplate = `{
                 }
             }
         },
+        "models.RevenuePoint": {
+            "type": "object",
+            "properties": {
+                "bucket_start": {
+                    "type": "string"
+                },
+                "purchases": {
+                    "type": "integer"
+                },
+                "revenue": {
+                    "type": "number"
+                }
+            }
+        },
+        "models.RevenueSeries": {
+            "type": "object",
+            "properties": {
+                "average_order_value": {
+                    "type": "number"
+                },
+                "category": {
+                    "type": "string"
+                },
+                "from": {
+                    "type": "string"
+                },
+                "points": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.RevenuePoint"
+                    }
+                },
+                "purchases": {
+                    "type": "integer"
+                },
+                "revenue": {
+                    "type": "number"
+                },
+                "to": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.TimeSeries": {
+            "type": "object",
+            "properties": {
+                "from": {
+                    "type": "string"
+                },
+                "granularity": {
+                    "type": "string"
+                },
+                "points": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.TimeSeriesPoint"
+                    }
+                },
+                "product_id": {
+                    "type": "integer"
+                },
+                "to": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.TimeSeriesPoint": {
+            "type": "object",
+            "properties": {
+                "bucket_start": {
+                    "type": "string"
+                },
+                "dislikes": {
+                    "type": "integer"
+                },
+                "likes": {
+                    "type": "integer"
+                },
+                "purchases": {
+                    "type": "integer"
+                },
+                "revenue": {
+                    "type": "number"
+                }
+            }
+        },
+        "models.TrendingProduct": {
+            "type": "object",
+            "properties": {
+                "baseline_likes": {
+                    "type": "integer"
+                },
+                "baseline_purchases": {
+                    "type": "integer"
+                },
+                "category": {
+                    "type": "string"
+                },
+                "product_id": {
+                    "type": "integer"
+                },
+                "velocity": {
+                    "type": "number"
+                },
+                "window_likes": {
+                    "type": "integer"
+                },
+                "window_purchases": {
+                    "type": "integer"
+                }
+            }
+        },
         "models.User": {
             "type": "object",
             "properties": {
@@ -5,12 +5,16 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	log "recommendation-system/pkg/logger"
 
 	_ "recommendation-system/cmd/analytics-service/docs"
 
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/viper"
 	fiberSwagger "github.com/swaggo/fiber-swagger"
 
@@ -18,7 +22,10 @@ import (
 	"recommendation-system/internal/analytics/repository"
 	"recommendation-system/internal/analytics/service"
 	"recommendation-system/pkg/db"
+	"recommendation-system/pkg/events"
 	"recommendation-system/pkg/kafka"
+	"recommendation-system/pkg/redis"
+	"recommendation-system/pkg/trending"
 
 	kafkaGo "github.com/segmentio/kafka-go"
 )
@@ -65,32 +72,133 @@ func main() {
 
 	kafkaBrokers := viper.GetStringSlice("kafka.brokers")
 	kafkaClient := kafka.NewKafkaClient(kafkaBrokers)
+	kafkaClient.Retry = kafka.RetryConfig{
+		MaxAttempts:    viper.GetInt("kafka.retry.max_attempts"),
+		InitialBackoff: viper.GetDuration("kafka.retry.initial_backoff"),
+		MaxBackoff:     viper.GetDuration("kafka.retry.max_backoff"),
+	}
+	kafkaClient.Logger = logger
 	defer kafkaClient.Close()
 	logger.Println("Kafka client initialized")
 
+	consumedTopics := []string{"user_updates", "product_updates"}
+	for _, topic := range consumedTopics {
+		for _, failed := range []string{kafka.DeadLetterTopic(topic), kafka.QuarantineTopic(topic)} {
+			if err := kafkaClient.CreateTopic(failed, viper.GetInt("kafka.partitions"), viper.GetInt("kafka.replication_factor")); err != nil {
+				logger.Printf("Topic '%s' may already exist or failed to create: %v", failed, err)
+			}
+		}
+	}
+
+	redisHosts := viper.GetStringSlice("redis.host")
+	if len(redisHosts) == 0 {
+		logger.Fatalf("No Redis hosts specified in the configuration")
+	}
+	redisClient := redis.NewRedisClient(redisHosts[0], "", 0)
+	logger.Println("Redis client initialized")
+
 	analyticsRepo := repository.NewAnalyticsRepository(database, logger)
-	analyticsService := service.NewAnalyticsService(analyticsRepo, kafkaClient, logger)
+	groupID := "analytics_service_group"
+	processedEvents := events.NewProcessedStore(database, groupID)
+	analyticsService := service.NewAnalyticsService(analyticsRepo, processedEvents, kafkaClient, redisClient, service.Config{
+		Trending: service.TrendingConfig{
+			Config: trending.Config{
+				Window:         viper.GetDuration("trending.window"),
+				Baseline:       viper.GetDuration("trending.baseline"),
+				PurchaseWeight: viper.GetFloat64("trending.purchase_weight"),
+				MinEvents:      viper.GetInt("trending.min_events"),
+			},
+			Bucket:    viper.GetDuration("trending.bucket"),
+			Retention: viper.GetDuration("trending.retention"),
+		},
+		ProcessedRetention: viper.GetDuration("events.processed_retention"),
+		TimeSeries: service.TimeSeriesConfig{
+			HourlyRetention: viper.GetDuration("analytics.timeseries.hourly_retention"),
+			DailyRetention:  viper.GetDuration("analytics.timeseries.daily_retention"),
+		},
+		CategoryActiveWindow: viper.GetDuration("analytics.categories.active_window"),
+		ExportPageSize:       viper.GetInt("analytics.export.page_size"),
+		Reconcile: service.ReconcileConfig{
+			Settle:      viper.GetDuration("analytics.reconcile.settle"),
+			ReportLimit: viper.GetInt("analytics.reconcile.report_limit"),
+		},
+	}, logger)
+
+	// Handlers get their own context so that shutdown stops fetching without
+	// aborting the transactions of messages already being handled.
+	consumerCtx, stopConsumers := context.WithCancel(context.Background())
+	defer stopConsumers()
+	consumersDone := make(chan struct{})
 
 	go func() {
+		defer close(consumersDone)
 		ctx := context.Background()
-		topics := []string{"user_updates", "product_updates"}
-		groupID := "analytics_service_group"
-		if err := kafkaClient.SubscribeToTopicsFallback(ctx, topics, groupID, func(m kafkaGo.Message) error {
+		handler := func(m kafkaGo.Message) error {
 			return analyticsService.ProcessKafkaMessage(ctx, m)
-		}); err != nil {
+		}
+
+		var err error
+		if viper.GetBool("analytics.batch.enabled") {
+			batchConfig := kafka.BatchConfig{
+				Size:   viper.GetInt("analytics.batch.size"),
+				Linger: viper.GetDuration("analytics.batch.linger"),
+			}
+			err = kafkaClient.SubscribeToTopicsBatch(consumerCtx, consumedTopics, groupID, batchConfig, func(messages []kafkaGo.Message) error {
+				return analyticsService.ProcessKafkaBatch(ctx, messages)
+			}, handler)
+		} else {
+			err = kafkaClient.SubscribeToTopicsFallback(consumerCtx, consumedTopics, groupID, handler)
+		}
+		if err != nil {
 			logger.Printf("Error subscribing to Kafka topics: %v", err)
 		}
 	}()
 	logger.Println("Kafka topics subscription started")
 
+	// Periodic jobs are stopped and waited for on shutdown like the consumers.
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	var jobs sync.WaitGroup
+
+	runPeriodically(jobsCtx, &jobs, viper.GetDuration("trending.prune_interval"), func(ctx context.Context) {
+		if err := analyticsService.PruneTrendingActivity(ctx); err != nil {
+			logger.Printf("Failed to prune trending activity: %v", err)
+		}
+	})
+
+	runPeriodically(jobsCtx, &jobs, viper.GetDuration("events.processed_prune_interval"), func(ctx context.Context) {
+		if err := analyticsService.PruneProcessedEvents(ctx); err != nil {
+			logger.Printf("Failed to prune processed events: %v", err)
+		}
+	})
+
+	runPeriodically(jobsCtx, &jobs, viper.GetDuration("analytics.timeseries.rollup_interval"), func(ctx context.Context) {
+		if err := analyticsService.RollupTimeSeries(ctx); err != nil {
+			logger.Printf("Failed to roll up analytics time series: %v", err)
+		}
+	})
+
+	repair := viper.GetBool("analytics.reconcile.repair")
+	runPeriodically(jobsCtx, &jobs, viper.GetDuration("analytics.reconcile.interval"), func(ctx context.Context) {
+		if _, err := analyticsService.Reconcile(ctx, repair); err != nil {
+			logger.Printf("Failed to reconcile analytics counters: %v", err)
+		}
+	})
+
 	jwtSecret := viper.GetString("jwt.secret")
 	if jwtSecret == "" {
 		logger.Fatal("JWT secret is not set")
 	}
 	logger.Println("JWT secret loaded")
 
-	app := http.NewFiberApp(analyticsService, jwtSecret, logger)
+	adminToken := viper.GetString("analytics.admin_token")
+	if adminToken == "" {
+		logger.Println("Admin token is not set, admin routes are disabled")
+	}
+
+	app := http.NewFiberApp(analyticsService, jwtSecret, adminToken, logger)
 	app.Get("/swagger/*", fiberSwagger.WrapHandler)
+	app.Get("/metrics", adaptor.HTTPHandler(promhttp.Handler()))
 
 	go func() {
 		if err := app.Listen(viper.GetString("server.analytics_service_address")); err != nil {
@@ -103,12 +211,52 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
+	logger.Println("Stopping Kafka consumers and periodic jobs...")
+	stopConsumers()
+	stopJobs()
+	stopped := make(chan struct{})
+	go func() {
+		<-consumersDone
+		jobs.Wait()
+		close(stopped)
+	}()
+	shutdownTimeout := viper.GetDuration("kafka.shutdown_timeout")
+	select {
+	case <-stopped:
+		logger.Println("Kafka consumers and periodic jobs stopped, offsets of handled messages committed")
+	case <-time.After(shutdownTimeout):
+		logger.Printf("Kafka consumers did not stop within %s, uncommitted messages will be redelivered", shutdownTimeout)
+	}
+
 	if err := app.Shutdown(); err != nil {
 		logger.Fatalf("Failed to shutdown analytics server: %v", err)
 	}
 	logger.Println("Analytics Service stopped gracefully")
 }
 
+// runPeriodically calls job every interval until ctx is done. A job that is
+// running when ctx is done gets the cancelled ctx and is waited for through wg.
+// A non-positive interval disables the job.
+func runPeriodically(ctx context.Context, wg *sync.WaitGroup, interval time.Duration, job func(ctx context.Context)) {
+	if interval <= 0 {
+		return
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				job(ctx)
+			}
+		}
+	}()
+}
+
 func initConfig() error {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
@@ -117,7 +265,36 @@ func initConfig() error {
 	viper.SetDefault("server.analytics_service_address", ":8083")
 	viper.SetDefault("db.sslmode", "disable")
 	viper.SetDefault("kafka.brokers", []string{"kafka:9092"})
+	viper.SetDefault("redis.host", "redis:6379")
+	viper.SetDefault("kafka.partitions", 3)
+	viper.SetDefault("kafka.replication_factor", 1)
 	viper.SetDefault("jwt.secret", "your_secret_key")
+	viper.SetDefault("kafka.retry.max_attempts", 5)
+	viper.SetDefault("kafka.retry.initial_backoff", 200*time.Millisecond)
+	viper.SetDefault("kafka.retry.max_backoff", 10*time.Second)
+	viper.SetDefault("kafka.shutdown_timeout", 15*time.Second)
+	viper.SetDefault("trending.window", time.Hour)
+	viper.SetDefault("trending.baseline", 24*time.Hour)
+	viper.SetDefault("trending.bucket", 5*time.Minute)
+	viper.SetDefault("trending.purchase_weight", 3.0)
+	viper.SetDefault("trending.min_events", 3)
+	viper.SetDefault("trending.retention", 48*time.Hour)
+	viper.SetDefault("trending.prune_interval", 10*time.Minute)
+	viper.SetDefault("events.processed_retention", 7*24*time.Hour)
+	viper.SetDefault("events.processed_prune_interval", time.Hour)
+	viper.SetDefault("analytics.batch.enabled", true)
+	viper.SetDefault("analytics.batch.size", 500)
+	viper.SetDefault("analytics.batch.linger", 200*time.Millisecond)
+	viper.SetDefault("analytics.timeseries.hourly_retention", 7*24*time.Hour)
+	viper.SetDefault("analytics.timeseries.daily_retention", 0)
+	viper.SetDefault("analytics.timeseries.rollup_interval", time.Hour)
+	viper.SetDefault("analytics.categories.active_window", 30*24*time.Hour)
+	viper.SetDefault("analytics.export.page_size", 5000)
+	viper.SetDefault("analytics.reconcile.interval", 24*time.Hour)
+	viper.SetDefault("analytics.reconcile.repair", false)
+	viper.SetDefault("analytics.reconcile.settle", 10*time.Minute)
+	viper.SetDefault("analytics.reconcile.report_limit", 100)
+	viper.SetDefault("analytics.admin_token", "")
 
 	viper.AutomaticEnv()
 
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"recommendation-system/pkg/kafka"
+
+	kafkaGo "github.com/segmentio/kafka-go"
+)
+
+const usage = `Usage: dlq <command> [flags]
+
+Commands:
+  inspect   print the messages of a dead-letter or quarantine topic
+  redrive   publish the messages of a dead-letter or quarantine topic back to their source topic
+
+Run "dlq <command> -h" for the flags of a command.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err := initConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "Config file not loaded, using defaults: %v\n", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	var err error
+	switch os.Args[1] {
+	case "inspect":
+		err = inspect(ctx, os.Args[2:])
+	case "redrive":
+		err = redrive(ctx, os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+type inspectedMessage struct {
+	Partition int               `json:"partition"`
+	Offset    int64             `json:"offset"`
+	Time      time.Time         `json:"time"`
+	Key       string            `json:"key,omitempty"`
+	Headers   map[string]string `json:"headers"`
+	Value     json.RawMessage   `json:"value"`
+}
+
+// inspect prints every message currently in the dead-letter topic as one JSON
+// object per line. It reads without a consumer group, so it can be run any
+// number of times.
+func inspect(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	topic := fs.String("topic", "", "dead-letter or quarantine topic, e.g. user_updates.dlq")
+	limit := fs.Int("limit", 100, "maximum number of messages to print, 0 for all")
+	brokers := fs.String("brokers", strings.Join(viper.GetStringSlice("kafka.brokers"), ","), "comma separated Kafka brokers")
+	fs.Parse(args)
+
+	if *topic == "" {
+		return errors.New("-topic is required")
+	}
+	brokerList := strings.Split(*brokers, ",")
+
+	partitions, err := kafkaGo.LookupPartitions(ctx, "tcp", brokerList[0], *topic)
+	if err != nil {
+		return fmt.Errorf("failed to look up partitions of %s: %w", *topic, err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	printed := 0
+	for _, p := range partitions {
+		conn, err := kafkaGo.DialLeader(ctx, "tcp", brokerList[0], *topic, p.ID)
+		if err != nil {
+			return fmt.Errorf("failed to connect to partition %d: %w", p.ID, err)
+		}
+		first, last, err := conn.ReadOffsets()
+		conn.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read offsets of partition %d: %w", p.ID, err)
+		}
+		if first >= last {
+			continue
+		}
+
+		reader := kafkaGo.NewReader(kafkaGo.ReaderConfig{
+			Brokers:   brokerList,
+			Topic:     *topic,
+			Partition: p.ID,
+			MaxBytes:  10e6,
+		})
+		if err := reader.SetOffset(first); err != nil {
+			reader.Close()
+			return fmt.Errorf("failed to seek partition %d: %w", p.ID, err)
+		}
+
+		for {
+			if *limit > 0 && printed >= *limit {
+				reader.Close()
+				return nil
+			}
+
+			m, err := reader.ReadMessage(ctx)
+			if err != nil {
+				reader.Close()
+				return fmt.Errorf("failed to read partition %d: %w", p.ID, err)
+			}
+
+			out := inspectedMessage{
+				Partition: m.Partition,
+				Offset:    m.Offset,
+				Time:      m.Time,
+				Key:       string(m.Key),
+				Headers:   make(map[string]string, len(m.Headers)),
+				Value:     m.Value,
+			}
+			for _, h := range m.Headers {
+				out.Headers[h.Key] = string(h.Value)
+			}
+			if !json.Valid(m.Value) {
+				out.Value, _ = json.Marshal(string(m.Value))
+			}
+			if err := enc.Encode(out); err != nil {
+				reader.Close()
+				return err
+			}
+			printed++
+
+			if m.Offset+1 >= last {
+				break
+			}
+		}
+		reader.Close()
+	}
+
+	return nil
+}
+
+// redrive moves messages from the dead-letter topic back to the topic they
+// failed on. Progress is tracked by a consumer group, so messages are re-driven
+// only once; the command stops when no message arrives within -idle.
+func redrive(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("redrive", flag.ExitOnError)
+	topic := fs.String("topic", "", "dead-letter or quarantine topic, e.g. user_updates.dlq")
+	limit := fs.Int("limit", 0, "maximum number of messages to re-drive, 0 for all")
+	groupID := fs.String("group", "dlq_redrive_group", "consumer group tracking re-driven messages")
+	idle := fs.Duration("idle", 10*time.Second, "stop after no message arrived for this long")
+	dryRun := fs.Bool("dry-run", false, "print what would be re-driven without publishing")
+	brokers := fs.String("brokers", strings.Join(viper.GetStringSlice("kafka.brokers"), ","), "comma separated Kafka brokers")
+	fs.Parse(args)
+
+	if *topic == "" {
+		return errors.New("-topic is required")
+	}
+	if !strings.HasSuffix(*topic, kafka.DeadLetterSuffix) && !strings.HasSuffix(*topic, kafka.QuarantineSuffix) {
+		return fmt.Errorf("%s is not a dead-letter or quarantine topic", *topic)
+	}
+	brokerList := strings.Split(*brokers, ",")
+
+	client := kafka.NewKafkaClient(brokerList)
+	defer client.Close()
+
+	reader := kafkaGo.NewReader(kafkaGo.ReaderConfig{
+		Brokers:     brokerList,
+		GroupID:     *groupID,
+		Topic:       *topic,
+		StartOffset: kafkaGo.FirstOffset,
+		MaxBytes:    10e6,
+	})
+	defer reader.Close()
+
+	redriven := 0
+	for *limit == 0 || redriven < *limit {
+		fetchCtx, cancel := context.WithTimeout(ctx, *idle)
+		m, err := reader.FetchMessage(fetchCtx)
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed to fetch message: %w", err)
+		}
+
+		out, err := kafka.RedriveMessage(m)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s/%d/%d -> %s (error: %s)\n", m.Topic, m.Partition, m.Offset, out.Topic, kafka.HeaderValue(m, kafka.HeaderDLQError))
+		if *dryRun {
+			redriven++
+			continue
+		}
+
+		if err := client.PublishMessages(ctx, out); err != nil {
+			return fmt.Errorf("failed to publish message to %s: %w", out.Topic, err)
+		}
+		if err := reader.CommitMessages(ctx, m); err != nil {
+			return fmt.Errorf("failed to commit offset: %w", err)
+		}
+		redriven++
+	}
+
+	fmt.Printf("Re-driven %d messages\n", redriven)
+	return nil
+}
+
+func initConfig() error {
+	viper.SetConfigName("config")
+	viper.SetConfigType("yaml")
+	viper.AddConfigPath("configs/")
+
+	viper.SetDefault("kafka.brokers", []string{"kafka:9092"})
+
+	viper.AutomaticEnv()
+
+	return viper.ReadInConfig()
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/viper"
+
+	"recommendation-system/internal/analytics/models"
+	"recommendation-system/internal/analytics/repository"
+	"recommendation-system/internal/analytics/service"
+	"recommendation-system/pkg/db"
+	"recommendation-system/pkg/export"
+	log "recommendation-system/pkg/logger"
+)
+
+const usage = `Usage: export -dataset <dataset> [flags]
+
+Streams an analytics dataset as CSV, NDJSON or Parquet. Datasets:
+product_analytics, user_analytics, product_hourly, product_daily,
+user_hourly, user_daily and category_revenue_daily.
+
+Flags:
+`
+
+func main() {
+	dataset := flag.String("dataset", "", "dataset to export")
+	format := flag.String("format", export.FormatCSV, "csv, ndjson or parquet")
+	out := flag.String("out", "", "output file (default: stdout)")
+	category := flag.String("category", "", "only rows of products of this category")
+	productID := flag.Int64("product", 0, "only rows of this product")
+	userID := flag.Int64("user", 0, "only rows of this user")
+	from := flag.String("from", "", "start of the range, RFC 3339 or YYYY-MM-DD")
+	to := flag.String("to", "", "end of the range (exclusive), RFC 3339 or YYYY-MM-DD")
+	cursor := flag.String("cursor", "", "cursor printed by the previous chunk")
+	limit := flag.Int("limit", 0, "number of rows of the chunk (default: all remaining rows)")
+	pageSize := flag.Int("page-size", 0, "rows read and flushed at a time (default: analytics.export.page_size)")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := initConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "Config file not loaded, using defaults: %v\n", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	q := models.ExportQuery{
+		Dataset:   *dataset,
+		Category:  *category,
+		ProductID: *productID,
+		UserID:    *userID,
+		Cursor:    *cursor,
+		Limit:     *limit,
+	}
+	if *pageSize <= 0 {
+		*pageSize = viper.GetInt("analytics.export.page_size")
+	}
+	if err := run(ctx, q, *from, *to, *format, *out, *pageSize); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, q models.ExportQuery, from, to, format, out string, pageSize int) error {
+	if q.Dataset == "" {
+		return fmt.Errorf("-dataset is required")
+	}
+	if !export.ValidFormat(format) {
+		return fmt.Errorf("unknown format %q", format)
+	}
+	var err error
+	if q.From, err = export.ParseTime(from); err != nil {
+		return fmt.Errorf("invalid -from: %w", err)
+	}
+	if q.To, err = export.ParseTime(to); err != nil {
+		return fmt.Errorf("invalid -to: %w", err)
+	}
+
+	logger, err := log.NewLogger("logger/logger.log", "export", "export-app", "development")
+	if err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+
+	database, err := db.New(db.Config{
+		Host:     viper.GetString("db.host"),
+		Port:     viper.GetInt("db.port"),
+		User:     viper.GetString("db.user"),
+		Password: viper.GetString("db.password"),
+		DBName:   viper.GetString("db.name"),
+		SSLMode:  viper.GetString("db.sslmode"),
+	})
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	// The export only reads the analytics tables, so it needs neither Kafka
+	// nor Redis.
+	analytics := service.NewAnalyticsService(repository.NewAnalyticsRepository(database, logger), nil, nil, nil, service.Config{
+		ExportPageSize: pageSize,
+	}, logger)
+
+	plan, err := analytics.PlanExport(ctx, q)
+	if err != nil {
+		return err
+	}
+
+	output := os.Stdout
+	if out != "" {
+		if output, err = os.Create(out); err != nil {
+			return fmt.Errorf("failed to create %s: %w", out, err)
+		}
+		defer output.Close()
+	}
+	bw := bufio.NewWriter(output)
+	w, err := export.NewWriter(format, bw, plan.Columns)
+	if err != nil {
+		return err
+	}
+	rows, err := analytics.Export(ctx, plan, w)
+	if err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to finish export: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %d rows of %s\n", rows, q.Dataset)
+	if plan.NextCursor != "" {
+		fmt.Fprintf(os.Stderr, "Next cursor: %s\n", plan.NextCursor)
+	}
+	return nil
+}
+
+func initConfig() error {
+	viper.SetConfigName("config")
+	viper.SetConfigType("yaml")
+	viper.AddConfigPath("configs/")
+
+	viper.SetDefault("db.sslmode", "disable")
+	viper.SetDefault("analytics.export.page_size", 5000)
+
+	viper.AutomaticEnv()
+
+	return viper.ReadInConfig()
+}
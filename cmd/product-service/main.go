@@ -1,15 +1,19 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	log "recommendation-system/pkg/logger"
 
 	_ "recommendation-system/cmd/product-service/docs"
 
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/viper"
 	fiberSwagger "github.com/swaggo/fiber-swagger"
 
@@ -17,7 +21,9 @@ import (
 	"recommendation-system/internal/product/repository"
 	"recommendation-system/internal/product/service"
 	"recommendation-system/pkg/db"
+	"recommendation-system/pkg/events"
 	"recommendation-system/pkg/kafka"
+	"recommendation-system/pkg/outbox"
 )
 
 // @title           Product Service API
@@ -65,12 +71,29 @@ func main() {
 	defer kafkaClient.Close()
 	logger.Println("Kafka client initialized")
 
-	if err := kafkaClient.CreateTopic("product_updates", 1, 1); err != nil {
+	if err := kafkaClient.CreateTopic("product_updates", viper.GetInt("kafka.partitions"), viper.GetInt("kafka.replication_factor")); err != nil {
 		logger.Printf("Topic 'product_updates' may already exist or failed to create: %v", err)
 	}
 
 	productRepo := repository.NewProductRepository(database, logger)
-	productService := service.NewProductService(productRepo, kafkaClient, logger)
+	eventMode, err := events.ParseMode(viper.GetString("events.mode"))
+	if err != nil {
+		logger.Fatalf("Invalid events mode: %v", err)
+	}
+	outboxStore := outbox.NewStore(database, "product-service")
+	outboxRelay := outbox.NewRelay(database, outboxStore, kafkaClient, outbox.RelayConfig{
+		PollInterval: viper.GetDuration("outbox.poll_interval"),
+		BatchSize:    viper.GetInt("outbox.batch_size"),
+		MaxBackoff:   viper.GetDuration("outbox.max_backoff"),
+		Retention:    viper.GetDuration("outbox.retention"),
+		Mode:         eventMode,
+	}, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go outboxRelay.Run(ctx)
+
+	productService := service.NewProductService(productRepo, outboxStore, logger)
 	productHandler := http.NewHandler(productService, logger)
 
 	jwtSecret := viper.GetString("jwt.secret")
@@ -81,6 +104,7 @@ func main() {
 
 	app := http.NewFiberApp(productHandler, jwtSecret)
 	app.Get("/swagger/*", fiberSwagger.WrapHandler)
+	app.Get("/metrics", adaptor.HTTPHandler(promhttp.Handler()))
 
 	go func() {
 		if err := app.Listen(viper.GetString("server.product_service_address")); err != nil {
@@ -93,6 +117,8 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
+	cancel()
+
 	if err := app.Shutdown(); err != nil {
 		logger.Fatalf("Failed to shutdown server: %v", err)
 	}
@@ -107,6 +133,13 @@ func initConfig() error {
 	viper.SetDefault("server.product_service_address", ":8081")
 	viper.SetDefault("db.sslmode", "disable")
 	viper.SetDefault("kafka.brokers", []string{"kafka:9092"})
+	viper.SetDefault("kafka.partitions", 3)
+	viper.SetDefault("kafka.replication_factor", 1)
+	viper.SetDefault("outbox.poll_interval", 500*time.Millisecond)
+	viper.SetDefault("outbox.batch_size", 100)
+	viper.SetDefault("outbox.max_backoff", 30*time.Second)
+	viper.SetDefault("outbox.retention", 24*time.Hour)
+	viper.SetDefault("events.mode", "structured")
 	viper.SetDefault("jwt.secret", "your_secret_key")
 
 	viper.AutomaticEnv()
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
@@ -12,6 +13,8 @@ import (
 
 	_ "recommendation-system/cmd/recommendation-service/docs"
 
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/viper"
 	fiberSwagger "github.com/swaggo/fiber-swagger"
 
@@ -19,8 +22,10 @@ import (
 	"recommendation-system/internal/recommendation/repository"
 	"recommendation-system/internal/recommendation/service"
 	"recommendation-system/pkg/db"
+	"recommendation-system/pkg/events"
 	"recommendation-system/pkg/kafka"
 	"recommendation-system/pkg/redis"
+	"recommendation-system/pkg/trending"
 
 	kafkaGo "github.com/segmentio/kafka-go"
 )
@@ -67,10 +72,25 @@ func main() {
 
 	kafkaBrokers := viper.GetStringSlice("kafka.brokers")
 	kafkaClient := kafka.NewKafkaClient(kafkaBrokers)
+	kafkaClient.Retry = kafka.RetryConfig{
+		MaxAttempts:    viper.GetInt("kafka.retry.max_attempts"),
+		InitialBackoff: viper.GetDuration("kafka.retry.initial_backoff"),
+		MaxBackoff:     viper.GetDuration("kafka.retry.max_backoff"),
+	}
+	kafkaClient.Logger = logger
 	defer kafkaClient.Close()
 	logger.Println("Kafka client initialized")
 
-	if err := kafkaClient.CreateTopic("recommendation_updates", 1, 1); err != nil {
+	consumedTopics := []string{"user_updates", "product_updates"}
+	for _, topic := range consumedTopics {
+		for _, failed := range []string{kafka.DeadLetterTopic(topic), kafka.QuarantineTopic(topic)} {
+			if err := kafkaClient.CreateTopic(failed, viper.GetInt("kafka.partitions"), viper.GetInt("kafka.replication_factor")); err != nil {
+				logger.Printf("Topic '%s' may already exist or failed to create: %v", failed, err)
+			}
+		}
+	}
+
+	if err := kafkaClient.CreateTopic("recommendation_updates", viper.GetInt("kafka.partitions"), viper.GetInt("kafka.replication_factor")); err != nil {
 		logger.Printf("Topic 'recommendation_updates' may already exist or failed to create: %v", err)
 	}
 
@@ -82,8 +102,35 @@ func main() {
 	logger.Println("Redis client initialized")
 
 	recommendationRepo := repository.NewRecommendationRepository(database, logger)
-	recommendationService := service.NewRecommendationService(recommendationRepo, kafkaClient, redisClient, logger)
-	recommendationHandler := http.NewHandler(recommendationService, logger)
+	groupID := "recommendation_service_group"
+	processedEvents := events.NewProcessedStore(database, groupID)
+	eventMode, err := events.ParseMode(viper.GetString("events.mode"))
+	if err != nil {
+		logger.Fatalf("Invalid events mode: %v", err)
+	}
+	recommendationService := service.NewRecommendationService(recommendationRepo, processedEvents, kafkaClient, redisClient, service.Config{
+		BatchConcurrency: viper.GetInt("recommendation.batch_concurrency"),
+		Price: service.PriceConfig{
+			Weight:       viper.GetFloat64("recommendation.price.weight"),
+			Filter:       viper.GetBool("recommendation.price.filter"),
+			Tolerance:    viper.GetFloat64("recommendation.price.tolerance"),
+			MinPurchases: viper.GetInt("recommendation.price.min_purchases"),
+		},
+		Trending: service.TrendingConfig{
+			Slots: viper.GetInt("recommendation.trending_slots"),
+			Config: trending.Config{
+				Window:         viper.GetDuration("trending.window"),
+				Baseline:       viper.GetDuration("trending.baseline"),
+				PurchaseWeight: viper.GetFloat64("trending.purchase_weight"),
+				MinEvents:      viper.GetInt("trending.min_events"),
+			},
+		},
+		ProcessedRetention: viper.GetDuration("events.processed_retention"),
+		EventMode:          eventMode,
+		RefreshInterval:    viper.GetDuration("recommendation.refresh_interval"),
+	}, logger)
+	recommendationHub := service.NewHub(logger)
+	recommendationHandler := http.NewHandler(recommendationService, recommendationHub, viper.GetInt("recommendation.batch_max_users"), logger)
 
 	jwtSecret := viper.GetString("jwt.secret")
 	if jwtSecret == "" {
@@ -93,6 +140,7 @@ func main() {
 
 	app := http.NewFiberApp(recommendationHandler, jwtSecret)
 	app.Get("/swagger/*", fiberSwagger.WrapHandler)
+	app.Get("/metrics", adaptor.HTTPHandler(promhttp.Handler()))
 
 	go func() {
 		if err := app.Listen(viper.GetString("server.recommendation_service_address")); err != nil {
@@ -101,26 +149,70 @@ func main() {
 	}()
 	logger.Printf("Recommendation Service is running on %s", viper.GetString("server.recommendation_service_address"))
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	// Handlers get their own context so that shutdown stops fetching without
+	// aborting the work of messages already being handled.
+	consumerCtx, stopConsumers := context.WithCancel(context.Background())
+	defer stopConsumers()
+	var consumers sync.WaitGroup
 
+	consumers.Add(2)
 	go func() {
-		topics := []string{"user_updates", "product_updates"}
-		groupID := "recommendation_service_group"
-		if err := kafkaClient.SubscribeToTopicsFallback(ctx, topics, groupID, func(m kafkaGo.Message) error {
+		defer consumers.Done()
+		ctx := context.Background()
+		if err := kafkaClient.SubscribeToTopicsFallback(consumerCtx, consumedTopics, groupID, func(m kafkaGo.Message) error {
 			return recommendationService.ProcessKafkaMessage(ctx, m)
 		}); err != nil {
 			logger.Printf("Error subscribing to Kafka topics: %v", err)
 		}
 	}()
 
+	go func() {
+		defer consumers.Done()
+		ctx := context.Background()
+		if err := kafkaClient.SubscribeToTopicBroadcast(consumerCtx, "recommendation_updates", func(m kafkaGo.Message) error {
+			return recommendationHub.ProcessKafkaMessage(ctx, m)
+		}); err != nil {
+			logger.Printf("Error subscribing to recommendation updates: %v", err)
+		}
+	}()
+
+	// Periodic jobs are stopped and waited for on shutdown like the consumers.
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	var jobs sync.WaitGroup
+
+	runPeriodically(jobsCtx, &jobs, viper.GetDuration("events.processed_prune_interval"), func(ctx context.Context) {
+		if err := recommendationService.PruneProcessedEvents(ctx); err != nil {
+			logger.Printf("Failed to prune processed events: %v", err)
+		}
+	})
+	runPeriodically(jobsCtx, &jobs, viper.GetDuration("recommendation.refresh_interval"), func(ctx context.Context) {
+		if err := recommendationService.RefreshPending(ctx); err != nil && ctx.Err() == nil {
+			logger.Printf("Failed to refresh pending recommendations: %v", err)
+		}
+	})
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	cancel()
-
-	time.Sleep(2 * time.Second)
+	logger.Println("Stopping Kafka consumers and periodic jobs...")
+	stopConsumers()
+	stopJobs()
+	consumersDone := make(chan struct{})
+	go func() {
+		consumers.Wait()
+		jobs.Wait()
+		close(consumersDone)
+	}()
+	shutdownTimeout := viper.GetDuration("kafka.shutdown_timeout")
+	select {
+	case <-consumersDone:
+		logger.Println("Kafka consumers and periodic jobs stopped, offsets of handled messages committed")
+	case <-time.After(shutdownTimeout):
+		logger.Printf("Kafka consumers did not stop within %s, uncommitted messages will be redelivered", shutdownTimeout)
+	}
+	recommendationHub.Close()
 
 	if err := app.Shutdown(); err != nil {
 		logger.Fatalf("Failed to shutdown server: %v", err)
@@ -128,6 +220,29 @@ func main() {
 	logger.Println("Recommendation Service stopped gracefully")
 }
 
+// runPeriodically calls job every interval until ctx is done. A job that is
+// running when ctx is done gets the cancelled ctx and is waited for through wg.
+// A non-positive interval disables the job.
+func runPeriodically(ctx context.Context, wg *sync.WaitGroup, interval time.Duration, job func(ctx context.Context)) {
+	if interval <= 0 {
+		return
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				job(ctx)
+			}
+		}
+	}()
+}
+
 func initConfig() error {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
@@ -136,7 +251,28 @@ func initConfig() error {
 	viper.SetDefault("server.recommendation_service_address", ":8082")
 	viper.SetDefault("db.sslmode", "disable")
 	viper.SetDefault("kafka.brokers", []string{"kafka:9092"})
+	viper.SetDefault("kafka.partitions", 3)
+	viper.SetDefault("kafka.replication_factor", 1)
 	viper.SetDefault("jwt.secret", "your_secret_key")
+	viper.SetDefault("kafka.retry.max_attempts", 5)
+	viper.SetDefault("kafka.retry.initial_backoff", 200*time.Millisecond)
+	viper.SetDefault("kafka.retry.max_backoff", 10*time.Second)
+	viper.SetDefault("kafka.shutdown_timeout", 15*time.Second)
+	viper.SetDefault("recommendation.batch_concurrency", 8)
+	viper.SetDefault("recommendation.batch_max_users", 50000)
+	viper.SetDefault("recommendation.price.weight", 0.5)
+	viper.SetDefault("recommendation.price.filter", false)
+	viper.SetDefault("recommendation.price.tolerance", 1.5)
+	viper.SetDefault("recommendation.price.min_purchases", 3)
+	viper.SetDefault("recommendation.trending_slots", 1)
+	viper.SetDefault("recommendation.refresh_interval", 5*time.Second)
+	viper.SetDefault("trending.window", time.Hour)
+	viper.SetDefault("trending.baseline", 24*time.Hour)
+	viper.SetDefault("trending.purchase_weight", 3.0)
+	viper.SetDefault("trending.min_events", 3)
+	viper.SetDefault("events.processed_retention", 7*24*time.Hour)
+	viper.SetDefault("events.processed_prune_interval", time.Hour)
+	viper.SetDefault("events.mode", "structured")
 
 	viper.AutomaticEnv()
 
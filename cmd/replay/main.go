@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/viper"
+
+	analyticsRepository "recommendation-system/internal/analytics/repository"
+	analyticsService "recommendation-system/internal/analytics/service"
+	recommendationRepository "recommendation-system/internal/recommendation/repository"
+	recommendationService "recommendation-system/internal/recommendation/service"
+	"recommendation-system/internal/replay/repository"
+	"recommendation-system/internal/replay/service"
+	"recommendation-system/pkg/db"
+	"recommendation-system/pkg/events"
+	"recommendation-system/pkg/kafka"
+	log "recommendation-system/pkg/logger"
+	"recommendation-system/pkg/redis"
+	"recommendation-system/pkg/trending"
+)
+
+const usage = `Usage: replay <command> [flags]
+
+Commands:
+  reset-offsets   move the committed offsets of a consumer group to a time or offset
+  rebuild         rebuild analytics and category preferences from the source tables
+
+Run "replay <command> -h" for the flags of a command.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err := initConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "Config file not loaded, using defaults: %v\n", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	var err error
+	switch os.Args[1] {
+	case "reset-offsets":
+		err = resetOffsets(ctx, os.Args[2:])
+	case "rebuild":
+		err = rebuild(ctx, os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// resetOffsets rewinds (or forwards) a consumer group, so that the service
+// re-consumes the topics from that point when it is started again. The
+// service must be stopped while the offsets are changed.
+func resetOffsets(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("reset-offsets", flag.ExitOnError)
+	groupID := fs.String("group", "", "consumer group, e.g. analytics_service_group")
+	topics := fs.String("topics", "user_updates,product_updates", "comma separated topics")
+	to := fs.String("to", "", `RFC3339 time to rewind to, or "earliest"`)
+	offset := fs.Int64("offset", -1, "offset to set on every partition instead of -to")
+	dryRun := fs.Bool("dry-run", false, "print the offsets without committing them")
+	fs.Parse(args)
+
+	if *groupID == "" {
+		return errors.New("-group is required")
+	}
+	if (*to == "") == (*offset < 0) {
+		return errors.New("exactly one of -to and -offset is required")
+	}
+
+	var at time.Time
+	if *to != "" && *to != "earliest" {
+		t, err := time.Parse(time.RFC3339, *to)
+		if err != nil {
+			return fmt.Errorf("invalid -to: %w", err)
+		}
+		at = t
+	}
+
+	client := kafka.NewKafkaClient(viper.GetStringSlice("kafka.brokers"))
+	defer client.Close()
+
+	for _, topic := range strings.Split(*topics, ",") {
+		offsets, err := client.OffsetsAt(ctx, topic, at)
+		if err != nil {
+			return fmt.Errorf("failed to look up offsets of %s: %w", topic, err)
+		}
+		if *offset >= 0 {
+			for p := range offsets {
+				offsets[p] = *offset
+			}
+		}
+
+		for p, o := range offsets {
+			fmt.Printf("%s %s/%d -> %d\n", *groupID, topic, p, o)
+		}
+		if *dryRun {
+			continue
+		}
+
+		if err := client.CommitGroupOffsets(ctx, *groupID, topic, offsets); err != nil {
+			return fmt.Errorf("failed to reset offsets of %s: %w", topic, err)
+		}
+	}
+	return nil
+}
+
+// rebuild truncates the derived tables and replays events synthesized from
+// likes, dislikes, purchases and products through the analytics and
+// recommendation handlers.
+func rebuild(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("rebuild", flag.ExitOnError)
+	target := fs.String("target", "all", "analytics, recommendation or all")
+	refresh := fs.Bool("refresh", true, "regenerate the recommendation list of every replayed user")
+	yes := fs.Bool("yes", false, "confirm that the derived tables may be truncated")
+	fs.Parse(args)
+
+	opts := service.RebuildOptions{Refresh: *refresh}
+	switch *target {
+	case "analytics":
+		opts.Analytics = true
+	case "recommendation":
+		opts.Recommendations = true
+	case "all":
+		opts.Analytics = true
+		opts.Recommendations = true
+	default:
+		return fmt.Errorf("unknown target %q", *target)
+	}
+	if !*yes {
+		return errors.New("rebuild truncates the derived tables, pass -yes to confirm")
+	}
+
+	logger, err := log.NewLogger("logger/logger.log", "replay", "replay-app", "development")
+	if err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+
+	database, err := db.New(db.Config{
+		Host:     viper.GetString("db.host"),
+		Port:     viper.GetInt("db.port"),
+		User:     viper.GetString("db.user"),
+		Password: viper.GetString("db.password"),
+		DBName:   viper.GetString("db.name"),
+		SSLMode:  viper.GetString("db.sslmode"),
+	})
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	kafkaClient := kafka.NewKafkaClient(viper.GetStringSlice("kafka.brokers"))
+	defer kafkaClient.Close()
+
+	redisHosts := viper.GetStringSlice("redis.host")
+	if len(redisHosts) == 0 {
+		return errors.New("no Redis hosts specified in the configuration")
+	}
+	redisClient := redis.NewRedisClient(redisHosts[0], "", 0)
+
+	// Replayed events get fresh IDs, so the replay deduplicates under its own
+	// consumer names and forgets them afterwards.
+	analyticsProcessed := events.NewProcessedStore(database, "replay_analytics")
+	recommendationProcessed := events.NewProcessedStore(database, "replay_recommendation")
+	defer analyticsProcessed.Clear(context.Background())
+	defer recommendationProcessed.Clear(context.Background())
+
+	analytics := analyticsService.NewAnalyticsService(analyticsRepository.NewAnalyticsRepository(database, logger), analyticsProcessed, kafkaClient, redisClient, analyticsService.Config{
+		Trending: analyticsService.TrendingConfig{
+			Config:    trendingConfig(),
+			Bucket:    viper.GetDuration("trending.bucket"),
+			Retention: viper.GetDuration("trending.retention"),
+		},
+	}, logger)
+	recommendations := recommendationService.NewRecommendationService(recommendationRepository.NewRecommendationRepository(database, logger), recommendationProcessed, kafkaClient, redisClient, recommendationService.Config{
+		Price: recommendationService.PriceConfig{
+			Weight:       viper.GetFloat64("recommendation.price.weight"),
+			Filter:       viper.GetBool("recommendation.price.filter"),
+			Tolerance:    viper.GetFloat64("recommendation.price.tolerance"),
+			MinPurchases: viper.GetInt("recommendation.price.min_purchases"),
+		},
+		Trending: recommendationService.TrendingConfig{
+			Slots:  viper.GetInt("recommendation.trending_slots"),
+			Config: trendingConfig(),
+		},
+	}, logger)
+
+	replayService := service.NewReplayService(repository.NewSourceRepository(database, logger), analytics, recommendations, logger)
+	result, err := replayService.Rebuild(ctx, opts)
+	if result != nil {
+		out, _ := json.Marshal(result)
+		fmt.Println(string(out))
+	}
+	return err
+}
+
+func trendingConfig() trending.Config {
+	return trending.Config{
+		Window:         viper.GetDuration("trending.window"),
+		Baseline:       viper.GetDuration("trending.baseline"),
+		PurchaseWeight: viper.GetFloat64("trending.purchase_weight"),
+		MinEvents:      viper.GetInt("trending.min_events"),
+	}
+}
+
+func initConfig() error {
+	viper.SetConfigName("config")
+	viper.SetConfigType("yaml")
+	viper.AddConfigPath("configs/")
+
+	viper.SetDefault("db.sslmode", "disable")
+	viper.SetDefault("kafka.brokers", []string{"kafka:9092"})
+	viper.SetDefault("redis.host", "redis:6379")
+	viper.SetDefault("recommendation.price.weight", 0.5)
+	viper.SetDefault("recommendation.price.tolerance", 1.5)
+	viper.SetDefault("recommendation.price.min_purchases", 3)
+	viper.SetDefault("recommendation.trending_slots", 1)
+	viper.SetDefault("trending.window", time.Hour)
+	viper.SetDefault("trending.baseline", 24*time.Hour)
+	viper.SetDefault("trending.bucket", 5*time.Minute)
+	viper.SetDefault("trending.purchase_weight", 3.0)
+	viper.SetDefault("trending.min_events", 3)
+	viper.SetDefault("trending.retention", 48*time.Hour)
+
+	viper.AutomaticEnv()
+
+	return viper.ReadInConfig()
+}
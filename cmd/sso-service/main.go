@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	log "recommendation-system/pkg/logger"
 
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/viper"
 	fiberSwagger "github.com/swaggo/fiber-swagger"
 
@@ -16,7 +20,9 @@ import (
 	"recommendation-system/internal/sso/repository"
 	"recommendation-system/internal/sso/service"
 	"recommendation-system/pkg/db"
+	"recommendation-system/pkg/events"
 	"recommendation-system/pkg/kafka"
+	"recommendation-system/pkg/outbox"
 )
 
 // @title           SSO Service API
@@ -71,12 +77,30 @@ func main() {
 	logger.Println("JWT secret loaded")
 
 	userRepo := repository.NewUserRepository(database, logger)
-	userService := service.NewUserService(userRepo, kafkaClient, []byte(jwtSecret), logger)
+	eventMode, err := events.ParseMode(viper.GetString("events.mode"))
+	if err != nil {
+		logger.Fatalf("Invalid events mode: %v", err)
+	}
+	outboxStore := outbox.NewStore(database, "sso-service")
+	outboxRelay := outbox.NewRelay(database, outboxStore, kafkaClient, outbox.RelayConfig{
+		PollInterval: viper.GetDuration("outbox.poll_interval"),
+		BatchSize:    viper.GetInt("outbox.batch_size"),
+		MaxBackoff:   viper.GetDuration("outbox.max_backoff"),
+		Retention:    viper.GetDuration("outbox.retention"),
+		Mode:         eventMode,
+	}, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go outboxRelay.Run(ctx)
+
+	userService := service.NewUserService(userRepo, outboxStore, []byte(jwtSecret), logger)
 	userHandler := http.NewHandler(userService, logger)
 
 	app := http.NewFiberApp(userHandler)
 
 	app.Get("/swagger/*", fiberSwagger.WrapHandler)
+	app.Get("/metrics", adaptor.HTTPHandler(promhttp.Handler()))
 
 	go func() {
 		if err := app.Listen(viper.GetString("server.sso_service_address")); err != nil {
@@ -90,6 +114,8 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
+	cancel()
+
 	if err := app.Shutdown(); err != nil {
 		logger.Fatalf("Failed to shutdown SSO server: %v", err)
 	}
@@ -104,6 +130,11 @@ func initConfig() error {
 	viper.SetDefault("server.sso_service_address", ":8084")
 	viper.SetDefault("db.sslmode", "disable")
 	viper.SetDefault("kafka.brokers", []string{"kafka:9092"})
+	viper.SetDefault("outbox.poll_interval", 500*time.Millisecond)
+	viper.SetDefault("outbox.batch_size", 100)
+	viper.SetDefault("outbox.max_backoff", 30*time.Second)
+	viper.SetDefault("outbox.retention", 24*time.Hour)
+	viper.SetDefault("events.mode", "structured")
 	viper.SetDefault("redis.host", "redis:6379")
 	viper.SetDefault("jwt.secret", "your_secret_key")
 
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	log "recommendation-system/pkg/logger"
 
@@ -13,9 +15,13 @@ import (
 	"recommendation-system/internal/user/repository"
 	"recommendation-system/internal/user/service"
 	"recommendation-system/pkg/db"
+	"recommendation-system/pkg/events"
 	"recommendation-system/pkg/kafka"
+	"recommendation-system/pkg/outbox"
 	"recommendation-system/pkg/redis"
 
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/viper"
 	fiberSwagger "github.com/swaggo/fiber-swagger"
 )
@@ -67,7 +73,7 @@ func main() {
 	defer kafkaClient.Close()
 	logger.Println("Kafka client initialized")
 
-	if err := kafkaClient.CreateTopic("user_updates", 1, 1); err != nil {
+	if err := kafkaClient.CreateTopic("user_updates", viper.GetInt("kafka.partitions"), viper.GetInt("kafka.replication_factor")); err != nil {
 		logger.Printf("Topic 'user_updates' may already exist or failed to create: %v", err)
 	}
 
@@ -79,7 +85,24 @@ func main() {
 	logger.Println("Redis client initialized")
 
 	userRepo := repository.NewUserRepository(database, logger)
-	userService := service.NewUserService(userRepo, kafkaClient, redisClient, logger)
+	eventMode, err := events.ParseMode(viper.GetString("events.mode"))
+	if err != nil {
+		logger.Fatalf("Invalid events mode: %v", err)
+	}
+	outboxStore := outbox.NewStore(database, "user-service")
+	outboxRelay := outbox.NewRelay(database, outboxStore, kafkaClient, outbox.RelayConfig{
+		PollInterval: viper.GetDuration("outbox.poll_interval"),
+		BatchSize:    viper.GetInt("outbox.batch_size"),
+		MaxBackoff:   viper.GetDuration("outbox.max_backoff"),
+		Retention:    viper.GetDuration("outbox.retention"),
+		Mode:         eventMode,
+	}, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go outboxRelay.Run(ctx)
+
+	userService := service.NewUserService(userRepo, outboxStore, redisClient, logger)
 	userHandler := http.NewHandler(userService, logger)
 
 	jwtSecret := viper.GetString("jwt.secret")
@@ -91,6 +114,7 @@ func main() {
 	app := http.NewFiberApp(userHandler, jwtSecret)
 
 	app.Get("/swagger/*", fiberSwagger.WrapHandler)
+	app.Get("/metrics", adaptor.HTTPHandler(promhttp.Handler()))
 
 	go func() {
 		if err := app.Listen(viper.GetString("server.user_service_address")); err != nil {
@@ -104,6 +128,8 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
+	cancel()
+
 	if err := app.Shutdown(); err != nil {
 		logger.Fatalf("Failed to shutdown server: %v", err)
 	}
@@ -118,6 +144,13 @@ func initConfig() error {
 	viper.SetDefault("server.user_service_address", ":8080")
 	viper.SetDefault("db.sslmode", "disable")
 	viper.SetDefault("kafka.brokers", []string{"kafka:9092"})
+	viper.SetDefault("kafka.partitions", 3)
+	viper.SetDefault("kafka.replication_factor", 1)
+	viper.SetDefault("outbox.poll_interval", 500*time.Millisecond)
+	viper.SetDefault("outbox.batch_size", 100)
+	viper.SetDefault("outbox.max_backoff", 30*time.Second)
+	viper.SetDefault("outbox.retention", 24*time.Hour)
+	viper.SetDefault("events.mode", "structured")
 	viper.SetDefault("jwt.secret", "your_secret_key")
 
 	viper.AutomaticEnv()
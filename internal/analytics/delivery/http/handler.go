@@ -1,10 +1,20 @@
 package http
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
 	"strconv"
+	"strings"
 
+	"recommendation-system/internal/analytics/models"
 	"recommendation-system/internal/analytics/service"
 	"recommendation-system/pkg/auth"
+	"recommendation-system/pkg/events"
+	"recommendation-system/pkg/export"
 	log "recommendation-system/pkg/logger"
 
 	"github.com/gofiber/fiber/v2"
@@ -28,10 +38,13 @@ func NewHandler(s service.AnalyticsService, logger *log.Logger) *Handler {
 	return &Handler{service: s, logger: logger}
 }
 
-func NewFiberApp(s service.AnalyticsService, jwtSecret string, logger *log.Logger) *fiber.App {
+// NewFiberApp serves the analytics API. Routes that change analytics, such as
+// reconcile, additionally require adminToken.
+func NewFiberApp(s service.AnalyticsService, jwtSecret, adminToken string, logger *log.Logger) *fiber.App {
 	app := fiber.New()
 	api := app.Group("/api")
 	analytics := api.Group("/analytics")
+	eventSchemas := api.Group("/events/schemas")
 
 	api.Use(auth.JWTMiddleware(auth.JWTConfig{
 		Secret: jwtSecret,
@@ -39,14 +52,29 @@ func NewFiberApp(s service.AnalyticsService, jwtSecret string, logger *log.Logge
 
 	handler := NewHandler(s, logger)
 	analytics.Get("/products/:id", handler.getProductAnalytics())
+	analytics.Get("/products/:id/timeseries", handler.getProductTimeSeries())
+	analytics.Get("/products/:id/funnel", handler.getProductFunnel())
+	analytics.Get("/categories", handler.listCategoryAnalytics())
+	analytics.Get("/categories/:name", handler.getCategoryAnalytics())
+	analytics.Get("/categories/:category/funnel", handler.getCategoryFunnel())
 	analytics.Get("/users/:id", handler.getUserAnalytics())
+	analytics.Get("/users/:id/timeseries", handler.getUserTimeSeries())
+	analytics.Get("/trending", handler.getTrendingProducts())
+	analytics.Get("/revenue", handler.getRevenue())
+	analytics.Get("/export/:dataset", handler.getExport())
+	analytics.Post("/reconcile", auth.AdminTokenMiddleware(adminToken), handler.reconcile())
+	analytics.Get("/cohorts", handler.getCohortRetention())
+	analytics.Get("/leaderboards/products/:board", handler.getProductLeaderboard())
+	analytics.Get("/leaderboards/users", handler.getUserLeaderboard())
+	eventSchemas.Get("/", handler.getEventSchemas())
+	eventSchemas.Get("/:type", handler.getEventSchema())
 
 	return app
 }
 
 // getProductAnalytics godoc
 // @Summary      Get product analytics
-// @Description  Retrieve analytics data for a specific product (likes, dislikes, purchases).
+// @Description  Retrieve analytics data for a specific product (likes, dislikes, purchases, revenue). distinct_users holds approximate (HyperLogLog) numbers of distinct users who liked or bought the product today and in the last 7 days (UTC); it is omitted when Redis is unavailable.
 // @Tags         analytics :8083
 // @Accept       json
 // @Produce      json
@@ -79,7 +107,7 @@ func (h *Handler) getProductAnalytics() fiber.Handler {
 
 // getUserAnalytics godoc
 // @Summary      Get user analytics
-// @Description  Retrieve analytics data for a specific user (total likes, dislikes, purchases).
+// @Description  Retrieve analytics data for a specific user (total likes, dislikes, purchases, lifetime value and average order value).
 // @Tags         analytics :8083
 // @Accept       json
 // @Produce      json
@@ -109,3 +137,628 @@ func (h *Handler) getUserAnalytics() fiber.Handler {
 		return c.JSON(ua)
 	}
 }
+
+// listCategoryAnalytics godoc
+// @Summary      List category analytics
+// @Description  Retrieve the likes, dislikes, purchases and users of every category. Interactions are counted in the category a product had when they happened; active users are those who interacted with the category within the configured window.
+// @Tags         analytics :8083
+// @Accept       json
+// @Produce      json
+// @Param Authorization header string true "Bearer {token}"
+// @Security     BearerAuth
+// @Success      200  {array}   models.CategoryAnalytics
+// @Failure      500  {object}  map[string]interface{}
+// @Router       /analytics/categories [get]
+func (h *Handler) listCategoryAnalytics() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		h.logger.Println("Processing request to list category analytics")
+		categories, err := h.service.ListCategoryAnalytics(c.Context())
+		if err != nil {
+			h.logger.Printf("Failed to retrieve category analytics: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		h.logger.Printf("Successfully retrieved analytics of %d categories", len(categories))
+		return c.JSON(categories)
+	}
+}
+
+// getCategoryAnalytics godoc
+// @Summary      Get category analytics
+// @Description  Retrieve the likes, dislikes, purchases and users of one category.
+// @Tags         analytics :8083
+// @Accept       json
+// @Produce      json
+// @Param        name  path      string  true  "Category"
+// @Param Authorization header string true "Bearer {token}"
+// @Security     BearerAuth
+// @Success      200  {object}  models.CategoryAnalytics
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      404  {object}  map[string]interface{}
+// @Router       /analytics/categories/{name} [get]
+func (h *Handler) getCategoryAnalytics() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		h.logger.Println("Processing request to get category analytics")
+		category, err := url.PathUnescape(c.Params("name"))
+		if err != nil || category == "" {
+			h.logger.Printf("Invalid category: %s", c.Params("name"))
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid category"})
+		}
+
+		ca, err := h.service.GetCategoryAnalytics(c.Context(), category)
+		if err != nil {
+			h.logger.Printf("Failed to retrieve analytics for category %q: %v", category, err)
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		h.logger.Printf("Successfully retrieved analytics for category: %q", category)
+		return c.JSON(ca)
+	}
+}
+
+// getProductTimeSeries godoc
+// @Summary      Get product analytics time series
+// @Description  Retrieve likes, dislikes and purchases of a product per hour or day. Hourly buckets are kept for a limited period, after which they are only available as daily buckets.
+// @Tags         analytics :8083
+// @Accept       json
+// @Produce      json
+// @Param        id           path      int     true   "Product ID"
+// @Param        from         query     string  false  "Start of the range, RFC 3339 or YYYY-MM-DD (default: 30 days or 48 hours before to)"
+// @Param        to           query     string  false  "End of the range (exclusive), RFC 3339 or YYYY-MM-DD (default: now)"
+// @Param        granularity  query     string  false  "hour or day (default: day)"
+// @Param Authorization header string true "Bearer {token}"
+// @Security     BearerAuth
+// @Success      200  {object}  models.TimeSeries
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      500  {object}  map[string]interface{}
+// @Router       /analytics/products/{id}/timeseries [get]
+func (h *Handler) getProductTimeSeries() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		h.logger.Println("Processing request to get product time series")
+		pid, err := strconv.Atoi(c.Params("id"))
+		if err != nil || pid <= 0 {
+			h.logger.Printf("Invalid product ID: %s", c.Params("id"))
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid product ID"})
+		}
+
+		q, err := parseTimeSeriesQuery(c)
+		if err != nil {
+			h.logger.Printf("Invalid time series query: %v", err)
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		series, err := h.service.GetProductTimeSeries(c.Context(), int64(pid), q)
+		if errors.Is(err, service.ErrInvalidTimeSeriesQuery) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		} else if err != nil {
+			h.logger.Printf("Failed to retrieve time series for product ID %d: %v", pid, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		h.logger.Printf("Successfully retrieved %d time series points for product ID: %d", len(series.Points), pid)
+		return c.JSON(series)
+	}
+}
+
+// getUserTimeSeries godoc
+// @Summary      Get user analytics time series
+// @Description  Retrieve likes, dislikes and purchases of a user per hour or day. Hourly buckets are kept for a limited period, after which they are only available as daily buckets.
+// @Tags         analytics :8083
+// @Accept       json
+// @Produce      json
+// @Param        id           path      int     true   "User ID"
+// @Param        from         query     string  false  "Start of the range, RFC 3339 or YYYY-MM-DD (default: 30 days or 48 hours before to)"
+// @Param        to           query     string  false  "End of the range (exclusive), RFC 3339 or YYYY-MM-DD (default: now)"
+// @Param        granularity  query     string  false  "hour or day (default: day)"
+// @Param Authorization header string true "Bearer {token}"
+// @Security     BearerAuth
+// @Success      200  {object}  models.TimeSeries
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      500  {object}  map[string]interface{}
+// @Router       /analytics/users/{id}/timeseries [get]
+func (h *Handler) getUserTimeSeries() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		h.logger.Println("Processing request to get user time series")
+		uid, err := strconv.Atoi(c.Params("id"))
+		if err != nil || uid <= 0 {
+			h.logger.Printf("Invalid user ID: %s", c.Params("id"))
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+		}
+
+		q, err := parseTimeSeriesQuery(c)
+		if err != nil {
+			h.logger.Printf("Invalid time series query: %v", err)
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		series, err := h.service.GetUserTimeSeries(c.Context(), int64(uid), q)
+		if errors.Is(err, service.ErrInvalidTimeSeriesQuery) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		} else if err != nil {
+			h.logger.Printf("Failed to retrieve time series for user ID %d: %v", uid, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		h.logger.Printf("Successfully retrieved %d time series points for user ID: %d", len(series.Points), uid)
+		return c.JSON(series)
+	}
+}
+
+func parseTimeSeriesQuery(c *fiber.Ctx) (models.TimeSeriesQuery, error) {
+	q := models.TimeSeriesQuery{Granularity: c.Query("granularity")}
+	var err error
+	if q.From, err = export.ParseTime(c.Query("from")); err != nil {
+		return q, errors.New("invalid from")
+	}
+	if q.To, err = export.ParseTime(c.Query("to")); err != nil {
+		return q, errors.New("invalid to")
+	}
+	return q, nil
+}
+
+// getProductFunnel godoc
+// @Summary      Get product conversion funnel
+// @Description  Retrieve the views, likes and purchases of a product with the view → like → purchase conversion rates.
+// @Tags         analytics :8083
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "Product ID"
+// @Param Authorization header string true "Bearer {token}"
+// @Security     BearerAuth
+// @Success      200  {object}  models.Funnel
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      500  {object}  map[string]interface{}
+// @Router       /analytics/products/{id}/funnel [get]
+func (h *Handler) getProductFunnel() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		h.logger.Println("Processing request to get product funnel")
+		pid, err := strconv.Atoi(c.Params("id"))
+		if err != nil || pid <= 0 {
+			h.logger.Printf("Invalid product ID: %s", c.Params("id"))
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid product ID"})
+		}
+
+		funnel, err := h.service.GetProductFunnel(c.Context(), int64(pid))
+		if err != nil {
+			h.logger.Printf("Failed to retrieve funnel for product ID %d: %v", pid, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		h.logger.Printf("Successfully retrieved funnel for product ID: %d", pid)
+		return c.JSON(funnel)
+	}
+}
+
+// getCategoryFunnel godoc
+// @Summary      Get category conversion funnel
+// @Description  Retrieve the views, likes and purchases of all products of a category with the view → like → purchase conversion rates. The funnel sums the lifetime counters of the products currently in the category, so after a product changes category all of its history moves with it, while the category analytics keep counting each event under the category the product had at the time.
+// @Tags         analytics :8083
+// @Accept       json
+// @Produce      json
+// @Param        category  path      string  true  "Product category"
+// @Param Authorization header string true "Bearer {token}"
+// @Security     BearerAuth
+// @Success      200  {object}  models.Funnel
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      500  {object}  map[string]interface{}
+// @Router       /analytics/categories/{category}/funnel [get]
+func (h *Handler) getCategoryFunnel() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		h.logger.Println("Processing request to get category funnel")
+		category, err := url.PathUnescape(c.Params("category"))
+		if err != nil || category == "" {
+			h.logger.Printf("Invalid category: %s", c.Params("category"))
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid category"})
+		}
+
+		funnel, err := h.service.GetCategoryFunnel(c.Context(), category)
+		if err != nil {
+			h.logger.Printf("Failed to retrieve funnel for category %q: %v", category, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		h.logger.Printf("Successfully retrieved funnel for category: %q", category)
+		return c.JSON(funnel)
+	}
+}
+
+// getRevenue godoc
+// @Summary      Get daily revenue
+// @Description  Retrieve the purchases and revenue per day of one category or of all products, with the totals and the average order value of the range. Revenue uses the price of a product at the time it was bought.
+// @Tags         analytics :8083
+// @Accept       json
+// @Produce      json
+// @Param        category  query     string  false  "Product category (default: all)"
+// @Param        from      query     string  false  "Start of the range, RFC 3339 or YYYY-MM-DD (default: 30 days before to)"
+// @Param        to        query     string  false  "End of the range (exclusive), RFC 3339 or YYYY-MM-DD (default: now)"
+// @Param Authorization header string true "Bearer {token}"
+// @Security     BearerAuth
+// @Success      200  {object}  models.RevenueSeries
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      500  {object}  map[string]interface{}
+// @Router       /analytics/revenue [get]
+func (h *Handler) getRevenue() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		h.logger.Println("Processing request to get revenue")
+		q := models.RevenueQuery{Category: c.Query("category")}
+		var err error
+		if q.From, err = export.ParseTime(c.Query("from")); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid from"})
+		}
+		if q.To, err = export.ParseTime(c.Query("to")); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid to"})
+		}
+
+		series, err := h.service.GetRevenue(c.Context(), q)
+		if errors.Is(err, service.ErrInvalidTimeSeriesQuery) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		} else if err != nil {
+			h.logger.Printf("Failed to retrieve revenue: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		h.logger.Printf("Successfully retrieved %d revenue points", len(series.Points))
+		return c.JSON(series)
+	}
+}
+
+// getExport godoc
+// @Summary      Export analytics
+// @Description  Stream a dataset as CSV, NDJSON or Parquet: product_analytics, user_analytics, product_hourly, product_daily, user_hourly, user_daily or category_revenue_daily. Rows are read in key order in pages, so the export is never held in memory. With a limit only one chunk of rows is exported and the X-Next-Cursor header, when present, is the cursor of the next chunk. From and to bound the bucket of time-bucketed datasets and the last update of the others. The response is sent before the rows are read, so a complete export ends with the X-Export-Rows trailer and a failed one with X-Export-Error; clients must check them.
+// @Tags         analytics :8083
+// @Produce      text/csv
+// @Produce      application/x-ndjson
+// @Produce      application/vnd.apache.parquet
+// @Param        dataset     path      string  true   "Dataset to export"
+// @Param        format      query     string  false  "csv, ndjson or parquet (default csv)"
+// @Param        category    query     string  false  "Product category"
+// @Param        product_id  query     int     false  "Product ID"
+// @Param        user_id     query     int     false  "User ID"
+// @Param        from        query     string  false  "Start of the range, RFC 3339 or YYYY-MM-DD"
+// @Param        to          query     string  false  "End of the range (exclusive), RFC 3339 or YYYY-MM-DD"
+// @Param        cursor      query     string  false  "Cursor returned in X-Next-Cursor by the previous chunk"
+// @Param        limit       query     int     false  "Number of rows of the chunk (default: all remaining rows)"
+// @Param Authorization header string true "Bearer {token}"
+// @Security     BearerAuth
+// @Success      200  {file}    file
+// @Header       200  {string}  X-Next-Cursor  "Cursor of the next chunk"
+// @Header       200  {integer} X-Export-Rows  "Trailer: number of rows exported, sent only when the export is complete"
+// @Header       200  {string}  X-Export-Error  "Trailer: why the export stopped part way"
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      500  {object}  map[string]interface{}
+// @Router       /analytics/export/{dataset} [get]
+func (h *Handler) getExport() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		h.logger.Printf("Processing request to export %s", c.Params("dataset"))
+		format := c.Query("format", export.FormatCSV)
+		if !export.ValidFormat(format) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid format"})
+		}
+
+		q := models.ExportQuery{Dataset: c.Params("dataset"), Category: c.Query("category"), Cursor: c.Query("cursor")}
+		var err error
+		if v := c.Query("product_id"); v != "" {
+			if q.ProductID, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid product_id"})
+			}
+		}
+		if v := c.Query("user_id"); v != "" {
+			if q.UserID, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid user_id"})
+			}
+		}
+		if q.From, err = export.ParseTime(c.Query("from")); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid from"})
+		}
+		if q.To, err = export.ParseTime(c.Query("to")); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid to"})
+		}
+		if q.Limit, err = strconv.Atoi(c.Query("limit", "0")); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid limit"})
+		}
+
+		plan, err := h.service.PlanExport(c.Context(), q)
+		if errors.Is(err, service.ErrInvalidExport) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		} else if err != nil {
+			h.logger.Printf("Failed to plan export: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		c.Set(fiber.HeaderContentType, export.ContentType(format))
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.%s"`, q.Dataset, format))
+		if plan.NextCursor != "" {
+			c.Set("X-Next-Cursor", plan.NextCursor)
+		}
+
+		// The status is sent before the first row, so the outcome of the
+		// export is reported in trailers: X-Export-Rows once it is complete,
+		// X-Export-Error when it failed part way.
+		header := &c.Response().Header
+		if err := header.SetTrailer("X-Export-Rows, X-Export-Error"); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		c.Context().SetBodyStreamWriter(func(bw *bufio.Writer) {
+			// The request context is gone once the handler returns, so the
+			// export owns its own and stops reading as soon as a write fails.
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			w, err := export.NewWriter(format, bw, plan.Columns)
+			if err != nil {
+				h.logger.Printf("Failed to start export: %v", err)
+				header.Set("X-Export-Error", trailerValue(err))
+				return
+			}
+			rows, err := h.service.Export(ctx, plan, w)
+			if err == nil {
+				err = w.Close()
+			}
+			if err != nil {
+				cancel()
+				h.logger.Printf("Export of %s failed after %d rows: %v", q.Dataset, rows, err)
+				header.Set("X-Export-Error", trailerValue(err))
+				return
+			}
+			header.Set("X-Export-Rows", strconv.FormatInt(rows, 10))
+			h.logger.Printf("Successfully exported %d rows of %s", rows, q.Dataset)
+		})
+		return nil
+	}
+}
+
+// trailerValue keeps an error message on one header line.
+func trailerValue(err error) string {
+	return strings.Join(strings.Fields(err.Error()), " ")
+}
+
+// reconcile godoc
+// @Summary      Reconcile analytics counters
+// @Description  Compare the lifetime counters of products and users with the likes, dislikes and purchases tables, which also reflect removed likes and dislikes, and report the discrepancies. With repair=true the counters that differ are overwritten. Products and users with activity in the last analytics.reconcile.settle are skipped. Repair assumes that older events have been applied, so it must only run while the analytics consumers and the outbox relay are caught up. Requires the X-Admin-Token header to match analytics.admin_token.
+// @Tags         analytics :8083
+// @Accept       json
+// @Produce      json
+// @Param        repair  query     bool  false  "Overwrite the counters that differ (default false)"
+// @Param Authorization header string true "Bearer {token}"
+// @Param X-Admin-Token header string true "Admin token (analytics.admin_token)"
+// @Security     BearerAuth
+// @Success      200  {object}  models.ReconcileReport
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      500  {object}  map[string]interface{}
+// @Failure      403  {object}  map[string]interface{}
+// @Router       /analytics/reconcile [post]
+func (h *Handler) reconcile() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		h.logger.Println("Processing request to reconcile analytics counters")
+		repair, err := strconv.ParseBool(c.Query("repair", "false"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid repair"})
+		}
+
+		report, err := h.service.Reconcile(c.Context(), repair)
+		if err != nil {
+			h.logger.Printf("Failed to reconcile analytics counters: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		h.logger.Printf("Successfully reconciled analytics counters: %d product and %d user discrepancies",
+			report.ProductDiscrepancies, report.UserDiscrepancies)
+		return c.JSON(report)
+	}
+}
+
+// getCohortRetention godoc
+// @Summary      Get cohort retention
+// @Description  Group users by registration week (Monday to Sunday, UTC) and return, for each cohort, how many of its users interacted (viewed, liked, disliked or bought a product) in each week since registration, starting with the registration week, and their share. A cohort's rows end with the current week.
+// @Tags         analytics :8083
+// @Accept       json
+// @Produce      json
+// @Param        from   query     string  false  "First registration week, RFC 3339 or YYYY-MM-DD (default: 12 weeks before to)"
+// @Param        to     query     string  false  "End of the registration weeks (exclusive, rounded up to a week), RFC 3339 or YYYY-MM-DD (default: now)"
+// @Param        weeks  query     int     false  "Weeks of retention per cohort (1-104, default 12)"
+// @Param Authorization header string true "Bearer {token}"
+// @Security     BearerAuth
+// @Success      200  {object}  models.CohortMatrix
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      500  {object}  map[string]interface{}
+// @Router       /analytics/cohorts [get]
+func (h *Handler) getCohortRetention() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		h.logger.Println("Processing request to get cohort retention")
+		var (
+			q   models.CohortQuery
+			err error
+		)
+		if q.From, err = export.ParseTime(c.Query("from")); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid from"})
+		}
+		if q.To, err = export.ParseTime(c.Query("to")); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid to"})
+		}
+		if q.Weeks, err = strconv.Atoi(c.Query("weeks", "0")); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid weeks"})
+		}
+
+		matrix, err := h.service.GetCohortRetention(c.Context(), q)
+		if errors.Is(err, service.ErrInvalidCohortQuery) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		} else if err != nil {
+			h.logger.Printf("Failed to retrieve cohort retention: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		h.logger.Printf("Successfully retrieved %d cohorts", len(matrix.Cohorts))
+		return c.JSON(matrix)
+	}
+}
+
+// getTrendingProducts godoc
+// @Summary      Get trending products
+// @Description  Retrieve products whose like and purchase velocity in the recent window is highest compared with their baseline rate.
+// @Tags         analytics :8083
+// @Accept       json
+// @Produce      json
+// @Param        category  query     string  false  "Product category"
+// @Param        limit     query     int     false  "Maximum number of products (1-100, default 20)"
+// @Param Authorization header string true "Bearer {token}"
+// @Security     BearerAuth
+// @Success      200  {array}   models.TrendingProduct
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      500  {object}  map[string]interface{}
+// @Router       /analytics/trending [get]
+func (h *Handler) getTrendingProducts() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		h.logger.Println("Processing request to get trending products")
+		limit, err := strconv.Atoi(c.Query("limit", "20"))
+		if err != nil || limit < 1 || limit > 100 {
+			h.logger.Printf("Invalid limit: %s", c.Query("limit"))
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid limit"})
+		}
+
+		category := c.Query("category")
+		trending, err := h.service.GetTrendingProducts(c.Context(), category, limit)
+		if err != nil {
+			h.logger.Printf("Failed to retrieve trending products: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		h.logger.Printf("Successfully retrieved %d trending products", len(trending))
+		return c.JSON(trending)
+	}
+}
+
+// getProductLeaderboard godoc
+// @Summary      Get product leaderboard
+// @Description  Retrieve the top products by likes, dislikes, purchases or rating. The rating board orders products by the lower bound of the Wilson score interval of their like/dislike ratio.
+// @Tags         analytics :8083
+// @Accept       json
+// @Produce      json
+// @Param        board     path      string  true   "likes, dislikes, purchases or rating"
+// @Param        category  query     string  false  "Product category"
+// @Param        window    query     string  false  "1d, 7d, 30d or all (default 7d)"
+// @Param        limit     query     int     false  "Maximum number of products (1-100, default 10)"
+// @Param Authorization header string true "Bearer {token}"
+// @Security     BearerAuth
+// @Success      200  {array}   models.LeaderboardEntry
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      500  {object}  map[string]interface{}
+// @Router       /analytics/leaderboards/products/{board} [get]
+func (h *Handler) getProductLeaderboard() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		h.logger.Println("Processing request to get product leaderboard")
+		q, err := parseLeaderboardQuery(c)
+		if err != nil {
+			h.logger.Printf("Invalid leaderboard query: %v", err)
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		q.Board = c.Params("board")
+
+		entries, err := h.service.GetProductLeaderboard(c.Context(), q)
+		if errors.Is(err, service.ErrInvalidLeaderboardQuery) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		} else if err != nil {
+			h.logger.Printf("Failed to retrieve product leaderboard: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		h.logger.Printf("Successfully retrieved %d leaderboard entries", len(entries))
+		return c.JSON(entries)
+	}
+}
+
+// getUserLeaderboard godoc
+// @Summary      Get most active users
+// @Description  Retrieve the users with the most likes, dislikes and purchases, optionally counting only products of one category.
+// @Tags         analytics :8083
+// @Accept       json
+// @Produce      json
+// @Param        category  query     string  false  "Product category"
+// @Param        window    query     string  false  "1d, 7d, 30d or all (default 7d)"
+// @Param        limit     query     int     false  "Maximum number of users (1-100, default 10)"
+// @Param Authorization header string true "Bearer {token}"
+// @Security     BearerAuth
+// @Success      200  {array}   models.LeaderboardEntry
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      500  {object}  map[string]interface{}
+// @Router       /analytics/leaderboards/users [get]
+func (h *Handler) getUserLeaderboard() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		h.logger.Println("Processing request to get user leaderboard")
+		q, err := parseLeaderboardQuery(c)
+		if err != nil {
+			h.logger.Printf("Invalid leaderboard query: %v", err)
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		q.Board = models.BoardActiveUsers
+
+		entries, err := h.service.GetUserLeaderboard(c.Context(), q)
+		if errors.Is(err, service.ErrInvalidLeaderboardQuery) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		} else if err != nil {
+			h.logger.Printf("Failed to retrieve user leaderboard: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		h.logger.Printf("Successfully retrieved %d leaderboard entries", len(entries))
+		return c.JSON(entries)
+	}
+}
+
+func parseLeaderboardQuery(c *fiber.Ctx) (models.LeaderboardQuery, error) {
+	q := models.LeaderboardQuery{
+		Category: c.Query("category"),
+		Window:   c.Query("window"),
+	}
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			return q, errors.New("invalid limit")
+		}
+		q.Limit = n
+	}
+	return q, nil
+}
+
+// getEventSchemas godoc
+// @Summary      List event schemas
+// @Description  Retrieve the JSON Schemas of the payloads of all events published to Kafka, keyed by event type.
+// @Tags         events :8083
+// @Produce      json
+// @Param Authorization header string true "Bearer {token}"
+// @Security     BearerAuth
+// @Success      200  {object}  map[string]interface{}
+// @Router       /events/schemas [get]
+func (h *Handler) getEventSchemas() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		h.logger.Println("Processing request to list event schemas")
+		schemas := make(map[string]json.RawMessage)
+		for _, eventType := range events.SchemaTypes() {
+			schemas[eventType], _ = events.Schema(eventType)
+		}
+		return c.JSON(schemas)
+	}
+}
+
+// getEventSchema godoc
+// @Summary      Get event schema
+// @Description  Retrieve the JSON Schema of the payload of one event type.
+// @Tags         events :8083
+// @Produce      json
+// @Param        type  path      string  true  "Event type, e.g. user_liked"
+// @Param Authorization header string true "Bearer {token}"
+// @Security     BearerAuth
+// @Success      200  {object}  map[string]interface{}
+// @Failure      404  {object}  map[string]interface{}
+// @Router       /events/schemas/{type} [get]
+func (h *Handler) getEventSchema() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		eventType := c.Params("type")
+		h.logger.Printf("Processing request to get schema of event type %s", eventType)
+		schema, ok := events.Schema(eventType)
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Unknown event type"})
+		}
+		c.Set(fiber.HeaderContentType, "application/schema+json")
+		return c.Send(schema)
+	}
+}
@@ -1,21 +1,391 @@
 package models
 
-import "time"
+import (
+    "time"
+
+    "recommendation-system/pkg/export"
+)
 
 type ProductAnalytics struct {
-    ID        int64     `db:"id" json:"-"`
+    ID            int64          `db:"id" json:"-"`
+    ProductID     int64          `db:"product_id" json:"product_id"`
+    Likes         int            `db:"likes" json:"likes"`
+    Dislikes      int            `db:"dislikes" json:"dislikes"`
+    Purchases     int            `db:"purchases" json:"purchases"`
+    Revenue       float64        `db:"revenue" json:"revenue"`
+    DistinctUsers *DistinctUsers `db:"-" json:"distinct_users,omitempty"`
+    UpdatedAt     time.Time      `db:"updated_at" json:"updated_at"`
+}
+
+// DistinctUsers are approximate numbers of distinct users who liked or bought
+// a product in the current UTC day and in the last 7 days, today included.
+type DistinctUsers struct {
+    LikedDay      int64 `json:"liked_day"`
+    LikedWeek     int64 `json:"liked_week"`
+    PurchasedDay  int64 `json:"purchased_day"`
+    PurchasedWeek int64 `json:"purchased_week"`
+}
+
+// UserAnalytics holds the lifetime value of the user, the revenue of all their
+// purchases, and its mean per purchase.
+type UserAnalytics struct {
+    ID                int64     `db:"id" json:"-"`
+    UserID            int64     `db:"user_id" json:"user_id"`
+    TotalLikes        int       `db:"total_likes" json:"total_likes"`
+    TotalDislikes     int       `db:"total_dislikes" json:"total_dislikes"`
+    TotalPurchases    int       `db:"total_purchases" json:"total_purchases"`
+    LifetimeValue     float64   `db:"total_revenue" json:"lifetime_value"`
+    AverageOrderValue float64   `db:"-" json:"average_order_value"`
+    UpdatedAt         time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type TrendingProduct struct {
+    ProductID         int64   `db:"product_id" json:"product_id"`
+    Category          string  `db:"category" json:"category"`
+    WindowLikes       int     `db:"window_likes" json:"window_likes"`
+    WindowPurchases   int     `db:"window_purchases" json:"window_purchases"`
+    BaselineLikes     int     `db:"baseline_likes" json:"baseline_likes"`
+    BaselinePurchases int     `db:"baseline_purchases" json:"baseline_purchases"`
+    Velocity          float64 `db:"velocity" json:"velocity"`
+}
+
+type Counts struct {
+    Views     int
+    Likes     int
+    Dislikes  int
+    Purchases int
+    Revenue   float64
+}
+
+// BucketKey identifies the counters of a product or user in one time bucket.
+type BucketKey struct {
+    ID          int64
+    BucketStart time.Time
+}
+
+// CategoryBucketKey identifies the counters of a category in one time bucket.
+type CategoryBucketKey struct {
+    Category    string
+    BucketStart time.Time
+}
+
+type CategoryUserKey struct {
+    Category string
+    UserID   int64
+}
+
+// AnalyticsIncrements accumulates the counter changes of a batch of events so
+// that they can be applied with one statement per row.
+type AnalyticsIncrements struct {
+    Products      map[int64]*Counts
+    Users         map[int64]*Counts
+    Activity      map[BucketKey]*Counts
+    ProductHours  map[BucketKey]*Counts
+    UserHours     map[BucketKey]*Counts
+    CategoryDays  map[CategoryBucketKey]*Counts
+    Categories    map[string]*Counts
+    // CategoryUsers holds the last interaction of each user per category.
+    CategoryUsers map[CategoryUserKey]time.Time
+    // UserWeeks holds the weeks in which each user interacted.
+    UserWeeks     map[BucketKey]bool
+}
+
+func NewAnalyticsIncrements() *AnalyticsIncrements {
+    return &AnalyticsIncrements{
+        Products:      make(map[int64]*Counts),
+        Users:         make(map[int64]*Counts),
+        Activity:      make(map[BucketKey]*Counts),
+        ProductHours:  make(map[BucketKey]*Counts),
+        UserHours:     make(map[BucketKey]*Counts),
+        CategoryDays:  make(map[CategoryBucketKey]*Counts),
+        Categories:    make(map[string]*Counts),
+        CategoryUsers: make(map[CategoryUserKey]time.Time),
+        UserWeeks:     make(map[BucketKey]bool),
+    }
+}
+
+func (a *AnalyticsIncrements) Product(productID int64) *Counts {
+    if a.Products[productID] == nil {
+        a.Products[productID] = &Counts{}
+    }
+    return a.Products[productID]
+}
+
+func (a *AnalyticsIncrements) User(userID int64) *Counts {
+    if a.Users[userID] == nil {
+        a.Users[userID] = &Counts{}
+    }
+    return a.Users[userID]
+}
+
+func (a *AnalyticsIncrements) ProductActivity(productID int64, bucketStart time.Time) *Counts {
+    return bucket(a.Activity, productID, bucketStart)
+}
+
+func (a *AnalyticsIncrements) ProductHour(productID int64, bucketStart time.Time) *Counts {
+    return bucket(a.ProductHours, productID, bucketStart)
+}
+
+func (a *AnalyticsIncrements) UserHour(userID int64, bucketStart time.Time) *Counts {
+    return bucket(a.UserHours, userID, bucketStart)
+}
+
+func (a *AnalyticsIncrements) CategoryDay(category string, bucketStart time.Time) *Counts {
+    key := CategoryBucketKey{Category: category, BucketStart: bucketStart}
+    if a.CategoryDays[key] == nil {
+        a.CategoryDays[key] = &Counts{}
+    }
+    return a.CategoryDays[key]
+}
+
+func (a *AnalyticsIncrements) Category(category string) *Counts {
+    if a.Categories[category] == nil {
+        a.Categories[category] = &Counts{}
+    }
+    return a.Categories[category]
+}
+
+func (a *AnalyticsIncrements) CategoryUser(category string, userID int64, at time.Time) {
+    key := CategoryUserKey{Category: category, UserID: userID}
+    if at.After(a.CategoryUsers[key]) {
+        a.CategoryUsers[key] = at
+    }
+}
+
+func (a *AnalyticsIncrements) UserWeek(userID int64, weekStart time.Time) {
+    a.UserWeeks[BucketKey{ID: userID, BucketStart: weekStart}] = true
+}
+
+func bucket(m map[BucketKey]*Counts, id int64, bucketStart time.Time) *Counts {
+    key := BucketKey{ID: id, BucketStart: bucketStart}
+    if m[key] == nil {
+        m[key] = &Counts{}
+    }
+    return m[key]
+}
+
+func (a *AnalyticsIncrements) Empty() bool {
+    return len(a.Products) == 0 && len(a.Users) == 0 && len(a.Activity) == 0 &&
+        len(a.ProductHours) == 0 && len(a.UserHours) == 0 && len(a.CategoryDays) == 0 &&
+        len(a.Categories) == 0 && len(a.CategoryUsers) == 0 && len(a.UserWeeks) == 0
+}
+
+const (
+    GranularityHour = "hour"
+    GranularityDay  = "day"
+)
+
+type TimeSeriesQuery struct {
+    Granularity string
+    From        time.Time
+    To          time.Time
+}
+
+type TimeSeriesPoint struct {
+    BucketStart time.Time `json:"bucket_start"`
+    Likes       int       `json:"likes"`
+    Dislikes    int       `json:"dislikes"`
+    Purchases   int       `json:"purchases"`
+    Revenue     float64   `json:"revenue"`
+}
+
+type TimeSeries struct {
+    ProductID   int64              `json:"product_id,omitempty"`
+    UserID      int64              `json:"user_id,omitempty"`
+    Granularity string             `json:"granularity"`
+    From        time.Time          `json:"from"`
+    To          time.Time          `json:"to"`
+    Points      []*TimeSeriesPoint `json:"points"`
+}
+
+const (
+    BoardLikes       = "likes"
+    BoardDislikes    = "dislikes"
+    BoardPurchases   = "purchases"
+    BoardRating      = "rating"
+    BoardActiveUsers = "active"
+)
+
+type LeaderboardQuery struct {
+    Board    string
+    Category string
+    Window   string
+    Limit    int
+}
+
+type LeaderboardEntry struct {
+    Rank      int     `json:"rank"`
+    ProductID int64   `json:"product_id,omitempty"`
+    UserID    int64   `json:"user_id,omitempty"`
+    Score     float64 `json:"score"`
+    Likes     int     `json:"likes,omitempty"`
+    Dislikes  int     `json:"dislikes,omitempty"`
+}
+
+// Funnel is the view → like → purchase conversion of a product or of all
+// products of a category. The rates divide event counts, not users: a product
+// bought more often than liked, or bought without being viewed through the
+// API, has a LikeToPurchase or ViewToPurchase above 1. A rate is zero when
+// its denominator is.
+type Funnel struct {
+    ProductID      int64   `json:"product_id,omitempty"`
+    Category       string  `json:"category,omitempty"`
+    Views          int     `json:"views"`
+    Likes          int     `json:"likes"`
+    Purchases      int     `json:"purchases"`
+    ViewToLike     float64 `json:"view_to_like"`
+    LikeToPurchase float64 `json:"like_to_purchase"`
+    ViewToPurchase float64 `json:"view_to_purchase"`
+}
+
+// RevenueQuery selects the daily revenue of one category, or of all products
+// when Category is empty.
+type RevenueQuery struct {
+    Category string
+    From     time.Time
+    To       time.Time
+}
+
+type RevenuePoint struct {
+    BucketStart time.Time `json:"bucket_start"`
+    Purchases   int       `json:"purchases"`
+    Revenue     float64   `json:"revenue"`
+}
+
+type RevenueSeries struct {
+    Category          string          `json:"category,omitempty"`
+    From              time.Time       `json:"from"`
+    To                time.Time       `json:"to"`
+    Purchases         int             `json:"purchases"`
+    Revenue           float64         `json:"revenue"`
+    AverageOrderValue float64         `json:"average_order_value"`
+    Points            []*RevenuePoint `json:"points"`
+}
+
+// ProductCategory is the category of a product as of UpdatedAt.
+type ProductCategory struct {
     ProductID int64     `db:"product_id" json:"product_id"`
-    Likes     int       `db:"likes" json:"likes"`
-    Dislikes  int       `db:"dislikes" json:"dislikes"`
-    Purchases int       `db:"purchases" json:"purchases"`
+    Category  string    `db:"category" json:"category"`
     UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
 }
 
-type UserAnalytics struct {
-    ID             int64     `db:"id" json:"-"`
-    UserID         int64     `db:"user_id" json:"user_id"`
-    TotalLikes     int       `db:"total_likes" json:"total_likes"`
-    TotalDislikes  int       `db:"total_dislikes" json:"total_dislikes"`
-    TotalPurchases int       `db:"total_purchases" json:"total_purchases"`
-    UpdatedAt      time.Time `db:"updated_at" json:"updated_at"`
+// CategoryAnalytics counts the interactions with the products of a category.
+// TotalUsers is the number of distinct users who ever liked, disliked or
+// bought one of them and ActiveUsers those who did in the active window.
+type CategoryAnalytics struct {
+    Category    string    `db:"category" json:"category"`
+    Likes       int       `db:"likes" json:"likes"`
+    Dislikes    int       `db:"dislikes" json:"dislikes"`
+    Purchases   int       `db:"purchases" json:"purchases"`
+    TotalUsers  int       `db:"total_users" json:"total_users"`
+    ActiveUsers int       `db:"active_users" json:"active_users"`
+    UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// Export datasets.
+const (
+    ExportProductAnalytics = "product_analytics"
+    ExportUserAnalytics    = "user_analytics"
+    ExportProductHourly    = "product_hourly"
+    ExportProductDaily     = "product_daily"
+    ExportUserHourly       = "user_hourly"
+    ExportUserDaily        = "user_daily"
+    ExportCategoryRevenue  = "category_revenue_daily"
+)
+
+// ExportQuery filters the rows of an export dataset. From and To bound the
+// bucket of time-bucketed datasets and the last update of the others. A
+// non-zero Limit exports one chunk of rows after Cursor.
+type ExportQuery struct {
+    Dataset   string
+    Category  string
+    ProductID int64
+    UserID    int64
+    From      time.Time
+    To        time.Time
+    Cursor    string
+    Limit     int
+}
+
+// ExportPlan is a validated export of the rows whose key is after After and,
+// when Until is set, not after Until. Empty is set when a limited chunk found
+// no rows, so none are exported. NextCursor resumes the export after the
+// chunk, or is empty when it is the last one.
+type ExportPlan struct {
+    Query      ExportQuery
+    Columns    []export.Column
+    Key        []int
+    After      []interface{}
+    Until      []interface{}
+    Empty      bool
+    NextCursor string
+}
+
+// CounterValues are the lifetime counters of a product or user.
+type CounterValues struct {
+    Likes     int     `json:"likes"`
+    Dislikes  int     `json:"dislikes"`
+    Purchases int     `json:"purchases"`
+    Revenue   float64 `json:"revenue"`
+}
+
+// CounterDiscrepancy is a product or user whose counters differ from the ones
+// computed from the likes, dislikes and purchases tables.
+type CounterDiscrepancy struct {
+    ID       int64         `json:"id"`
+    Expected CounterValues `json:"expected"`
+    Actual   CounterValues `json:"actual"`
+}
+
+// ReconcileReport counts the discrepancies found by a reconciliation and lists
+// the first of them.
+type ReconcileReport struct {
+    Repair               bool                  `json:"repair"`
+    StartedAt            time.Time             `json:"started_at"`
+    FinishedAt           time.Time             `json:"finished_at"`
+    ProductDiscrepancies int                   `json:"product_discrepancies"`
+    UserDiscrepancies    int                   `json:"user_discrepancies"`
+    ProductsRepaired     int64                 `json:"products_repaired"`
+    UsersRepaired        int64                 `json:"users_repaired"`
+    Products             []*CounterDiscrepancy `json:"products"`
+    Users                []*CounterDiscrepancy `json:"users"`
+}
+
+// UserCohort is the registration of a user, from a user_created event.
+type UserCohort struct {
+    UserID       int64
+    RegisteredAt time.Time
+}
+
+// CohortQuery selects the cohorts of the registration weeks in [From, To) and
+// the number of weeks of retention to compute for each.
+type CohortQuery struct {
+    From  time.Time
+    To    time.Time
+    Weeks int
+}
+
+// Cohort holds the users who registered in a week and, for each week since,
+// starting with the registration week itself, how many of them interacted in
+// it. Retained and Retention end with the current week.
+type Cohort struct {
+    Week      time.Time `json:"week"`
+    Users     int       `json:"users"`
+    Retained  []int     `json:"retained"`
+    Retention []float64 `json:"retention"`
+}
+
+type CohortMatrix struct {
+    From    time.Time `json:"from"`
+    To      time.Time `json:"to"`
+    Weeks   int       `json:"weeks"`
+    Cohorts []*Cohort `json:"cohorts"`
+}
+
+// CohortActivity is the number of users of a cohort active in the week Offset
+// weeks after the one they registered in.
+type CohortActivity struct {
+    Week   time.Time
+    Offset int
+    Users  int
 }
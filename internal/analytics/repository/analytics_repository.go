@@ -4,21 +4,49 @@ import (
 	"context"
 	"fmt"
 	log "recommendation-system/pkg/logger"
+	"sort"
+	"time"
 
 	"recommendation-system/internal/analytics/models"
 	"recommendation-system/pkg/db"
+	"recommendation-system/pkg/export"
+	"recommendation-system/pkg/trending"
+
+	"github.com/jackc/pgx/v4"
 )
 
 type AnalyticsRepository interface {
-	IncrementProductLikes(ctx context.Context, productID int64) error
-	IncrementProductDislikes(ctx context.Context, productID int64) error
-	IncrementProductPurchases(ctx context.Context, productID int64) error
-	GetProductAnalytics(ctx context.Context, productID int64) (*models.ProductAnalytics, error)
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
 
-	IncrementUserLikes(ctx context.Context, userID int64) error
-	IncrementUserDislikes(ctx context.Context, userID int64) error
-	IncrementUserPurchases(ctx context.Context, userID int64) error
+	GetProductAnalytics(ctx context.Context, productID int64) (*models.ProductAnalytics, error)
 	GetUserAnalytics(ctx context.Context, userID int64) (*models.UserAnalytics, error)
+	ApplyIncrements(ctx context.Context, inc *models.AnalyticsIncrements) error
+	GetTrendingProducts(ctx context.Context, q trending.Query) ([]*models.TrendingProduct, error)
+	GetProductCategories(ctx context.Context, productIDs []int64) (map[int64]string, error)
+	UpsertProductCategories(ctx context.Context, products []*models.ProductCategory) error
+	GetCategoryAnalytics(ctx context.Context, category string, activeSince time.Time) (*models.CategoryAnalytics, error)
+	ListCategoryAnalytics(ctx context.Context, activeSince time.Time) ([]*models.CategoryAnalytics, error)
+	UpsertUserCohorts(ctx context.Context, cohorts []*models.UserCohort) error
+	GetCohortSizes(ctx context.Context, from, to time.Time) (map[time.Time]int, error)
+	GetCohortActivity(ctx context.Context, from, to time.Time, weeks int) ([]*models.CohortActivity, error)
+	GetProductFunnel(ctx context.Context, productID int64) (*models.Funnel, error)
+	GetCategoryFunnel(ctx context.Context, category string) (*models.Funnel, error)
+	DeleteProductActivityBefore(ctx context.Context, before time.Time) (int64, error)
+
+	GetProductTimeSeries(ctx context.Context, productID int64, q models.TimeSeriesQuery) ([]*models.TimeSeriesPoint, error)
+	GetUserTimeSeries(ctx context.Context, userID int64, q models.TimeSeriesQuery) ([]*models.TimeSeriesPoint, error)
+	RollupHourly(ctx context.Context, before time.Time) (int64, error)
+	DeleteDailyBefore(ctx context.Context, before time.Time) (int64, error)
+	GetRevenue(ctx context.Context, q models.RevenueQuery) ([]*models.RevenuePoint, error)
+
+	ExportSchema(dataset string) ([]export.Column, []int, error)
+	ExportChunkEnd(ctx context.Context, q models.ExportQuery, after []interface{}, limit int) ([]interface{}, bool, error)
+	ExportRows(ctx context.Context, q models.ExportQuery, after, until []interface{}, limit int) ([][]interface{}, error)
+
+	FindProductDiscrepancies(ctx context.Context, settle time.Duration) ([]*models.CounterDiscrepancy, error)
+	FindUserDiscrepancies(ctx context.Context, settle time.Duration) ([]*models.CounterDiscrepancy, error)
+	RepairProductCounters(ctx context.Context, discrepancies []*models.CounterDiscrepancy, settle time.Duration) (int64, error)
+	RepairUserCounters(ctx context.Context, discrepancies []*models.CounterDiscrepancy, settle time.Duration) (int64, error)
 }
 
 type analyticsRepository struct {
@@ -30,142 +58,465 @@ func NewAnalyticsRepository(database *db.DB, logger *log.Logger) AnalyticsReposi
 	return &analyticsRepository{db: database, logger: logger}
 }
 
-func (r *analyticsRepository) IncrementProductLikes(ctx context.Context, productID int64) error {
-	r.logger.Printf("Incrementing likes for product ID: %d", productID)
+func (r *analyticsRepository) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return r.db.WithinTx(ctx, fn)
+}
+
+func (r *analyticsRepository) GetProductAnalytics(ctx context.Context, productID int64) (*models.ProductAnalytics, error) {
+	r.logger.Printf("Fetching analytics for product ID: %d", productID)
 	query := `
-        INSERT INTO product_analytics (product_id, likes)
-        VALUES ($1, 1)
-        ON CONFLICT (product_id)
-        DO UPDATE SET likes = product_analytics.likes + 1, updated_at = NOW()
+        SELECT id, product_id, likes, dislikes, purchases, revenue::float8, updated_at
+        FROM product_analytics
+        WHERE product_id = $1
     `
-	_, err := r.db.Pool.Exec(ctx, query, productID)
+	var pa models.ProductAnalytics
+	err := r.db.Conn(ctx).QueryRow(ctx, query, productID).Scan(
+		&pa.ID, &pa.ProductID, &pa.Likes, &pa.Dislikes, &pa.Purchases, &pa.Revenue, &pa.UpdatedAt,
+	)
 	if err != nil {
-		r.logger.Printf("Failed to increment product likes: %v", err)
-		return fmt.Errorf("failed to increment product likes: %w", err)
+		r.logger.Printf("Failed to fetch analytics for product ID: %d, error: %v", productID, err)
+		return nil, fmt.Errorf("failed to get product analytics: %w", err)
 	}
-	r.logger.Printf("Successfully incremented likes for product ID: %d", productID)
-	return nil
+	r.logger.Printf("Successfully fetched analytics for product ID: %d", productID)
+	return &pa, nil
 }
 
-func (r *analyticsRepository) IncrementProductDislikes(ctx context.Context, productID int64) error {
-	r.logger.Printf("Incrementing dislikes for product ID: %d", productID)
+func (r *analyticsRepository) GetUserAnalytics(ctx context.Context, userID int64) (*models.UserAnalytics, error) {
+	r.logger.Printf("Fetching analytics for user ID: %d", userID)
 	query := `
-        INSERT INTO product_analytics (product_id, dislikes)
-        VALUES ($1, 1)
-        ON CONFLICT (product_id)
-        DO UPDATE SET dislikes = product_analytics.dislikes + 1, updated_at = NOW()
+        SELECT id, user_id, total_likes, total_dislikes, total_purchases, total_revenue::float8, updated_at
+        FROM user_analytics
+        WHERE user_id = $1
     `
-	_, err := r.db.Pool.Exec(ctx, query, productID)
+	var ua models.UserAnalytics
+	err := r.db.Conn(ctx).QueryRow(ctx, query, userID).Scan(
+		&ua.ID, &ua.UserID, &ua.TotalLikes, &ua.TotalDislikes, &ua.TotalPurchases, &ua.LifetimeValue, &ua.UpdatedAt,
+	)
 	if err != nil {
-		r.logger.Printf("Failed to increment product dislikes: %v", err)
-		return fmt.Errorf("failed to increment product dislikes: %w", err)
+		r.logger.Printf("Failed to fetch analytics for user ID: %d, error: %v", userID, err)
+		return nil, fmt.Errorf("failed to get user analytics: %w", err)
 	}
-	r.logger.Printf("Successfully incremented dislikes for product ID: %d", productID)
-	return nil
+	r.logger.Printf("Successfully fetched analytics for user ID: %d", userID)
+	return &ua, nil
 }
 
-func (r *analyticsRepository) IncrementProductPurchases(ctx context.Context, productID int64) error {
-	r.logger.Printf("Incrementing purchases for product ID: %d", productID)
-	query := `
-        INSERT INTO product_analytics (product_id, purchases)
-        VALUES ($1, 1)
+// ApplyIncrements adds the accumulated counters in a single round-trip. Rows
+// are written in key order so that concurrent batches lock them in the same
+// order and cannot deadlock each other.
+func (r *analyticsRepository) ApplyIncrements(ctx context.Context, inc *models.AnalyticsIncrements) error {
+	r.logger.Printf("Applying increments for %d products, %d users and %d activity buckets", len(inc.Products), len(inc.Users), len(inc.Activity))
+
+	batch := &pgx.Batch{}
+	for _, productID := range sortedIDs(inc.Products) {
+		c := inc.Products[productID]
+		if c.Likes == 0 && c.Dislikes == 0 && c.Purchases == 0 {
+			continue
+		}
+		batch.Queue(`
+        INSERT INTO product_analytics (product_id, likes, dislikes, purchases, revenue)
+        VALUES ($1, $2, $3, $4, $5)
         ON CONFLICT (product_id)
-        DO UPDATE SET purchases = product_analytics.purchases + 1, updated_at = NOW()
-    `
-	_, err := r.db.Pool.Exec(ctx, query, productID)
-	if err != nil {
-		r.logger.Printf("Failed to increment product purchases: %v", err)
-		return fmt.Errorf("failed to increment product purchases: %w", err)
+        DO UPDATE SET likes = product_analytics.likes + EXCLUDED.likes,
+                      dislikes = product_analytics.dislikes + EXCLUDED.dislikes,
+                      purchases = product_analytics.purchases + EXCLUDED.purchases,
+                      revenue = product_analytics.revenue + EXCLUDED.revenue,
+                      updated_at = NOW()
+    `, productID, c.Likes, c.Dislikes, c.Purchases, c.Revenue)
+	}
+	for _, productID := range sortedIDs(inc.Products) {
+		c := inc.Products[productID]
+		if c.Views == 0 && c.Purchases == 0 {
+			continue
+		}
+		batch.Queue(`
+        INSERT INTO statistics (product_id, views, purchases)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (product_id)
+        DO UPDATE SET views = statistics.views + EXCLUDED.views,
+                      purchases = statistics.purchases + EXCLUDED.purchases,
+                      updated_at = NOW()
+    `, productID, c.Views, c.Purchases)
+	}
+	for _, userID := range sortedIDs(inc.Users) {
+		c := inc.Users[userID]
+		batch.Queue(`
+        INSERT INTO user_analytics (user_id, total_likes, total_dislikes, total_purchases, total_revenue)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT (user_id)
+        DO UPDATE SET total_likes = user_analytics.total_likes + EXCLUDED.total_likes,
+                      total_dislikes = user_analytics.total_dislikes + EXCLUDED.total_dislikes,
+                      total_purchases = user_analytics.total_purchases + EXCLUDED.total_purchases,
+                      total_revenue = user_analytics.total_revenue + EXCLUDED.total_revenue,
+                      updated_at = NOW()
+    `, userID, c.Likes, c.Dislikes, c.Purchases, c.Revenue)
+	}
+
+	for _, key := range sortedBuckets(inc.Activity) {
+		c := inc.Activity[key]
+		if c.Likes == 0 && c.Purchases == 0 {
+			continue
+		}
+		batch.Queue(`
+        INSERT INTO product_activity (product_id, bucket_start, likes, purchases)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (product_id, bucket_start)
+        DO UPDATE SET likes = product_activity.likes + EXCLUDED.likes,
+                      purchases = product_activity.purchases + EXCLUDED.purchases
+    `, key.ID, key.BucketStart, c.Likes, c.Purchases)
+	}
+	for _, key := range sortedBuckets(inc.ProductHours) {
+		c := inc.ProductHours[key]
+		batch.Queue(`
+        INSERT INTO product_analytics_hourly (product_id, bucket_start, likes, dislikes, purchases, revenue)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        ON CONFLICT (product_id, bucket_start)
+        DO UPDATE SET likes = product_analytics_hourly.likes + EXCLUDED.likes,
+                      dislikes = product_analytics_hourly.dislikes + EXCLUDED.dislikes,
+                      purchases = product_analytics_hourly.purchases + EXCLUDED.purchases,
+                      revenue = product_analytics_hourly.revenue + EXCLUDED.revenue
+    `, key.ID, key.BucketStart, c.Likes, c.Dislikes, c.Purchases, c.Revenue)
+	}
+	for _, key := range sortedBuckets(inc.UserHours) {
+		c := inc.UserHours[key]
+		batch.Queue(`
+        INSERT INTO user_analytics_hourly (user_id, bucket_start, likes, dislikes, purchases, revenue)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        ON CONFLICT (user_id, bucket_start)
+        DO UPDATE SET likes = user_analytics_hourly.likes + EXCLUDED.likes,
+                      dislikes = user_analytics_hourly.dislikes + EXCLUDED.dislikes,
+                      purchases = user_analytics_hourly.purchases + EXCLUDED.purchases,
+                      revenue = user_analytics_hourly.revenue + EXCLUDED.revenue
+    `, key.ID, key.BucketStart, c.Likes, c.Dislikes, c.Purchases, c.Revenue)
+	}
+	for _, key := range sortedCategoryBuckets(inc.CategoryDays) {
+		c := inc.CategoryDays[key]
+		batch.Queue(`
+        INSERT INTO category_revenue_daily (category, bucket_start, purchases, revenue)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (category, bucket_start)
+        DO UPDATE SET purchases = category_revenue_daily.purchases + EXCLUDED.purchases,
+                      revenue = category_revenue_daily.revenue + EXCLUDED.revenue
+    `, key.Category, key.BucketStart, c.Purchases, c.Revenue)
+	}
+	for _, category := range sortedCategories(inc.Categories) {
+		c := inc.Categories[category]
+		batch.Queue(`
+        INSERT INTO category_analytics (category, likes, dislikes, purchases)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (category)
+        DO UPDATE SET likes = category_analytics.likes + EXCLUDED.likes,
+                      dislikes = category_analytics.dislikes + EXCLUDED.dislikes,
+                      purchases = category_analytics.purchases + EXCLUDED.purchases,
+                      updated_at = NOW()
+    `, category, c.Likes, c.Dislikes, c.Purchases)
 	}
-	r.logger.Printf("Successfully incremented purchases for product ID: %d", productID)
+	for _, key := range sortedCategoryUsers(inc.CategoryUsers) {
+		batch.Queue(`
+        INSERT INTO category_users (category, user_id, last_active_at)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (category, user_id)
+        DO UPDATE SET last_active_at = GREATEST(category_users.last_active_at, EXCLUDED.last_active_at)
+    `, key.Category, key.UserID, inc.CategoryUsers[key])
+	}
+	for _, key := range sortedUserWeeks(inc.UserWeeks) {
+		batch.Queue(`
+        INSERT INTO user_activity_weeks (user_id, week)
+        VALUES ($1, $2)
+        ON CONFLICT (user_id, week) DO NOTHING
+    `, key.ID, key.BucketStart)
+	}
+
+	if batch.Len() == 0 {
+		return nil
+	}
+
+	results := r.db.Conn(ctx).SendBatch(ctx, batch)
+	for i := 0; i < batch.Len(); i++ {
+		if _, err := results.Exec(); err != nil {
+			results.Close()
+			r.logger.Printf("Failed to apply analytics increments: %v", err)
+			return fmt.Errorf("failed to apply analytics increments: %w", err)
+		}
+	}
+	if err := results.Close(); err != nil {
+		r.logger.Printf("Failed to apply analytics increments: %v", err)
+		return fmt.Errorf("failed to apply analytics increments: %w", err)
+	}
+	r.logger.Printf("Successfully applied %d analytics upserts", batch.Len())
 	return nil
 }
 
-func (r *analyticsRepository) GetProductAnalytics(ctx context.Context, productID int64) (*models.ProductAnalytics, error) {
-	r.logger.Printf("Fetching analytics for product ID: %d", productID)
-	query := `
-        SELECT id, product_id, likes, dislikes, purchases, updated_at
-        FROM product_analytics
-        WHERE product_id = $1
-    `
-	var pa models.ProductAnalytics
-	err := r.db.Pool.QueryRow(ctx, query, productID).Scan(
-		&pa.ID, &pa.ProductID, &pa.Likes, &pa.Dislikes, &pa.Purchases, &pa.UpdatedAt,
-	)
+func sortedIDs(m map[int64]*models.Counts) []int64 {
+	ids := make([]int64, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func sortedBuckets(m map[models.BucketKey]*models.Counts) []models.BucketKey {
+	keys := make([]models.BucketKey, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].ID != keys[j].ID {
+			return keys[i].ID < keys[j].ID
+		}
+		return keys[i].BucketStart.Before(keys[j].BucketStart)
+	})
+	return keys
+}
+
+func sortedUserWeeks(m map[models.BucketKey]bool) []models.BucketKey {
+	keys := make([]models.BucketKey, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].ID != keys[j].ID {
+			return keys[i].ID < keys[j].ID
+		}
+		return keys[i].BucketStart.Before(keys[j].BucketStart)
+	})
+	return keys
+}
+
+func sortedCategoryBuckets(m map[models.CategoryBucketKey]*models.Counts) []models.CategoryBucketKey {
+	keys := make([]models.CategoryBucketKey, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Category != keys[j].Category {
+			return keys[i].Category < keys[j].Category
+		}
+		return keys[i].BucketStart.Before(keys[j].BucketStart)
+	})
+	return keys
+}
+
+func sortedCategories(m map[string]*models.Counts) []string {
+	categories := make([]string, 0, len(m))
+	for category := range m {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+func sortedCategoryUsers(m map[models.CategoryUserKey]time.Time) []models.CategoryUserKey {
+	keys := make([]models.CategoryUserKey, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Category != keys[j].Category {
+			return keys[i].Category < keys[j].Category
+		}
+		return keys[i].UserID < keys[j].UserID
+	})
+	return keys
+}
+
+func (r *analyticsRepository) GetTrendingProducts(ctx context.Context, q trending.Query) ([]*models.TrendingProduct, error) {
+	r.logger.Printf("Fetching trending products, categories: %v, limit: %d", q.Categories, q.Limit)
+	products, err := trending.Products(ctx, r.db.Conn(ctx), q)
 	if err != nil {
-		r.logger.Printf("Failed to fetch analytics for product ID: %d, error: %v", productID, err)
-		return nil, fmt.Errorf("failed to get product analytics: %w", err)
+		r.logger.Printf("Failed to get trending products: %v", err)
+		return nil, err
 	}
-	r.logger.Printf("Successfully fetched analytics for product ID: %d", productID)
-	return &pa, nil
+
+	result := make([]*models.TrendingProduct, len(products))
+	for i, p := range products {
+		result[i] = &models.TrendingProduct{
+			ProductID:         p.ProductID,
+			Category:          p.Category,
+			WindowLikes:       p.WindowLikes,
+			WindowPurchases:   p.WindowPurchases,
+			BaselineLikes:     p.BaselineLikes,
+			BaselinePurchases: p.BaselinePurchases,
+			Velocity:          p.Velocity,
+		}
+	}
+	r.logger.Printf("Successfully fetched %d trending products", len(result))
+	return result, nil
 }
 
-func (r *analyticsRepository) IncrementUserLikes(ctx context.Context, userID int64) error {
-	r.logger.Printf("Incrementing likes for user ID: %d", userID)
+// GetProductCategories reads the categories from the copy kept from product
+// events, falling back to the products table for products whose events were
+// not consumed yet.
+func (r *analyticsRepository) GetProductCategories(ctx context.Context, productIDs []int64) (map[int64]string, error) {
+	r.logger.Printf("Fetching categories of %d products", len(productIDs))
 	query := `
-        INSERT INTO user_analytics (user_id, total_likes)
-        VALUES ($1, 1)
-        ON CONFLICT (user_id)
-        DO UPDATE SET total_likes = user_analytics.total_likes + 1, updated_at = NOW()
+        SELECT product_id, category FROM product_categories WHERE product_id = ANY($1)
+        UNION ALL
+        SELECT id, category FROM products p
+        WHERE id = ANY($1) AND NOT EXISTS (SELECT 1 FROM product_categories pc WHERE pc.product_id = p.id)
     `
-	_, err := r.db.Pool.Exec(ctx, query, userID)
+	rows, err := r.db.Conn(ctx).Query(ctx, query, productIDs)
 	if err != nil {
-		r.logger.Printf("Failed to increment user likes: %v", err)
-		return fmt.Errorf("failed to increment user likes: %w", err)
+		r.logger.Printf("Failed to fetch product categories: %v", err)
+		return nil, fmt.Errorf("failed to get product categories: %w", err)
 	}
-	r.logger.Printf("Successfully incremented likes for user ID: %d", userID)
-	return nil
+	defer rows.Close()
+
+	categories := make(map[int64]string, len(productIDs))
+	for rows.Next() {
+		var id int64
+		var category string
+		if err := rows.Scan(&id, &category); err != nil {
+			r.logger.Printf("Failed to scan product category: %v", err)
+			return nil, fmt.Errorf("failed to scan product category: %w", err)
+		}
+		categories[id] = category
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get product categories: %w", err)
+	}
+	r.logger.Printf("Successfully fetched categories of %d products", len(categories))
+	return categories, nil
 }
 
-func (r *analyticsRepository) IncrementUserDislikes(ctx context.Context, userID int64) error {
-	r.logger.Printf("Incrementing dislikes for user ID: %d", userID)
+func (r *analyticsRepository) GetProductFunnel(ctx context.Context, productID int64) (*models.Funnel, error) {
+	r.logger.Printf("Fetching funnel for product ID: %d", productID)
 	query := `
-        INSERT INTO user_analytics (user_id, total_dislikes)
-        VALUES ($1, 1)
-        ON CONFLICT (user_id)
-        DO UPDATE SET total_dislikes = user_analytics.total_dislikes + 1, updated_at = NOW()
+        SELECT COALESCE(s.views, 0), COALESCE(pa.likes, 0), COALESCE(pa.purchases, 0)
+        FROM (SELECT $1::int AS product_id) p
+        LEFT JOIN statistics s ON s.product_id = p.product_id
+        LEFT JOIN product_analytics pa ON pa.product_id = p.product_id
     `
-	_, err := r.db.Pool.Exec(ctx, query, userID)
+	f := models.Funnel{ProductID: productID}
+	err := r.db.Conn(ctx).QueryRow(ctx, query, productID).Scan(&f.Views, &f.Likes, &f.Purchases)
 	if err != nil {
-		r.logger.Printf("Failed to increment user dislikes: %v", err)
-		return fmt.Errorf("failed to increment user dislikes: %w", err)
+		r.logger.Printf("Failed to fetch funnel for product ID: %d, error: %v", productID, err)
+		return nil, fmt.Errorf("failed to get product funnel: %w", err)
 	}
-	r.logger.Printf("Successfully incremented dislikes for user ID: %d", userID)
-	return nil
+	r.logger.Printf("Successfully fetched funnel for product ID: %d", productID)
+	return &f, nil
 }
 
-func (r *analyticsRepository) IncrementUserPurchases(ctx context.Context, userID int64) error {
-	r.logger.Printf("Incrementing purchases for user ID: %d", userID)
+// GetCategoryFunnel sums the lifetime counters of the products currently in
+// the category. Views are only counted per product, so the funnel cannot use
+// the category at event time like category_analytics does, and the two differ
+// once a product has changed category.
+func (r *analyticsRepository) GetCategoryFunnel(ctx context.Context, category string) (*models.Funnel, error) {
+	r.logger.Printf("Fetching funnel for category: %q", category)
 	query := `
-        INSERT INTO user_analytics (user_id, total_purchases)
-        VALUES ($1, 1)
-        ON CONFLICT (user_id)
-        DO UPDATE SET total_purchases = user_analytics.total_purchases + 1, updated_at = NOW()
+        SELECT COALESCE(SUM(s.views), 0), COALESCE(SUM(pa.likes), 0), COALESCE(SUM(pa.purchases), 0)
+        FROM product_categories p
+        LEFT JOIN statistics s ON s.product_id = p.product_id
+        LEFT JOIN product_analytics pa ON pa.product_id = p.product_id
+        WHERE p.category = $1
     `
-	_, err := r.db.Pool.Exec(ctx, query, userID)
+	f := models.Funnel{Category: category}
+	err := r.db.Conn(ctx).QueryRow(ctx, query, category).Scan(&f.Views, &f.Likes, &f.Purchases)
 	if err != nil {
-		r.logger.Printf("Failed to increment user purchases: %v", err)
-		return fmt.Errorf("failed to increment user purchases: %w", err)
+		r.logger.Printf("Failed to fetch funnel for category: %q, error: %v", category, err)
+		return nil, fmt.Errorf("failed to get category funnel: %w", err)
+	}
+	r.logger.Printf("Successfully fetched funnel for category: %q", category)
+	return &f, nil
+}
+
+// UpsertProductCategories stores the categories of the products unless a newer
+// version is already stored, so redelivered and reordered product events do
+// not revert a re-categorization.
+func (r *analyticsRepository) UpsertProductCategories(ctx context.Context, products []*models.ProductCategory) error {
+	r.logger.Printf("Upserting categories of %d products", len(products))
+	batch := &pgx.Batch{}
+	for _, p := range products {
+		batch.Queue(`
+        INSERT INTO product_categories (product_id, category, updated_at)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (product_id)
+        DO UPDATE SET category = EXCLUDED.category, updated_at = EXCLUDED.updated_at
+        WHERE product_categories.updated_at <= EXCLUDED.updated_at
+    `, p.ProductID, p.Category, p.UpdatedAt)
+	}
+
+	results := r.db.Conn(ctx).SendBatch(ctx, batch)
+	for i := 0; i < batch.Len(); i++ {
+		if _, err := results.Exec(); err != nil {
+			results.Close()
+			r.logger.Printf("Failed to upsert product categories: %v", err)
+			return fmt.Errorf("failed to upsert product categories: %w", err)
+		}
+	}
+	if err := results.Close(); err != nil {
+		r.logger.Printf("Failed to upsert product categories: %v", err)
+		return fmt.Errorf("failed to upsert product categories: %w", err)
 	}
-	r.logger.Printf("Successfully incremented purchases for user ID: %d", userID)
+	r.logger.Printf("Successfully upserted categories of %d products", len(products))
 	return nil
 }
 
-func (r *analyticsRepository) GetUserAnalytics(ctx context.Context, userID int64) (*models.UserAnalytics, error) {
-	r.logger.Printf("Fetching analytics for user ID: %d", userID)
-	query := `
-        SELECT id, user_id, total_likes, total_dislikes, total_purchases, updated_at
-        FROM user_analytics
-        WHERE user_id = $1
+const categoryAnalyticsQuery = `
+        SELECT ca.category, ca.likes, ca.dislikes, ca.purchases,
+            COALESCE(u.total_users, 0), COALESCE(u.active_users, 0), ca.updated_at
+        FROM category_analytics ca
+        LEFT JOIN (
+            SELECT category, COUNT(*) AS total_users,
+                COUNT(*) FILTER (WHERE last_active_at >= $1) AS active_users
+            FROM category_users
+            WHERE $2 = '' OR category = $2
+            GROUP BY category
+        ) u ON u.category = ca.category
+        WHERE $2 = '' OR ca.category = $2
+        ORDER BY ca.category
     `
-	var ua models.UserAnalytics
-	err := r.db.Pool.QueryRow(ctx, query, userID).Scan(
-		&ua.ID, &ua.UserID, &ua.TotalLikes, &ua.TotalDislikes, &ua.TotalPurchases, &ua.UpdatedAt,
+
+func (r *analyticsRepository) GetCategoryAnalytics(ctx context.Context, category string, activeSince time.Time) (*models.CategoryAnalytics, error) {
+	r.logger.Printf("Fetching analytics for category: %q", category)
+	var ca models.CategoryAnalytics
+	err := r.db.Conn(ctx).QueryRow(ctx, categoryAnalyticsQuery, activeSince, category).Scan(
+		&ca.Category, &ca.Likes, &ca.Dislikes, &ca.Purchases, &ca.TotalUsers, &ca.ActiveUsers, &ca.UpdatedAt,
 	)
 	if err != nil {
-		r.logger.Printf("Failed to fetch analytics for user ID: %d, error: %v", userID, err)
-		return nil, fmt.Errorf("failed to get user analytics: %w", err)
+		r.logger.Printf("Failed to fetch analytics for category: %q, error: %v", category, err)
+		return nil, fmt.Errorf("failed to get category analytics: %w", err)
 	}
-	r.logger.Printf("Successfully fetched analytics for user ID: %d", userID)
-	return &ua, nil
+	r.logger.Printf("Successfully fetched analytics for category: %q", category)
+	return &ca, nil
+}
+
+func (r *analyticsRepository) ListCategoryAnalytics(ctx context.Context, activeSince time.Time) ([]*models.CategoryAnalytics, error) {
+	r.logger.Println("Fetching analytics of all categories")
+	rows, err := r.db.Conn(ctx).Query(ctx, categoryAnalyticsQuery, activeSince, "")
+	if err != nil {
+		r.logger.Printf("Failed to fetch category analytics: %v", err)
+		return nil, fmt.Errorf("failed to list category analytics: %w", err)
+	}
+	defer rows.Close()
+
+	categories := []*models.CategoryAnalytics{}
+	for rows.Next() {
+		var ca models.CategoryAnalytics
+		if err := rows.Scan(
+			&ca.Category, &ca.Likes, &ca.Dislikes, &ca.Purchases, &ca.TotalUsers, &ca.ActiveUsers, &ca.UpdatedAt,
+		); err != nil {
+			r.logger.Printf("Failed to scan category analytics: %v", err)
+			return nil, fmt.Errorf("failed to scan category analytics: %w", err)
+		}
+		categories = append(categories, &ca)
+	}
+	if err := rows.Err(); err != nil {
+		r.logger.Printf("Rows error: %v", err)
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	r.logger.Printf("Successfully fetched analytics of %d categories", len(categories))
+	return categories, nil
+}
+
+func (r *analyticsRepository) DeleteProductActivityBefore(ctx context.Context, before time.Time) (int64, error) {
+	r.logger.Printf("Deleting product activity before %s", before.Format(time.RFC3339))
+	query := `DELETE FROM product_activity WHERE bucket_start < $1`
+	cmdTag, err := r.db.Conn(ctx).Exec(ctx, query, before)
+	if err != nil {
+		r.logger.Printf("Failed to delete product activity: %v", err)
+		return 0, fmt.Errorf("failed to delete product activity: %w", err)
+	}
+	r.logger.Printf("Successfully deleted %d product activity rows", cmdTag.RowsAffected())
+	return cmdTag.RowsAffected(), nil
 }
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"recommendation-system/internal/analytics/models"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// UpsertUserCohorts records the registration of users. A user keeps the
+// earliest registration time seen, so a redelivered or backfilled registration
+// does not move them to another cohort.
+func (r *analyticsRepository) UpsertUserCohorts(ctx context.Context, cohorts []*models.UserCohort) error {
+	r.logger.Printf("Upserting cohorts of %d users", len(cohorts))
+	batch := &pgx.Batch{}
+	for _, c := range cohorts {
+		batch.Queue(`
+        INSERT INTO user_cohorts (user_id, cohort_week, registered_at)
+        VALUES ($1, date_trunc('week', $2::timestamp)::date, $2)
+        ON CONFLICT (user_id)
+        DO UPDATE SET cohort_week = EXCLUDED.cohort_week, registered_at = EXCLUDED.registered_at
+        WHERE EXCLUDED.registered_at < user_cohorts.registered_at
+    `, c.UserID, c.RegisteredAt)
+	}
+
+	results := r.db.Conn(ctx).SendBatch(ctx, batch)
+	for i := 0; i < batch.Len(); i++ {
+		if _, err := results.Exec(); err != nil {
+			results.Close()
+			r.logger.Printf("Failed to upsert user cohorts: %v", err)
+			return fmt.Errorf("failed to upsert user cohorts: %w", err)
+		}
+	}
+	if err := results.Close(); err != nil {
+		r.logger.Printf("Failed to upsert user cohorts: %v", err)
+		return fmt.Errorf("failed to upsert user cohorts: %w", err)
+	}
+	r.logger.Printf("Successfully upserted cohorts of %d users", len(cohorts))
+	return nil
+}
+
+// GetCohortSizes counts the users who registered in each week in [from, to).
+func (r *analyticsRepository) GetCohortSizes(ctx context.Context, from, to time.Time) (map[time.Time]int, error) {
+	r.logger.Printf("Fetching cohort sizes from %s to %s", from.Format(time.DateOnly), to.Format(time.DateOnly))
+	query := `
+        SELECT cohort_week, COUNT(*)
+        FROM user_cohorts
+        WHERE cohort_week >= $1 AND cohort_week < $2
+        GROUP BY cohort_week
+    `
+	rows, err := r.db.Conn(ctx).Query(ctx, query, from, to)
+	if err != nil {
+		r.logger.Printf("Failed to fetch cohort sizes: %v", err)
+		return nil, fmt.Errorf("failed to get cohort sizes: %w", err)
+	}
+	defer rows.Close()
+
+	sizes := make(map[time.Time]int)
+	for rows.Next() {
+		var (
+			week  time.Time
+			users int
+		)
+		if err := rows.Scan(&week, &users); err != nil {
+			r.logger.Printf("Failed to scan cohort size: %v", err)
+			return nil, fmt.Errorf("failed to scan cohort size: %w", err)
+		}
+		sizes[week.UTC()] = users
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get cohort sizes: %w", err)
+	}
+	r.logger.Printf("Fetched the sizes of %d cohorts", len(sizes))
+	return sizes, nil
+}
+
+// GetCohortActivity counts, for the cohorts of the weeks in [from, to), the
+// users active in each of the first weeks weeks since their registration week.
+func (r *analyticsRepository) GetCohortActivity(ctx context.Context, from, to time.Time, weeks int) ([]*models.CohortActivity, error) {
+	r.logger.Printf("Fetching cohort activity from %s to %s", from.Format(time.DateOnly), to.Format(time.DateOnly))
+	query := `
+        SELECT c.cohort_week, (a.week - c.cohort_week) / 7, COUNT(*)
+        FROM user_cohorts c
+        JOIN user_activity_weeks a ON a.user_id = c.user_id
+        WHERE c.cohort_week >= $1 AND c.cohort_week < $2
+          AND a.week >= c.cohort_week AND a.week < c.cohort_week + $3::int * 7
+        GROUP BY 1, 2
+    `
+	rows, err := r.db.Conn(ctx).Query(ctx, query, from, to, weeks)
+	if err != nil {
+		r.logger.Printf("Failed to fetch cohort activity: %v", err)
+		return nil, fmt.Errorf("failed to get cohort activity: %w", err)
+	}
+	defer rows.Close()
+
+	var activity []*models.CohortActivity
+	for rows.Next() {
+		var a models.CohortActivity
+		if err := rows.Scan(&a.Week, &a.Offset, &a.Users); err != nil {
+			r.logger.Printf("Failed to scan cohort activity: %v", err)
+			return nil, fmt.Errorf("failed to scan cohort activity: %w", err)
+		}
+		a.Week = a.Week.UTC()
+		activity = append(activity, &a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get cohort activity: %w", err)
+	}
+	r.logger.Printf("Fetched %d cohort activity cells", len(activity))
+	return activity, nil
+}
@@ -0,0 +1,263 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"recommendation-system/internal/analytics/models"
+	"recommendation-system/pkg/export"
+)
+
+var ErrInvalidExport = errors.New("invalid export query")
+
+type exportColumn struct {
+	expr   string
+	column export.Column
+}
+
+// exportDataset describes how the rows of a dataset are selected. Table and
+// column names are never taken from input. Rows are read in key order, which
+// is the primary key of the table, so that chunks can resume after a key.
+type exportDataset struct {
+	table   string
+	columns []exportColumn
+	key     []string
+	// idColumn is filtered by the product or user ID of the query.
+	idColumn string
+	// categoryFilter is the condition selecting the rows of a category, with
+	// %s standing for its parameter. Datasets without it reject a category.
+	categoryFilter string
+	// timeColumn is filtered by the From and To of the query.
+	timeColumn string
+}
+
+const productCategoryFilter = `EXISTS (SELECT 1 FROM product_categories pc WHERE pc.product_id = t.product_id AND pc.category = %s)`
+
+func seriesExport(table, idColumn, categoryFilter string) exportDataset {
+	return exportDataset{
+		table: table,
+		columns: []exportColumn{
+			{"t." + idColumn + "::bigint", export.Column{Name: idColumn, Type: export.Int64}},
+			{"t.bucket_start", export.Column{Name: "bucket_start", Type: export.Time}},
+			{"t.likes::bigint", export.Column{Name: "likes", Type: export.Int64}},
+			{"t.dislikes::bigint", export.Column{Name: "dislikes", Type: export.Int64}},
+			{"t.purchases::bigint", export.Column{Name: "purchases", Type: export.Int64}},
+			{"t.revenue::float8", export.Column{Name: "revenue", Type: export.Float64}},
+		},
+		key:            []string{"t." + idColumn, "t.bucket_start"},
+		idColumn:       "t." + idColumn,
+		categoryFilter: categoryFilter,
+		timeColumn:     "t.bucket_start",
+	}
+}
+
+var exportDatasets = map[string]exportDataset{
+	models.ExportProductAnalytics: {
+		table: "product_analytics",
+		columns: []exportColumn{
+			{"t.product_id::bigint", export.Column{Name: "product_id", Type: export.Int64}},
+			{"t.likes::bigint", export.Column{Name: "likes", Type: export.Int64}},
+			{"t.dislikes::bigint", export.Column{Name: "dislikes", Type: export.Int64}},
+			{"t.purchases::bigint", export.Column{Name: "purchases", Type: export.Int64}},
+			{"t.revenue::float8", export.Column{Name: "revenue", Type: export.Float64}},
+			{"t.updated_at", export.Column{Name: "updated_at", Type: export.Time}},
+		},
+		key:            []string{"t.product_id"},
+		idColumn:       "t.product_id",
+		categoryFilter: productCategoryFilter,
+		timeColumn:     "t.updated_at",
+	},
+	models.ExportUserAnalytics: {
+		table: "user_analytics",
+		columns: []exportColumn{
+			{"t.user_id::bigint", export.Column{Name: "user_id", Type: export.Int64}},
+			{"t.total_likes::bigint", export.Column{Name: "total_likes", Type: export.Int64}},
+			{"t.total_dislikes::bigint", export.Column{Name: "total_dislikes", Type: export.Int64}},
+			{"t.total_purchases::bigint", export.Column{Name: "total_purchases", Type: export.Int64}},
+			{"t.total_revenue::float8", export.Column{Name: "total_revenue", Type: export.Float64}},
+			{"t.updated_at", export.Column{Name: "updated_at", Type: export.Time}},
+		},
+		key:        []string{"t.user_id"},
+		idColumn:   "t.user_id",
+		timeColumn: "t.updated_at",
+	},
+	models.ExportProductHourly: seriesExport("product_analytics_hourly", "product_id", productCategoryFilter),
+	models.ExportProductDaily:  seriesExport("product_analytics_daily", "product_id", productCategoryFilter),
+	models.ExportUserHourly:    seriesExport("user_analytics_hourly", "user_id", ""),
+	models.ExportUserDaily:     seriesExport("user_analytics_daily", "user_id", ""),
+	models.ExportCategoryRevenue: {
+		table: "category_revenue_daily",
+		columns: []exportColumn{
+			{"t.category", export.Column{Name: "category", Type: export.String}},
+			{"t.bucket_start", export.Column{Name: "bucket_start", Type: export.Time}},
+			{"t.purchases::bigint", export.Column{Name: "purchases", Type: export.Int64}},
+			{"t.revenue::float8", export.Column{Name: "revenue", Type: export.Float64}},
+		},
+		key:            []string{"t.category", "t.bucket_start"},
+		categoryFilter: "t.category = %s",
+		timeColumn:     "t.bucket_start",
+	},
+}
+
+// ExportSchema returns the columns of a dataset and the positions of its key
+// columns among them.
+func (r *analyticsRepository) ExportSchema(dataset string) ([]export.Column, []int, error) {
+	ds, ok := exportDatasets[dataset]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: unknown dataset %q", ErrInvalidExport, dataset)
+	}
+	columns := make([]export.Column, len(ds.columns))
+	for i, c := range ds.columns {
+		columns[i] = c.column
+	}
+	key := make([]int, len(ds.key))
+	for i, k := range ds.key {
+		for j, c := range ds.columns {
+			if strings.HasPrefix(c.expr, k) {
+				key[i] = j
+				break
+			}
+		}
+	}
+	return columns, key, nil
+}
+
+// exportWhere builds the conditions of the query and of the key range
+// (after, until], numbering the parameters from 1.
+func exportWhere(ds exportDataset, q models.ExportQuery, after, until []interface{}) (string, []interface{}, error) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	param := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	keyParams := func(values []interface{}) string {
+		params := make([]string, len(values))
+		for i, v := range values {
+			params[i] = param(v)
+		}
+		return "(" + strings.Join(params, ", ") + ")"
+	}
+
+	id := q.ProductID
+	if strings.HasSuffix(ds.idColumn, "user_id") {
+		id = q.UserID
+	}
+	if (q.ProductID != 0 || q.UserID != 0) && (ds.idColumn == "" || id == 0) {
+		return "", nil, fmt.Errorf("%w: dataset %q cannot be filtered by this ID", ErrInvalidExport, q.Dataset)
+	}
+	if id != 0 {
+		conditions = append(conditions, ds.idColumn+" = "+param(id))
+	}
+	if q.Category != "" {
+		if ds.categoryFilter == "" {
+			return "", nil, fmt.Errorf("%w: dataset %q cannot be filtered by category", ErrInvalidExport, q.Dataset)
+		}
+		conditions = append(conditions, fmt.Sprintf(ds.categoryFilter, param(q.Category)))
+	}
+	if !q.From.IsZero() {
+		conditions = append(conditions, ds.timeColumn+" >= "+param(q.From))
+	}
+	if !q.To.IsZero() {
+		conditions = append(conditions, ds.timeColumn+" < "+param(q.To))
+	}
+
+	key := "(" + strings.Join(ds.key, ", ") + ")"
+	if after != nil {
+		conditions = append(conditions, key+" > "+keyParams(after))
+	}
+	if until != nil {
+		conditions = append(conditions, key+" <= "+keyParams(until))
+	}
+
+	if len(conditions) == 0 {
+		return "", args, nil
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args, nil
+}
+
+// ExportChunkEnd finds the key of the limit-th row after the cursor, which
+// ends the chunk, and whether more rows follow it. A nil key means that the
+// chunk runs to the end of the dataset.
+func (r *analyticsRepository) ExportChunkEnd(ctx context.Context, q models.ExportQuery, after []interface{}, limit int) ([]interface{}, bool, error) {
+	r.logger.Printf("Finding the end of a %d row chunk of %s", limit, q.Dataset)
+	ds, ok := exportDatasets[q.Dataset]
+	if !ok {
+		return nil, false, fmt.Errorf("%w: unknown dataset %q", ErrInvalidExport, q.Dataset)
+	}
+	where, args, err := exportWhere(ds, q, after, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	keys := strings.Join(ds.key, ", ")
+	query := fmt.Sprintf(`SELECT %[1]s FROM %[2]s t %[3]s ORDER BY %[1]s OFFSET %[4]d LIMIT 2`, keys, ds.table, where, limit-1)
+
+	rows, err := r.db.Conn(ctx).Query(ctx, query, args...)
+	if err != nil {
+		r.logger.Printf("Failed to find the end of the export chunk: %v", err)
+		return nil, false, fmt.Errorf("failed to find the end of the export chunk: %w", err)
+	}
+	defer rows.Close()
+
+	var ends [][]interface{}
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to scan export key: %w", err)
+		}
+		ends = append(ends, values)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("failed to find the end of the export chunk: %w", err)
+	}
+	if len(ends) == 0 {
+		return nil, false, nil
+	}
+	return ends[0], len(ends) > 1, nil
+}
+
+// ExportRows reads up to limit rows with a key in (after, until], in key
+// order.
+func (r *analyticsRepository) ExportRows(ctx context.Context, q models.ExportQuery, after, until []interface{}, limit int) ([][]interface{}, error) {
+	r.logger.Printf("Reading up to %d rows of %s", limit, q.Dataset)
+	ds, ok := exportDatasets[q.Dataset]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown dataset %q", ErrInvalidExport, q.Dataset)
+	}
+	where, args, err := exportWhere(ds, q, after, until)
+	if err != nil {
+		return nil, err
+	}
+	exprs := make([]string, len(ds.columns))
+	for i, c := range ds.columns {
+		exprs[i] = c.expr
+	}
+	query := fmt.Sprintf(`SELECT %s FROM %s t %s ORDER BY %s LIMIT %d`,
+		strings.Join(exprs, ", "), ds.table, where, strings.Join(ds.key, ", "), limit)
+
+	rows, err := r.db.Conn(ctx).Query(ctx, query, args...)
+	if err != nil {
+		r.logger.Printf("Failed to read %s rows: %v", q.Dataset, err)
+		return nil, fmt.Errorf("failed to read %s rows: %w", q.Dataset, err)
+	}
+	defer rows.Close()
+
+	var result [][]interface{}
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			r.logger.Printf("Failed to scan %s row: %v", q.Dataset, err)
+			return nil, fmt.Errorf("failed to scan %s row: %w", q.Dataset, err)
+		}
+		result = append(result, values)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s rows: %w", q.Dataset, err)
+	}
+	r.logger.Printf("Read %d rows of %s", len(result), q.Dataset)
+	return result, nil
+}
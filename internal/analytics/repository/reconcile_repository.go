@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"recommendation-system/internal/analytics/models"
+)
+
+// counterTable names the lifetime counters of products or users. Table and
+// column names are never taken from input.
+type counterTable struct {
+	name      string
+	table     string
+	idColumn  string
+	likes     string
+	dislikes  string
+	purchases string
+	revenue   string
+}
+
+var (
+	productCounters = counterTable{name: "product", table: "product_analytics", idColumn: "product_id", likes: "likes", dislikes: "dislikes", purchases: "purchases", revenue: "revenue"}
+	userCounters    = counterTable{name: "user", table: "user_analytics", idColumn: "user_id", likes: "total_likes", dislikes: "total_dislikes", purchases: "total_purchases", revenue: "total_revenue"}
+)
+
+func (r *analyticsRepository) FindProductDiscrepancies(ctx context.Context, settle time.Duration) ([]*models.CounterDiscrepancy, error) {
+	return r.findDiscrepancies(ctx, productCounters, settle)
+}
+
+func (r *analyticsRepository) FindUserDiscrepancies(ctx context.Context, settle time.Duration) ([]*models.CounterDiscrepancy, error) {
+	return r.findDiscrepancies(ctx, userCounters, settle)
+}
+
+// findDiscrepancies compares the counters with the ones computed from the
+// source tables. Products or users with a source row or a counter update in
+// the last settle are skipped, since their events may still be in flight.
+func (r *analyticsRepository) findDiscrepancies(ctx context.Context, t counterTable, settle time.Duration) ([]*models.CounterDiscrepancy, error) {
+	r.logger.Printf("Comparing %s counters with the source tables", t.name)
+	query := fmt.Sprintf(`
+        WITH source AS (
+            SELECT %[1]s AS id, 1 AS likes, 0 AS dislikes, 0 AS purchases, 0::numeric AS revenue, liked_at AS at FROM likes
+            UNION ALL
+            SELECT %[1]s, 0, 1, 0, 0, disliked_at FROM dislikes
+            UNION ALL
+            SELECT %[1]s, 0, 0, 1, price, purchased_at FROM purchases
+        ), expected AS (
+            SELECT id, SUM(likes) AS likes, SUM(dislikes) AS dislikes, SUM(purchases) AS purchases,
+                   SUM(revenue) AS revenue, MAX(at) AS last_at
+            FROM source
+            GROUP BY id
+        )
+        SELECT COALESCE(e.id, a.%[1]s)::bigint,
+               COALESCE(e.likes, 0)::int, COALESCE(e.dislikes, 0)::int, COALESCE(e.purchases, 0)::int, COALESCE(e.revenue, 0)::float8,
+               COALESCE(a.%[3]s, 0), COALESCE(a.%[4]s, 0), COALESCE(a.%[5]s, 0), COALESCE(a.%[6]s, 0)::float8
+        FROM expected e
+        FULL OUTER JOIN %[2]s a ON a.%[1]s = e.id
+        WHERE (e.last_at IS NULL OR e.last_at < NOW() - make_interval(secs => $1))
+          AND (a.updated_at IS NULL OR a.updated_at < NOW() - make_interval(secs => $1))
+          AND (COALESCE(e.likes, 0), COALESCE(e.dislikes, 0), COALESCE(e.purchases, 0), COALESCE(e.revenue, 0))
+              IS DISTINCT FROM (COALESCE(a.%[3]s, 0), COALESCE(a.%[4]s, 0), COALESCE(a.%[5]s, 0), COALESCE(a.%[6]s, 0))
+        ORDER BY 1
+    `, t.idColumn, t.table, t.likes, t.dislikes, t.purchases, t.revenue)
+
+	rows, err := r.db.Conn(ctx).Query(ctx, query, settle.Seconds())
+	if err != nil {
+		r.logger.Printf("Failed to compare %s counters: %v", t.name, err)
+		return nil, fmt.Errorf("failed to compare %s counters: %w", t.name, err)
+	}
+	defer rows.Close()
+
+	var discrepancies []*models.CounterDiscrepancy
+	for rows.Next() {
+		var d models.CounterDiscrepancy
+		if err := rows.Scan(
+			&d.ID,
+			&d.Expected.Likes, &d.Expected.Dislikes, &d.Expected.Purchases, &d.Expected.Revenue,
+			&d.Actual.Likes, &d.Actual.Dislikes, &d.Actual.Purchases, &d.Actual.Revenue,
+		); err != nil {
+			r.logger.Printf("Failed to scan %s counter discrepancy: %v", t.name, err)
+			return nil, fmt.Errorf("failed to scan %s counter discrepancy: %w", t.name, err)
+		}
+		discrepancies = append(discrepancies, &d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to compare %s counters: %w", t.name, err)
+	}
+	r.logger.Printf("Found %d %s counter discrepancies", len(discrepancies), t.name)
+	return discrepancies, nil
+}
+
+func (r *analyticsRepository) RepairProductCounters(ctx context.Context, discrepancies []*models.CounterDiscrepancy, settle time.Duration) (int64, error) {
+	return r.repairCounters(ctx, productCounters, discrepancies, settle)
+}
+
+func (r *analyticsRepository) RepairUserCounters(ctx context.Context, discrepancies []*models.CounterDiscrepancy, settle time.Duration) (int64, error) {
+	return r.repairCounters(ctx, userCounters, discrepancies, settle)
+}
+
+// repairCounters sets the counters to their expected values. Counters updated
+// in the last settle, since they were compared, are left alone. Events older
+// than settle that are not applied yet are not detected; see
+// service.ReconcileConfig.
+func (r *analyticsRepository) repairCounters(ctx context.Context, t counterTable, discrepancies []*models.CounterDiscrepancy, settle time.Duration) (int64, error) {
+	if len(discrepancies) == 0 {
+		return 0, nil
+	}
+	r.logger.Printf("Repairing %d %s counters", len(discrepancies), t.name)
+	var (
+		ids       = make([]int64, len(discrepancies))
+		likes     = make([]int64, len(discrepancies))
+		dislikes  = make([]int64, len(discrepancies))
+		purchases = make([]int64, len(discrepancies))
+		revenue   = make([]float64, len(discrepancies))
+	)
+	for i, d := range discrepancies {
+		ids[i] = d.ID
+		likes[i] = int64(d.Expected.Likes)
+		dislikes[i] = int64(d.Expected.Dislikes)
+		purchases[i] = int64(d.Expected.Purchases)
+		revenue[i] = d.Expected.Revenue
+	}
+
+	query := fmt.Sprintf(`
+        INSERT INTO %[2]s (%[1]s, %[3]s, %[4]s, %[5]s, %[6]s, updated_at)
+        SELECT id, likes, dislikes, purchases, revenue, NOW()
+        FROM unnest($1::bigint[], $2::bigint[], $3::bigint[], $4::bigint[], $5::float8[])
+             AS r(id, likes, dislikes, purchases, revenue)
+        ON CONFLICT (%[1]s) DO UPDATE SET
+            %[3]s = EXCLUDED.%[3]s,
+            %[4]s = EXCLUDED.%[4]s,
+            %[5]s = EXCLUDED.%[5]s,
+            %[6]s = EXCLUDED.%[6]s,
+            updated_at = NOW()
+        WHERE %[2]s.updated_at < NOW() - make_interval(secs => $6)
+    `, t.idColumn, t.table, t.likes, t.dislikes, t.purchases, t.revenue)
+
+	tag, err := r.db.Conn(ctx).Exec(ctx, query, ids, likes, dislikes, purchases, revenue, settle.Seconds())
+	if err != nil {
+		r.logger.Printf("Failed to repair %s counters: %v", t.name, err)
+		return 0, fmt.Errorf("failed to repair %s counters: %w", t.name, err)
+	}
+	r.logger.Printf("Repaired %d %s counters", tag.RowsAffected(), t.name)
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,181 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"recommendation-system/internal/analytics/models"
+)
+
+// seriesTables names the bucket tables of products or users. Table and column
+// names are never taken from input.
+type seriesTables struct {
+	name     string
+	idColumn string
+	hourly   string
+	daily    string
+}
+
+var (
+	productSeries = seriesTables{name: "product", idColumn: "product_id", hourly: "product_analytics_hourly", daily: "product_analytics_daily"}
+	userSeries    = seriesTables{name: "user", idColumn: "user_id", hourly: "user_analytics_hourly", daily: "user_analytics_daily"}
+	// Category revenue is only kept per day.
+	categoryRevenueSeries = seriesTables{name: "category revenue", idColumn: "category", daily: "category_revenue_daily"}
+)
+
+func (r *analyticsRepository) GetProductTimeSeries(ctx context.Context, productID int64, q models.TimeSeriesQuery) ([]*models.TimeSeriesPoint, error) {
+	return r.getTimeSeries(ctx, productSeries, productID, q)
+}
+
+func (r *analyticsRepository) GetUserTimeSeries(ctx context.Context, userID int64, q models.TimeSeriesQuery) ([]*models.TimeSeriesPoint, error) {
+	return r.getTimeSeries(ctx, userSeries, userID, q)
+}
+
+// getTimeSeries returns the non-empty buckets in [q.From, q.To). Daily series
+// also sum the hourly rows that were not rolled up yet, which is exact because
+// the rollup moves rows instead of copying them.
+func (r *analyticsRepository) getTimeSeries(ctx context.Context, t seriesTables, id int64, q models.TimeSeriesQuery) ([]*models.TimeSeriesPoint, error) {
+	r.logger.Printf("Fetching %s time series of %s ID: %d from %s to %s", q.Granularity, t.name, id, q.From.Format(time.RFC3339), q.To.Format(time.RFC3339))
+
+	var query string
+	switch q.Granularity {
+	case models.GranularityHour:
+		query = fmt.Sprintf(`
+        SELECT bucket_start, likes, dislikes, purchases, revenue::float8
+        FROM %[1]s
+        WHERE %[2]s = $1 AND bucket_start >= $2 AND bucket_start < $3
+        ORDER BY bucket_start
+    `, t.hourly, t.idColumn)
+	case models.GranularityDay:
+		query = fmt.Sprintf(`
+        SELECT bucket_start, SUM(likes), SUM(dislikes), SUM(purchases), SUM(revenue)::float8
+        FROM (
+            SELECT bucket_start, likes, dislikes, purchases, revenue
+            FROM %[1]s
+            WHERE %[3]s = $1 AND bucket_start >= $2 AND bucket_start < $3
+            UNION ALL
+            SELECT date_trunc('day', bucket_start), likes, dislikes, purchases, revenue
+            FROM %[2]s
+            WHERE %[3]s = $1 AND bucket_start >= $2 AND bucket_start < $3
+        ) buckets
+        GROUP BY bucket_start
+        ORDER BY bucket_start
+    `, t.daily, t.hourly, t.idColumn)
+	default:
+		return nil, fmt.Errorf("unknown granularity %q", q.Granularity)
+	}
+
+	rows, err := r.db.Conn(ctx).Query(ctx, query, id, q.From, q.To)
+	if err != nil {
+		r.logger.Printf("Failed to fetch %s time series: %v", t.name, err)
+		return nil, fmt.Errorf("failed to get %s time series: %w", t.name, err)
+	}
+	defer rows.Close()
+
+	var points []*models.TimeSeriesPoint
+	for rows.Next() {
+		var p models.TimeSeriesPoint
+		if err := rows.Scan(&p.BucketStart, &p.Likes, &p.Dislikes, &p.Purchases, &p.Revenue); err != nil {
+			r.logger.Printf("Failed to scan %s time series point: %v", t.name, err)
+			return nil, fmt.Errorf("failed to scan %s time series point: %w", t.name, err)
+		}
+		points = append(points, &p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get %s time series: %w", t.name, err)
+	}
+	r.logger.Printf("Successfully fetched %d time series points of %s ID: %d", len(points), t.name, id)
+	return points, nil
+}
+
+// RollupHourly moves hourly rows older than before into the daily tables. Rows
+// are deleted and summed in one statement, so no bucket is counted in both.
+func (r *analyticsRepository) RollupHourly(ctx context.Context, before time.Time) (int64, error) {
+	r.logger.Printf("Rolling up hourly analytics before %s", before.Format(time.RFC3339))
+	var total int64
+	err := r.WithinTx(ctx, func(ctx context.Context) error {
+		for _, t := range []seriesTables{productSeries, userSeries} {
+			query := fmt.Sprintf(`
+            WITH moved AS (
+                DELETE FROM %[1]s
+                WHERE bucket_start < $1
+                RETURNING %[3]s, bucket_start, likes, dislikes, purchases, revenue
+            ), inserted AS (
+                INSERT INTO %[2]s (%[3]s, bucket_start, likes, dislikes, purchases, revenue)
+                SELECT %[3]s, date_trunc('day', bucket_start), SUM(likes), SUM(dislikes), SUM(purchases), SUM(revenue)
+                FROM moved
+                GROUP BY 1, 2
+                ON CONFLICT (%[3]s, bucket_start)
+                DO UPDATE SET likes = %[2]s.likes + EXCLUDED.likes,
+                              dislikes = %[2]s.dislikes + EXCLUDED.dislikes,
+                              purchases = %[2]s.purchases + EXCLUDED.purchases,
+                              revenue = %[2]s.revenue + EXCLUDED.revenue
+            )
+            SELECT COUNT(*) FROM moved
+        `, t.hourly, t.daily, t.idColumn)
+			var moved int64
+			if err := r.db.Conn(ctx).QueryRow(ctx, query, before).Scan(&moved); err != nil {
+				r.logger.Printf("Failed to roll up %s analytics: %v", t.name, err)
+				return fmt.Errorf("failed to roll up %s analytics: %w", t.name, err)
+			}
+			total += moved
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	r.logger.Printf("Successfully rolled up %d hourly analytics rows", total)
+	return total, nil
+}
+
+func (r *analyticsRepository) DeleteDailyBefore(ctx context.Context, before time.Time) (int64, error) {
+	r.logger.Printf("Deleting daily analytics before %s", before.Format(time.RFC3339))
+	var total int64
+	for _, t := range []seriesTables{productSeries, userSeries, categoryRevenueSeries} {
+		query := fmt.Sprintf(`DELETE FROM %s WHERE bucket_start < $1`, t.daily)
+		cmdTag, err := r.db.Conn(ctx).Exec(ctx, query, before)
+		if err != nil {
+			r.logger.Printf("Failed to delete daily %s analytics: %v", t.name, err)
+			return 0, fmt.Errorf("failed to delete daily %s analytics: %w", t.name, err)
+		}
+		total += cmdTag.RowsAffected()
+	}
+	r.logger.Printf("Successfully deleted %d daily analytics rows", total)
+	return total, nil
+}
+
+// GetRevenue returns the non-empty days in [q.From, q.To) of one category, or
+// summed over all categories.
+func (r *analyticsRepository) GetRevenue(ctx context.Context, q models.RevenueQuery) ([]*models.RevenuePoint, error) {
+	r.logger.Printf("Fetching revenue of category %q from %s to %s", q.Category, q.From.Format(time.RFC3339), q.To.Format(time.RFC3339))
+	query := `
+        SELECT bucket_start, SUM(purchases), SUM(revenue)::float8
+        FROM category_revenue_daily
+        WHERE ($1 = '' OR category = $1) AND bucket_start >= $2 AND bucket_start < $3
+        GROUP BY bucket_start
+        ORDER BY bucket_start
+    `
+	rows, err := r.db.Conn(ctx).Query(ctx, query, q.Category, q.From, q.To)
+	if err != nil {
+		r.logger.Printf("Failed to fetch revenue: %v", err)
+		return nil, fmt.Errorf("failed to get revenue: %w", err)
+	}
+	defer rows.Close()
+
+	var points []*models.RevenuePoint
+	for rows.Next() {
+		var p models.RevenuePoint
+		if err := rows.Scan(&p.BucketStart, &p.Purchases, &p.Revenue); err != nil {
+			r.logger.Printf("Failed to scan revenue point: %v", err)
+			return nil, fmt.Errorf("failed to scan revenue point: %w", err)
+		}
+		points = append(points, &p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get revenue: %w", err)
+	}
+	r.logger.Printf("Successfully fetched %d revenue points of category %q", len(points), q.Category)
+	return points, nil
+}
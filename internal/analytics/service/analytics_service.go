@@ -2,127 +2,532 @@ package service
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
 	log "recommendation-system/pkg/logger"
+	"time"
 
 	"recommendation-system/internal/analytics/models"
 	"recommendation-system/internal/analytics/repository"
+	"recommendation-system/pkg/events"
+	"recommendation-system/pkg/export"
 	"recommendation-system/pkg/kafka"
+	"recommendation-system/pkg/redis"
+	"recommendation-system/pkg/trending"
 
 	kafka_go "github.com/segmentio/kafka-go"
 )
 
 type AnalyticsService interface {
 	ProcessKafkaMessage(ctx context.Context, message kafka_go.Message) error
+	ProcessKafkaBatch(ctx context.Context, messages []kafka_go.Message) error
 	GetProductAnalytics(ctx context.Context, productID int64) (*models.ProductAnalytics, error)
 	GetUserAnalytics(ctx context.Context, userID int64) (*models.UserAnalytics, error)
+	GetTrendingProducts(ctx context.Context, category string, limit int) ([]*models.TrendingProduct, error)
+	GetRevenue(ctx context.Context, q models.RevenueQuery) (*models.RevenueSeries, error)
+	GetCategoryAnalytics(ctx context.Context, category string) (*models.CategoryAnalytics, error)
+	ListCategoryAnalytics(ctx context.Context) ([]*models.CategoryAnalytics, error)
+	GetProductFunnel(ctx context.Context, productID int64) (*models.Funnel, error)
+	GetCategoryFunnel(ctx context.Context, category string) (*models.Funnel, error)
+	PruneTrendingActivity(ctx context.Context) error
+	PruneProcessedEvents(ctx context.Context) error
+	GetProductTimeSeries(ctx context.Context, productID int64, q models.TimeSeriesQuery) (*models.TimeSeries, error)
+	GetUserTimeSeries(ctx context.Context, userID int64, q models.TimeSeriesQuery) (*models.TimeSeries, error)
+	RollupTimeSeries(ctx context.Context) error
+	GetProductLeaderboard(ctx context.Context, q models.LeaderboardQuery) ([]*models.LeaderboardEntry, error)
+	GetUserLeaderboard(ctx context.Context, q models.LeaderboardQuery) ([]*models.LeaderboardEntry, error)
+	ResetLeaderboards(ctx context.Context) error
+	PlanExport(ctx context.Context, q models.ExportQuery) (*models.ExportPlan, error)
+	Export(ctx context.Context, plan *models.ExportPlan, w export.Writer) (int64, error)
+	Reconcile(ctx context.Context, repair bool) (*models.ReconcileReport, error)
+	GetCohortRetention(ctx context.Context, q models.CohortQuery) (*models.CohortMatrix, error)
+}
+
+// TrendingConfig adds to the shared trending windows the size of the activity
+// buckets they are computed from and how long the buckets are kept.
+type TrendingConfig struct {
+	trending.Config
+	Bucket    time.Duration
+	Retention time.Duration
+}
+
+type Config struct {
+	Trending TrendingConfig
+	// ProcessedRetention is how long IDs of applied events are kept for
+	// deduplication. It must exceed the retention of the consumed topics.
+	ProcessedRetention time.Duration
+	TimeSeries         TimeSeriesConfig
+	// CategoryActiveWindow is how recently a user must have interacted with a
+	// category to count as one of its active users.
+	CategoryActiveWindow time.Duration
+	// ExportPageSize is the number of rows an export reads and flushes at a
+	// time.
+	ExportPageSize int
+	Reconcile      ReconcileConfig
+}
+
+// TimeSeriesConfig controls how long the hourly and daily buckets of product
+// and user analytics are kept. Hourly buckets older than HourlyRetention are
+// rolled up into daily ones; daily buckets older than DailyRetention are
+// deleted, unless it is zero. HourlyRetention is at least a day.
+type TimeSeriesConfig struct {
+	HourlyRetention time.Duration
+	DailyRetention  time.Duration
+}
+
+// ReconcileConfig controls the comparison of the lifetime counters with the
+// likes, dislikes and purchases tables. Products and users with activity in
+// the last Settle are skipped, as their events may not be applied yet. At most
+// ReportLimit discrepancies of each kind are listed in a report.
+//
+// Settle is the only guard of a repair: an event older than Settle that is
+// still waiting in the outbox or in Kafka is applied on top of the repaired
+// counter and counted twice. Repair must therefore only run while the
+// consumers are caught up.
+type ReconcileConfig struct {
+	Settle      time.Duration
+	ReportLimit int
+}
+
+// ProcessedEvents is the part of events.ProcessedStore used by the service.
+type ProcessedEvents interface {
+	MarkProcessed(ctx context.Context, eventID string) (bool, error)
+	MarkProcessedBatch(ctx context.Context, eventIDs []string) (map[string]bool, error)
+	DeleteProcessedBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+// RedisStore is the part of redis.RedisClient used for leaderboards and
+// distinct user counts.
+type RedisStore interface {
+	ZIncrBy(ctx context.Context, incrs []redis.ZIncr) error
+	ZUnionRevRange(ctx context.Context, keys []string, limit int) ([]redis.Z, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	ZReplace(ctx context.Context, key string, members []redis.Z, ttl time.Duration) error
+	ZScores(ctx context.Context, key string, members []string) ([]float64, error)
+	PFAddMany(ctx context.Context, adds []redis.PFAdd) error
+	PFCountMany(ctx context.Context, groups [][]string) ([]int64, error)
+	DeleteByPattern(ctx context.Context, pattern string) (int, error)
 }
 
 type analyticsService struct {
-	repo   repository.AnalyticsRepository
-	kafka  *kafka.KafkaClient
-	logger *log.Logger
+	repo      repository.AnalyticsRepository
+	processed ProcessedEvents
+	kafka     kafka.Publisher
+	redis     RedisStore
+	cfg       Config
+	logger    *log.Logger
 }
 
-func NewAnalyticsService(repo repository.AnalyticsRepository, kafkaClient *kafka.KafkaClient, logger *log.Logger) AnalyticsService {
+func NewAnalyticsService(repo repository.AnalyticsRepository, processed ProcessedEvents, kafkaClient kafka.Publisher, redisClient RedisStore, cfg Config, logger *log.Logger) AnalyticsService {
+	cfg.Trending.Config = cfg.Trending.Config.WithDefaults()
+	if cfg.Trending.Bucket <= 0 || cfg.Trending.Bucket > cfg.Trending.Window {
+		cfg.Trending.Bucket = 5 * time.Minute
+	}
+	if cfg.Trending.Retention < cfg.Trending.Baseline {
+		cfg.Trending.Retention = 2 * cfg.Trending.Baseline
+	}
+	if cfg.ProcessedRetention <= 0 {
+		cfg.ProcessedRetention = 7 * 24 * time.Hour
+	}
+	if cfg.TimeSeries.HourlyRetention <= 0 {
+		cfg.TimeSeries.HourlyRetention = 7 * 24 * time.Hour
+	} else if cfg.TimeSeries.HourlyRetention < 24*time.Hour {
+		// Hours are rolled up into days only once the day is over, so they
+		// must be kept for at least a day.
+		cfg.TimeSeries.HourlyRetention = 24 * time.Hour
+	}
+	if cfg.CategoryActiveWindow <= 0 {
+		cfg.CategoryActiveWindow = 30 * 24 * time.Hour
+	}
+	if cfg.ExportPageSize <= 0 {
+		cfg.ExportPageSize = 5000
+	}
+	if cfg.Reconcile.Settle <= 0 {
+		cfg.Reconcile.Settle = 10 * time.Minute
+	}
+	if cfg.Reconcile.ReportLimit <= 0 {
+		cfg.Reconcile.ReportLimit = 100
+	}
 	return &analyticsService{
-		repo:   repo,
-		kafka:  kafkaClient,
-		logger: logger,
+		repo:      repo,
+		processed: processed,
+		kafka:     kafkaClient,
+		redis:     redisClient,
+		cfg:       cfg,
+		logger:    logger,
 	}
 }
 
 func (s *analyticsService) ProcessKafkaMessage(ctx context.Context, m kafka_go.Message) error {
-	s.logger.Println("Processing Kafka message...")
+	return s.ProcessKafkaBatch(ctx, []kafka_go.Message{m})
+}
+
+// ProcessKafkaBatch applies the views, likes, dislikes and purchases of the
+// messages in one transaction: the events are deduplicated with a single
+// statement and their increments are summed per product, user, category and
+// time bucket before being written. Product events update the category copy
+// first, so interactions are counted in the category a product has when they
+// are processed; a re-categorized product keeps its past counts in the old
+// category. Registrations assign users to the cohort of their registration
+// week. A message that cannot be decoded or does not match its schema fails
+// the whole batch, so the consumer falls back to handling the messages one by
+// one and quarantines only the broken one. The leaderboards and distinct user
+// counts are updated once the transaction is committed.
+func (s *analyticsService) ProcessKafkaBatch(ctx context.Context, messages []kafka_go.Message) error {
+	s.logger.Printf("Processing batch of %d Kafka messages...", len(messages))
 
-	var msg map[string]interface{}
-	if err := json.Unmarshal(m.Value, &msg); err != nil {
-		s.logger.Printf("Failed to unmarshal message: %v", err)
-		return fmt.Errorf("failed to unmarshal message: %w", err)
+	var (
+		eventIDs     []string
+		interactions = make(map[string]*interaction)
+		products     []*models.ProductCategory
+		cohorts      []*models.UserCohort
+	)
+	for _, m := range messages {
+		env, err := events.DecodeMessage(m)
+		if err != nil {
+			s.logger.Printf("Failed to decode message: %v", err)
+			return kafka.Quarantine(fmt.Errorf("failed to decode message: %w", err))
+		}
+		if err := events.Validate(env); err != nil {
+			s.logger.Printf("Invalid event %s: %v", env.ID, err)
+			return kafka.Quarantine(err)
+		}
+
+		s.logger.Printf("Event type: %s, version: %d, ID: %s", env.Type, env.Version, env.ID)
+
+		switch env.Type {
+		case events.UserLiked, events.UserDisliked, events.UserPurchased, events.UserViewed:
+			in, err := decodeInteraction(env)
+			if err != nil {
+				s.logger.Printf("Parse error: %v", err)
+				return kafka.Quarantine(err)
+			}
+			eventID := events.MessageID(env, m.Topic, m.Partition, m.Offset)
+			if _, ok := interactions[eventID]; !ok {
+				eventIDs = append(eventIDs, eventID)
+				interactions[eventID] = in
+			}
+
+		case events.ProductCreated, events.ProductUpdated:
+			// Both events carry the whole product.
+			var e events.ProductUpdatedEvent
+			if err := env.DecodeData(&e); err != nil {
+				s.logger.Printf("Parse error: %v", err)
+				return kafka.Quarantine(err)
+			}
+			products = append(products, &models.ProductCategory{
+				ProductID: e.Product.ID,
+				Category:  e.Product.Category,
+				UpdatedAt: occurredAt(e.Product.UpdatedAt).UTC(),
+			})
+
+		case events.ProductDeleted:
+			// The category is kept for interactions still in flight.
+			s.logger.Printf("[INFO] Product event: %s", env.Type)
+
+		case events.UserCreated:
+			var e events.UserCreatedEvent
+			if err := env.DecodeData(&e); err != nil {
+				s.logger.Printf("Parse error: %v", err)
+				return kafka.Quarantine(err)
+			}
+			cohorts = append(cohorts, &models.UserCohort{
+				UserID:       e.User.ID,
+				RegisteredAt: occurredAt(e.User.CreatedAt).UTC(),
+			})
+
+		case events.UserUpdated:
+			s.logger.Printf("[INFO] User event: %s", env.Type)
+
+		default:
+			s.logger.Printf("[WARN] Unhandled event type: %s", env.Type)
+		}
 	}
 
-	event, ok := msg["event"].(string)
-	if !ok {
-		s.logger.Println("Event type missing or invalid in message")
-		return errors.New("event type missing or invalid")
+	if len(products) > 0 {
+		if err := s.repo.UpsertProductCategories(ctx, products); err != nil {
+			s.logger.Printf("Failed to update product categories: %v", err)
+			return err
+		}
 	}
 
-	s.logger.Printf("Event type: %s", event)
+	if len(cohorts) > 0 {
+		if err := s.repo.UpsertUserCohorts(ctx, cohorts); err != nil {
+			s.logger.Printf("Failed to update user cohorts: %v", err)
+			return err
+		}
+	}
 
-	switch event {
-	case "user_liked":
-		s.logger.Println("Handling 'user_liked' event")
-		userID, productID, err := parseUserAndProductID(msg)
+	if len(eventIDs) > 0 {
+		categories, err := s.interactionCategories(ctx, interactions)
 		if err != nil {
-			s.logger.Printf("Parse error: %v", err)
-			return nil
-		}
-		if err := s.repo.IncrementProductLikes(ctx, productID); err != nil {
-			s.logger.Printf("Failed to increment product likes: %v", err)
-		}
-		if err := s.repo.IncrementUserLikes(ctx, userID); err != nil {
-			s.logger.Printf("Failed to increment user likes: %v", err)
+			s.logger.Printf("Failed to fetch categories of products: %v", err)
+			return err
 		}
 
-	case "user_disliked":
-		s.logger.Println("Handling 'user_disliked' event")
-		userID, productID, err := parseUserAndProductID(msg)
+		var applied []*interaction
+		err = s.repo.WithinTx(ctx, func(ctx context.Context) error {
+			applied = applied[:0]
+			first, err := s.processed.MarkProcessedBatch(ctx, eventIDs)
+			if err != nil {
+				s.logger.Printf("Failed to mark events as processed: %v", err)
+				return err
+			}
+
+			inc := models.NewAnalyticsIncrements()
+			for _, eventID := range eventIDs {
+				if !first[eventID] {
+					s.logger.Printf("Event %s already processed, skipping", eventID)
+					continue
+				}
+				in := interactions[eventID]
+				s.addInteraction(inc, in, categories)
+				applied = append(applied, in)
+			}
+			if inc.Empty() {
+				return nil
+			}
+			return s.repo.ApplyIncrements(ctx, inc)
+		})
 		if err != nil {
-			s.logger.Printf("Parse error: %v", err)
-			return nil
+			return err
 		}
-		if err := s.repo.IncrementProductDislikes(ctx, productID); err != nil {
-			s.logger.Printf("Failed to increment product dislikes: %v", err)
+		s.updateLeaderboards(ctx, applied, categories)
+		s.updateDistinctUsers(ctx, applied)
+	}
+
+	s.logger.Println("Kafka batch processing completed")
+	return nil
+}
+
+// interaction is a decoded like, dislike, purchase or view.
+type interaction struct {
+	eventType string
+	userID    int64
+	productID int64
+	price     float64
+	at        time.Time
+}
+
+func decodeInteraction(env *events.Envelope) (*interaction, error) {
+	in := &interaction{eventType: env.Type}
+	switch env.Type {
+	case events.UserLiked:
+		var e events.UserLikedEvent
+		if err := env.DecodeData(&e); err != nil {
+			return nil, err
 		}
-		if err := s.repo.IncrementUserDislikes(ctx, userID); err != nil {
-			s.logger.Printf("Failed to increment user dislikes: %v", err)
+		in.userID, in.productID, in.at = e.UserID, e.ProductID, e.LikedAt
+
+	case events.UserDisliked:
+		var e events.UserDislikedEvent
+		if err := env.DecodeData(&e); err != nil {
+			return nil, err
 		}
+		in.userID, in.productID, in.at = e.UserID, e.ProductID, e.DislikedAt
 
-	case "user_purchased":
-		s.logger.Println("Handling 'user_purchased' event")
-		userID, productID, err := parseUserAndProductID(msg)
-		if err != nil {
-			s.logger.Printf("Parse error: %v", err)
-			return nil
+	case events.UserPurchased:
+		var e events.UserPurchasedEvent
+		if err := env.DecodeData(&e); err != nil {
+			return nil, err
 		}
-		if err := s.repo.IncrementProductPurchases(ctx, productID); err != nil {
-			s.logger.Printf("Failed to increment product purchases: %v", err)
+		in.userID, in.productID, in.price, in.at = e.UserID, e.ProductID, e.Price, e.PurchasedAt
+
+	case events.UserViewed:
+		var e events.UserViewedEvent
+		if err := env.DecodeData(&e); err != nil {
+			return nil, err
 		}
-		if err := s.repo.IncrementUserPurchases(ctx, userID); err != nil {
-			s.logger.Printf("Failed to increment user purchases: %v", err)
+		in.userID, in.productID, in.at = e.UserID, e.ProductID, e.ViewedAt
+	}
+	in.at = occurredAt(in.at)
+	return in, nil
+}
+
+// addInteraction adds the counters of a like, dislike, purchase or view to
+// inc. Views are only counted per product, for the conversion funnel.
+// Interactions with products missing from categories are not counted in any
+// category.
+func (s *analyticsService) addInteraction(inc *models.AnalyticsIncrements, in *interaction, categories map[int64]string) {
+	inc.UserWeek(in.userID, weekBucket(in.at))
+	category, hasCategory := categories[in.productID]
+	if hasCategory && in.eventType != events.UserViewed {
+		inc.CategoryUser(category, in.userID, in.at)
+	}
+
+	switch in.eventType {
+	case events.UserLiked:
+		inc.Product(in.productID).Likes++
+		inc.User(in.userID).Likes++
+		inc.ProductActivity(in.productID, s.activityBucket(in.at)).Likes++
+		inc.ProductHour(in.productID, hourBucket(in.at)).Likes++
+		inc.UserHour(in.userID, hourBucket(in.at)).Likes++
+		if hasCategory {
+			inc.Category(category).Likes++
 		}
 
-	case "product_created", "product_updated":
-		s.logger.Printf("[INFO] Product event: %s", event)
+	case events.UserDisliked:
+		inc.Product(in.productID).Dislikes++
+		inc.User(in.userID).Dislikes++
+		inc.ProductHour(in.productID, hourBucket(in.at)).Dislikes++
+		inc.UserHour(in.userID, hourBucket(in.at)).Dislikes++
+		if hasCategory {
+			inc.Category(category).Dislikes++
+		}
 
-	case "user_created", "user_updated":
-		s.logger.Printf("[INFO] User event: %s", event)
+	case events.UserPurchased:
+		for _, c := range []*models.Counts{
+			inc.Product(in.productID),
+			inc.User(in.userID),
+			inc.ProductHour(in.productID, hourBucket(in.at)),
+			inc.UserHour(in.userID, hourBucket(in.at)),
+		} {
+			c.Purchases++
+			c.Revenue += in.price
+		}
+		inc.ProductActivity(in.productID, s.activityBucket(in.at)).Purchases++
+		if hasCategory {
+			inc.Category(category).Purchases++
+		}
+		// Revenue of products without a known category is kept under the
+		// empty category, so the total over all categories is complete.
+		c := inc.CategoryDay(category, dayBucket(in.at))
+		c.Purchases++
+		c.Revenue += in.price
 
-	default:
-		s.logger.Printf("[WARN] Unhandled event type: %s", event)
+	case events.UserViewed:
+		inc.Product(in.productID).Views++
 	}
-
-	s.logger.Println("Kafka message processing completed")
-	return nil
 }
 
-func parseUserAndProductID(msg map[string]interface{}) (int64, int64, error) {
-	u, ok1 := msg["user_id"].(float64)
-	p, ok2 := msg["product_id"].(float64)
-	if !ok1 || !ok2 {
-		return 0, 0, fmt.Errorf("failed to parse user_id or product_id")
+// interactionCategories looks up the current categories of the products that
+// were liked, disliked or purchased.
+func (s *analyticsService) interactionCategories(ctx context.Context, interactions map[string]*interaction) (map[int64]string, error) {
+	var productIDs []int64
+	for _, in := range interactions {
+		if in.eventType != events.UserViewed {
+			productIDs = append(productIDs, in.productID)
+		}
+	}
+	if len(productIDs) == 0 {
+		return nil, nil
 	}
-	return int64(u), int64(p), nil
+	return s.repo.GetProductCategories(ctx, productIDs)
 }
 
 func (s *analyticsService) GetProductAnalytics(ctx context.Context, productID int64) (*models.ProductAnalytics, error) {
 	s.logger.Printf("Fetching analytics for product ID: %d", productID)
-	return s.repo.GetProductAnalytics(ctx, productID)
+	pa, err := s.repo.GetProductAnalytics(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	// The distinct user counts are approximate extras: without Redis the
+	// counters are still returned.
+	if pa.DistinctUsers, err = s.getDistinctUsers(ctx, productID); err != nil {
+		s.logger.Printf("Failed to fetch distinct user counts for product ID: %d, error: %v", productID, err)
+	}
+	return pa, nil
 }
 
 func (s *analyticsService) GetUserAnalytics(ctx context.Context, userID int64) (*models.UserAnalytics, error) {
 	s.logger.Printf("Fetching analytics for user ID: %d", userID)
-	return s.repo.GetUserAnalytics(ctx, userID)
+	ua, err := s.repo.GetUserAnalytics(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	ua.AverageOrderValue = averageOrderValue(ua.LifetimeValue, ua.TotalPurchases)
+	return ua, nil
+}
+
+func averageOrderValue(revenue float64, purchases int) float64 {
+	if purchases == 0 {
+		return 0
+	}
+	return revenue / float64(purchases)
+}
+
+func (s *analyticsService) GetCategoryAnalytics(ctx context.Context, category string) (*models.CategoryAnalytics, error) {
+	s.logger.Printf("Fetching analytics for category: %q", category)
+	return s.repo.GetCategoryAnalytics(ctx, category, time.Now().UTC().Add(-s.cfg.CategoryActiveWindow))
+}
+
+func (s *analyticsService) ListCategoryAnalytics(ctx context.Context) ([]*models.CategoryAnalytics, error) {
+	s.logger.Println("Fetching analytics of all categories")
+	return s.repo.ListCategoryAnalytics(ctx, time.Now().UTC().Add(-s.cfg.CategoryActiveWindow))
+}
+
+func (s *analyticsService) GetProductFunnel(ctx context.Context, productID int64) (*models.Funnel, error) {
+	s.logger.Printf("Fetching funnel for product ID: %d", productID)
+	f, err := s.repo.GetProductFunnel(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	return withConversionRates(f), nil
+}
+
+func (s *analyticsService) GetCategoryFunnel(ctx context.Context, category string) (*models.Funnel, error) {
+	s.logger.Printf("Fetching funnel for category: %q", category)
+	f, err := s.repo.GetCategoryFunnel(ctx, category)
+	if err != nil {
+		return nil, err
+	}
+	return withConversionRates(f), nil
+}
+
+func withConversionRates(f *models.Funnel) *models.Funnel {
+	f.ViewToLike = ratio(f.Likes, f.Views)
+	f.LikeToPurchase = ratio(f.Purchases, f.Likes)
+	f.ViewToPurchase = ratio(f.Purchases, f.Views)
+	return f
+}
+
+func ratio(n, d int) float64 {
+	if d == 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
+
+func (s *analyticsService) activityBucket(t time.Time) time.Time {
+	return t.UTC().Truncate(s.cfg.Trending.Bucket)
+}
+
+func hourBucket(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Hour)
+}
+
+func dayBucket(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+// occurredAt is the time an interaction happened, so that redelivered and
+// replayed events land in their original activity bucket. Legacy events
+// without a timestamp fall back to now.
+func occurredAt(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Now()
+	}
+	return t
+}
+
+func (s *analyticsService) GetTrendingProducts(ctx context.Context, category string, limit int) ([]*models.TrendingProduct, error) {
+	s.logger.Printf("Fetching trending products for category: %q", category)
+	var categories []string
+	if category != "" {
+		categories = []string{category}
+	}
+	return s.repo.GetTrendingProducts(ctx, s.cfg.Trending.Query(time.Now(), categories, limit))
+}
+
+func (s *analyticsService) PruneTrendingActivity(ctx context.Context) error {
+	before := time.Now().UTC().Add(-s.cfg.Trending.Retention)
+	s.logger.Printf("Pruning product activity older than %s", before.Format(time.RFC3339))
+	_, err := s.repo.DeleteProductActivityBefore(ctx, before)
+	return err
+}
+
+func (s *analyticsService) PruneProcessedEvents(ctx context.Context) error {
+	before := time.Now().UTC().Add(-s.cfg.ProcessedRetention)
+	s.logger.Printf("Pruning processed events older than %s", before.Format(time.RFC3339))
+	_, err := s.processed.DeleteProcessedBefore(ctx, before)
+	return err
 }
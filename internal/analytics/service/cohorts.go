@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"recommendation-system/internal/analytics/models"
+)
+
+var ErrInvalidCohortQuery = errors.New("invalid cohort query")
+
+const (
+	cohortWeek         = 7 * 24 * time.Hour
+	defaultCohortWeeks = 12
+	// maxCohortWeeks bounds both the number of cohorts and the number of
+	// weeks of retention of one request.
+	maxCohortWeeks = 104
+)
+
+// weekBucket is the start of the week of t, on Monday at midnight UTC, as in
+// PostgreSQL's date_trunc('week', ...).
+func weekBucket(t time.Time) time.Time {
+	day := dayBucket(t)
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+// GetCohortRetention groups the users who registered in the weeks of
+// [q.From, q.To) by registration week and computes, for each week since, the
+// share of them who interacted in it.
+func (s *analyticsService) GetCohortRetention(ctx context.Context, q models.CohortQuery) (*models.CohortMatrix, error) {
+	s.logger.Printf("Fetching cohort retention from %s to %s", q.From, q.To)
+	q, err := normalizeCohortQuery(q)
+	if err != nil {
+		return nil, err
+	}
+
+	sizes, err := s.repo.GetCohortSizes(ctx, q.From, q.To)
+	if err != nil {
+		return nil, err
+	}
+	activity, err := s.repo.GetCohortActivity(ctx, q.From, q.To, q.Weeks)
+	if err != nil {
+		return nil, err
+	}
+
+	matrix := &models.CohortMatrix{From: q.From, To: q.To, Weeks: q.Weeks}
+	byWeek := make(map[time.Time]*models.Cohort)
+	current := weekBucket(time.Now())
+	for w := q.From; w.Before(q.To); w = w.Add(cohortWeek) {
+		// Weeks that have not started yet are left out.
+		n := int(current.Sub(w)/cohortWeek) + 1
+		if n > q.Weeks {
+			n = q.Weeks
+		}
+		if n < 0 {
+			n = 0
+		}
+		c := &models.Cohort{Week: w, Users: sizes[w], Retained: make([]int, n), Retention: make([]float64, n)}
+		byWeek[w] = c
+		matrix.Cohorts = append(matrix.Cohorts, c)
+	}
+	for _, a := range activity {
+		if c := byWeek[a.Week]; c != nil && a.Offset < len(c.Retained) {
+			c.Retained[a.Offset] = a.Users
+		}
+	}
+	for _, c := range matrix.Cohorts {
+		for i, retained := range c.Retained {
+			c.Retention[i] = ratio(retained, c.Users)
+		}
+	}
+	return matrix, nil
+}
+
+// normalizeCohortQuery snaps the range to whole weeks, To rounded up so that
+// the cohort of the week containing it is included, and defaults to the last
+// 12 cohorts with 12 weeks of retention.
+func normalizeCohortQuery(q models.CohortQuery) (models.CohortQuery, error) {
+	if q.Weeks == 0 {
+		q.Weeks = defaultCohortWeeks
+	}
+	if q.Weeks < 1 || q.Weeks > maxCohortWeeks {
+		return q, ErrInvalidCohortQuery
+	}
+	if q.To.IsZero() {
+		q.To = time.Now()
+	}
+	q.To = weekBucket(q.To.Add(-time.Nanosecond)).Add(cohortWeek)
+	if q.From.IsZero() {
+		q.From = q.To.Add(-defaultCohortWeeks * cohortWeek)
+	}
+	q.From = weekBucket(q.From)
+	if !q.From.Before(q.To) || q.To.Sub(q.From) > maxCohortWeeks*cohortWeek {
+		return q, ErrInvalidCohortQuery
+	}
+	return q, nil
+}
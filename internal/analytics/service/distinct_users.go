@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"recommendation-system/internal/analytics/models"
+	"recommendation-system/pkg/events"
+	"recommendation-system/pkg/redis"
+)
+
+// Distinct users are Redis HyperLogLogs per action, product and UTC day:
+//
+//	hll:<liked|purchased>:<product>:<day>
+//
+// The weekly count is the PFCOUNT of the last 7 day keys, which estimates the
+// size of their union with a standard error of 0.81%. Day keys expire once
+// they fall out of the week.
+const (
+	distinctUsersPrefix    = "hll:"
+	distinctUsersLiked     = "liked"
+	distinctUsersPurchased = "purchased"
+	distinctUsersDays      = 7
+)
+
+func distinctUsersKey(action string, productID int64, day time.Time) string {
+	return distinctUsersPrefix + action + ":" + strconv.FormatInt(productID, 10) + ":" + day.Format(time.DateOnly)
+}
+
+// updateDistinctUsers adds the users of applied likes and purchases to the
+// HyperLogLogs. Like the leaderboards they are updated after the transaction
+// and a failure is only logged; adding a user twice does not change a count,
+// so replaying events is harmless.
+func (s *analyticsService) updateDistinctUsers(ctx context.Context, interactions []*interaction) {
+	members := make(map[string][]string)
+	expireAt := make(map[string]time.Time)
+	var keys []string
+	for _, in := range interactions {
+		var action string
+		switch in.eventType {
+		case events.UserLiked:
+			action = distinctUsersLiked
+		case events.UserPurchased:
+			action = distinctUsersPurchased
+		default:
+			continue
+		}
+		day := in.at.UTC().Truncate(24 * time.Hour)
+		key := distinctUsersKey(action, in.productID, day)
+		if _, ok := members[key]; !ok {
+			keys = append(keys, key)
+			expireAt[key] = day.Add((distinctUsersDays + 1) * 24 * time.Hour)
+		}
+		members[key] = append(members[key], strconv.FormatInt(in.userID, 10))
+	}
+	if len(keys) == 0 {
+		return
+	}
+
+	adds := make([]redis.PFAdd, len(keys))
+	for i, key := range keys {
+		adds[i] = redis.PFAdd{Key: key, Members: members[key], ExpireAt: expireAt[key]}
+	}
+	if err := s.redis.PFAddMany(ctx, adds); err != nil {
+		s.logger.Printf("Failed to update distinct user counts: %v", err)
+		return
+	}
+	s.logger.Printf("Updated %d distinct user counts", len(adds))
+}
+
+func (s *analyticsService) getDistinctUsers(ctx context.Context, productID int64) (*models.DistinctUsers, error) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	week := func(action string) []string {
+		keys := make([]string, distinctUsersDays)
+		for i := range keys {
+			keys[i] = distinctUsersKey(action, productID, today.AddDate(0, 0, -i))
+		}
+		return keys
+	}
+	counts, err := s.redis.PFCountMany(ctx, [][]string{
+		{distinctUsersKey(distinctUsersLiked, productID, today)},
+		week(distinctUsersLiked),
+		{distinctUsersKey(distinctUsersPurchased, productID, today)},
+		week(distinctUsersPurchased),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &models.DistinctUsers{
+		LikedDay:      counts[0],
+		LikedWeek:     counts[1],
+		PurchasedDay:  counts[2],
+		PurchasedWeek: counts[3],
+	}, nil
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"recommendation-system/internal/analytics/models"
+	"recommendation-system/internal/analytics/repository"
+	"recommendation-system/pkg/export"
+)
+
+var ErrInvalidExport = repository.ErrInvalidExport
+
+// PlanExport validates an export and, when it is limited to a chunk, finds
+// where the chunk ends, so that the cursor of the next chunk is known before
+// any row is written.
+func (s *analyticsService) PlanExport(ctx context.Context, q models.ExportQuery) (*models.ExportPlan, error) {
+	s.logger.Printf("Planning export of %s", q.Dataset)
+	columns, key, err := s.repo.ExportSchema(q.Dataset)
+	if err != nil {
+		return nil, err
+	}
+	if q.Limit < 0 {
+		return nil, fmt.Errorf("%w: limit must not be negative", ErrInvalidExport)
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && !q.From.Before(q.To) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidExport)
+	}
+
+	// The time columns are TIMESTAMP in UTC, which ignore the offset of a
+	// parameter, so the bounds are compared in UTC.
+	if !q.From.IsZero() {
+		q.From = q.From.UTC()
+	}
+	if !q.To.IsZero() {
+		q.To = q.To.UTC()
+	}
+
+	plan := &models.ExportPlan{Query: q, Columns: columns, Key: key}
+	if q.Cursor != "" {
+		if plan.After, err = decodeExportCursor(q.Cursor, columns, key); err != nil {
+			return nil, err
+		}
+	}
+	if q.Limit == 0 {
+		return plan, nil
+	}
+
+	until, more, err := s.repo.ExportChunkEnd(ctx, q, plan.After, q.Limit)
+	if err != nil {
+		return nil, err
+	}
+	if until == nil {
+		// No row is left after the cursor. Rows added before the export runs
+		// must not be exported past the limit, so the chunk is empty.
+		plan.Empty = true
+		return plan, nil
+	}
+	plan.Until = until
+	if more {
+		plan.NextCursor = encodeExportCursor(until)
+	}
+	return plan, nil
+}
+
+// Export writes the rows of a plan page by page, flushing the writer after
+// each page, and returns the number of rows written. It does not close the
+// writer.
+func (s *analyticsService) Export(ctx context.Context, plan *models.ExportPlan, w export.Writer) (int64, error) {
+	s.logger.Printf("Exporting %s", plan.Query.Dataset)
+	if plan.Empty {
+		s.logger.Printf("Exported 0 rows of %s", plan.Query.Dataset)
+		return 0, nil
+	}
+	var (
+		written int64
+		after   = plan.After
+	)
+	for {
+		rows, err := s.repo.ExportRows(ctx, plan.Query, after, plan.Until, s.cfg.ExportPageSize)
+		if err != nil {
+			return written, err
+		}
+		for _, row := range rows {
+			if err := w.Write(row); err != nil {
+				return written, fmt.Errorf("failed to write export row: %w", err)
+			}
+			written++
+		}
+		if err := w.Flush(); err != nil {
+			return written, fmt.Errorf("failed to flush export: %w", err)
+		}
+		if len(rows) < s.cfg.ExportPageSize {
+			break
+		}
+		last := rows[len(rows)-1]
+		after = make([]interface{}, len(plan.Key))
+		for i, k := range plan.Key {
+			after[i] = last[k]
+		}
+	}
+	s.logger.Printf("Exported %d rows of %s", written, plan.Query.Dataset)
+	return written, nil
+}
+
+// encodeExportCursor encodes the key of the last row of a chunk as URL safe
+// base64 of a JSON array of strings.
+func encodeExportCursor(key []interface{}) string {
+	values := make([]string, len(key))
+	for i, v := range key {
+		switch v := v.(type) {
+		case time.Time:
+			values[i] = v.UTC().Format(time.RFC3339Nano)
+		default:
+			values[i] = fmt.Sprint(v)
+		}
+	}
+	data, _ := json.Marshal(values)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeExportCursor(cursor string, columns []export.Column, key []int) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidExport)
+	}
+	var values []string
+	if err := json.Unmarshal(data, &values); err != nil || len(values) != len(key) {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidExport)
+	}
+
+	after := make([]interface{}, len(key))
+	for i, k := range key {
+		switch columns[k].Type {
+		case export.Int64:
+			after[i], err = strconv.ParseInt(values[i], 10, 64)
+		case export.Time:
+			var t time.Time
+			t, err = time.Parse(time.RFC3339Nano, values[i])
+			after[i] = t.UTC()
+		default:
+			after[i] = values[i]
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidExport)
+		}
+	}
+	return after, nil
+}
@@ -0,0 +1,343 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"recommendation-system/internal/analytics/models"
+	"recommendation-system/pkg/events"
+	"recommendation-system/pkg/redis"
+)
+
+var ErrInvalidLeaderboardQuery = errors.New("invalid leaderboard query")
+
+// Leaderboards are Redis sorted sets per board and UTC day, plus one all-time
+// set per board, each in a global and a per-category variant:
+//
+//	leaderboard:<board>:<day|all>[:<category>]
+//
+// A window of N days is the union of the sets of the last N days. Day sets
+// expire once they fall out of the longest window. The rating board is cached
+// per window and category under leaderboard:cache:<board>:<window>[:<category>].
+const (
+	leaderboardPrefix     = "leaderboard:"
+	leaderboardAllTime    = "all"
+	leaderboardMaxDays    = 30
+	defaultLeaderboardLen = 10
+	maxLeaderboardLen     = 100
+	// wilsonZ is the z-score of the 95% confidence level of the rating board.
+	wilsonZ           = 1.96
+	ratingCachePrefix = "cache:"
+	ratingCacheTTL    = time.Minute
+)
+
+var leaderboardWindows = map[string]int{
+	"1d":  1,
+	"7d":  7,
+	"30d": leaderboardMaxDays,
+	"all": 0,
+}
+
+func leaderboardKey(board, period, category string) string {
+	key := leaderboardPrefix + board + ":" + period
+	if category != "" {
+		key += ":" + category
+	}
+	return key
+}
+
+// updateLeaderboards adds applied interactions to the sorted sets. The sets
+// are derived data outside of the database transaction: a failure is logged and
+// the interactions are not retried, so the boards are approximate and can be
+// rebuilt with the replay tool. Views are not ranked.
+func (s *analyticsService) updateLeaderboards(ctx context.Context, interactions []*interaction, categories map[int64]string) {
+	var applied []*interaction
+	for _, in := range interactions {
+		if in.eventType != events.UserViewed {
+			applied = append(applied, in)
+		}
+	}
+	if len(applied) == 0 {
+		return
+	}
+
+	var incrs []redis.ZIncr
+	add := func(board, member string, day time.Time, category string) {
+		dayKey := day.Format(time.DateOnly)
+		expireAt := day.Add((leaderboardMaxDays + 1) * 24 * time.Hour)
+		scopes := []string{""}
+		if category != "" {
+			scopes = append(scopes, category)
+		}
+		for _, c := range scopes {
+			incrs = append(incrs,
+				redis.ZIncr{Key: leaderboardKey(board, dayKey, c), Member: member, Increment: 1, ExpireAt: expireAt},
+				redis.ZIncr{Key: leaderboardKey(board, leaderboardAllTime, c), Member: member, Increment: 1},
+			)
+		}
+	}
+	for _, in := range applied {
+		day := in.at.UTC().Truncate(24 * time.Hour)
+		category := categories[in.productID]
+		product := strconv.FormatInt(in.productID, 10)
+
+		switch in.eventType {
+		case events.UserLiked:
+			add(models.BoardLikes, product, day, category)
+		case events.UserDisliked:
+			add(models.BoardDislikes, product, day, category)
+		case events.UserPurchased:
+			add(models.BoardPurchases, product, day, category)
+		}
+		add(models.BoardActiveUsers, strconv.FormatInt(in.userID, 10), day, category)
+	}
+
+	if err := s.redis.ZIncrBy(ctx, incrs); err != nil {
+		s.logger.Printf("Failed to update leaderboards: %v", err)
+		return
+	}
+	s.logger.Printf("Updated leaderboards with %d interactions", len(applied))
+}
+
+func normalizeLeaderboardQuery(q models.LeaderboardQuery) (models.LeaderboardQuery, error) {
+	if q.Window == "" {
+		q.Window = "7d"
+	}
+	if _, ok := leaderboardWindows[q.Window]; !ok {
+		return q, ErrInvalidLeaderboardQuery
+	}
+	if q.Limit == 0 {
+		q.Limit = defaultLeaderboardLen
+	}
+	if q.Limit < 1 || q.Limit > maxLeaderboardLen {
+		return q, ErrInvalidLeaderboardQuery
+	}
+	return q, nil
+}
+
+func windowKeys(board, window, category string) []string {
+	days := leaderboardWindows[window]
+	if days == 0 {
+		return []string{leaderboardKey(board, leaderboardAllTime, category)}
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	keys := make([]string, days)
+	for i := range keys {
+		keys[i] = leaderboardKey(board, today.AddDate(0, 0, -i).Format(time.DateOnly), category)
+	}
+	return keys
+}
+
+// GetProductLeaderboard ranks products by likes, dislikes, purchases or by the
+// rating board, which orders them by the lower bound of the Wilson score
+// interval of their like ratio, so a few votes do not outrank many.
+func (s *analyticsService) GetProductLeaderboard(ctx context.Context, q models.LeaderboardQuery) ([]*models.LeaderboardEntry, error) {
+	s.logger.Printf("Fetching %s product leaderboard, category: %q, window: %s", q.Board, q.Category, q.Window)
+	q, err := normalizeLeaderboardQuery(q)
+	if err != nil {
+		return nil, err
+	}
+
+	switch q.Board {
+	case models.BoardLikes, models.BoardDislikes, models.BoardPurchases:
+		top, err := s.redis.ZUnionRevRange(ctx, windowKeys(q.Board, q.Window, q.Category), q.Limit)
+		if err != nil {
+			s.logger.Printf("Failed to fetch leaderboard: %v", err)
+			return nil, err
+		}
+		entries := make([]*models.LeaderboardEntry, 0, len(top))
+		for _, z := range top {
+			id, err := strconv.ParseInt(z.Member, 10, 64)
+			if err != nil {
+				continue
+			}
+			entries = append(entries, &models.LeaderboardEntry{Rank: len(entries) + 1, ProductID: id, Score: z.Score})
+		}
+		return entries, nil
+
+	case models.BoardRating:
+		return s.getRatingLeaderboard(ctx, q)
+	}
+	return nil, ErrInvalidLeaderboardQuery
+}
+
+// getRatingLeaderboard serves the rating board from sorted sets cached per
+// window and category: the order of the products and their likes and
+// dislikes. The window is summed and rated at most once per ratingCacheTTL, so
+// votes newer than the cache show up when it expires.
+func (s *analyticsService) getRatingLeaderboard(ctx context.Context, q models.LeaderboardQuery) ([]*models.LeaderboardEntry, error) {
+	orderKey := leaderboardKey(ratingCachePrefix+models.BoardRating, q.Window, q.Category)
+	likesKey := leaderboardKey(ratingCachePrefix+models.BoardLikes, q.Window, q.Category)
+	dislikesKey := leaderboardKey(ratingCachePrefix+models.BoardDislikes, q.Window, q.Category)
+
+	cached, err := s.redis.Exists(ctx, orderKey)
+	if err != nil {
+		s.logger.Printf("Failed to fetch leaderboard: %v", err)
+		return nil, err
+	}
+	if !cached {
+		if err := s.cacheRatingLeaderboard(ctx, q, orderKey, likesKey, dislikesKey); err != nil {
+			s.logger.Printf("Failed to fetch leaderboard: %v", err)
+			return nil, err
+		}
+	}
+
+	top, err := s.redis.ZUnionRevRange(ctx, []string{orderKey}, q.Limit)
+	if err != nil {
+		s.logger.Printf("Failed to fetch leaderboard: %v", err)
+		return nil, err
+	}
+	members := make([]string, len(top))
+	for i, z := range top {
+		members[i] = z.Member
+	}
+	likes, err := s.redis.ZScores(ctx, likesKey, members)
+	if err != nil {
+		s.logger.Printf("Failed to fetch leaderboard: %v", err)
+		return nil, err
+	}
+	dislikes, err := s.redis.ZScores(ctx, dislikesKey, members)
+	if err != nil {
+		s.logger.Printf("Failed to fetch leaderboard: %v", err)
+		return nil, err
+	}
+
+	entries := make([]*models.LeaderboardEntry, 0, len(members))
+	for i, member := range members {
+		id, err := strconv.ParseInt(member, 10, 64)
+		if err != nil {
+			continue
+		}
+		e := &models.LeaderboardEntry{Rank: len(entries) + 1, ProductID: id, Likes: int(likes[i]), Dislikes: int(dislikes[i])}
+		e.Score = wilsonLowerBound(e.Likes, e.Dislikes)
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// cacheRatingLeaderboard sums the likes and dislikes of the window, ranks the
+// products with rankByRating and caches the ranking as scores counting down
+// from the number of products, so that ZREVRANGE returns it in order.
+func (s *analyticsService) cacheRatingLeaderboard(ctx context.Context, q models.LeaderboardQuery, orderKey, likesKey, dislikesKey string) error {
+	likes, err := s.redis.ZUnionRevRange(ctx, windowKeys(models.BoardLikes, q.Window, q.Category), 0)
+	if err != nil {
+		return err
+	}
+	dislikes, err := s.redis.ZUnionRevRange(ctx, windowKeys(models.BoardDislikes, q.Window, q.Category), 0)
+	if err != nil {
+		return err
+	}
+
+	ranked := rankByRating(likes, dislikes)
+	order := make([]redis.Z, len(ranked))
+	for i, e := range ranked {
+		order[i] = redis.Z{Member: strconv.FormatInt(e.ProductID, 10), Score: float64(len(ranked) - i)}
+	}
+	// The counts are written first, so a cached order always has them.
+	if err := s.redis.ZReplace(ctx, likesKey, likes, ratingCacheTTL); err != nil {
+		return err
+	}
+	if err := s.redis.ZReplace(ctx, dislikesKey, dislikes, ratingCacheTTL); err != nil {
+		return err
+	}
+	return s.redis.ZReplace(ctx, orderKey, order, ratingCacheTTL)
+}
+
+// rankByRating orders the voted products by the lower bound of the Wilson
+// score interval of their like ratio, then by their number of votes and by
+// product ID.
+func rankByRating(likes, dislikes []redis.Z) []*models.LeaderboardEntry {
+	votes := make(map[int64]*models.LeaderboardEntry)
+	entry := func(member string) *models.LeaderboardEntry {
+		id, err := strconv.ParseInt(member, 10, 64)
+		if err != nil {
+			return nil
+		}
+		if votes[id] == nil {
+			votes[id] = &models.LeaderboardEntry{ProductID: id}
+		}
+		return votes[id]
+	}
+	for _, z := range likes {
+		if e := entry(z.Member); e != nil {
+			e.Likes = int(z.Score)
+		}
+	}
+	for _, z := range dislikes {
+		if e := entry(z.Member); e != nil {
+			e.Dislikes = int(z.Score)
+		}
+	}
+
+	entries := make([]*models.LeaderboardEntry, 0, len(votes))
+	for _, e := range votes {
+		e.Score = wilsonLowerBound(e.Likes, e.Dislikes)
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Score != entries[j].Score {
+			return entries[i].Score > entries[j].Score
+		}
+		if ni, nj := entries[i].Likes+entries[i].Dislikes, entries[j].Likes+entries[j].Dislikes; ni != nj {
+			return ni > nj
+		}
+		return entries[i].ProductID < entries[j].ProductID
+	})
+	for i, e := range entries {
+		e.Rank = i + 1
+	}
+	return entries
+}
+
+func wilsonLowerBound(positive, negative int) float64 {
+	n := float64(positive + negative)
+	if n == 0 {
+		return 0
+	}
+	p := float64(positive) / n
+	z2 := wilsonZ * wilsonZ
+	return (p + z2/(2*n) - wilsonZ*math.Sqrt((p*(1-p)+z2/(4*n))/n)) / (1 + z2/n)
+}
+
+// GetUserLeaderboard ranks users by their number of likes, dislikes and
+// purchases, counting only products of q.Category when it is set.
+func (s *analyticsService) GetUserLeaderboard(ctx context.Context, q models.LeaderboardQuery) ([]*models.LeaderboardEntry, error) {
+	s.logger.Printf("Fetching user leaderboard, category: %q, window: %s", q.Category, q.Window)
+	q, err := normalizeLeaderboardQuery(q)
+	if err != nil {
+		return nil, err
+	}
+
+	top, err := s.redis.ZUnionRevRange(ctx, windowKeys(models.BoardActiveUsers, q.Window, q.Category), q.Limit)
+	if err != nil {
+		s.logger.Printf("Failed to fetch leaderboard: %v", err)
+		return nil, err
+	}
+	entries := make([]*models.LeaderboardEntry, 0, len(top))
+	for _, z := range top {
+		id, err := strconv.ParseInt(z.Member, 10, 64)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, &models.LeaderboardEntry{Rank: len(entries) + 1, UserID: id, Score: z.Score})
+	}
+	return entries, nil
+}
+
+// ResetLeaderboards deletes every leaderboard, e.g. before the replay tool
+// rebuilds them from the source tables.
+func (s *analyticsService) ResetLeaderboards(ctx context.Context) error {
+	s.logger.Println("Deleting leaderboards")
+	deleted, err := s.redis.DeleteByPattern(ctx, leaderboardPrefix+"*")
+	if err != nil {
+		s.logger.Printf("Failed to delete leaderboards: %v", err)
+		return err
+	}
+	s.logger.Printf("Deleted %d leaderboard keys", deleted)
+	return nil
+}
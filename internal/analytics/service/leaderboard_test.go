@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"recommendation-system/internal/analytics/models"
+	log "recommendation-system/pkg/logger"
+	"recommendation-system/pkg/redis"
+)
+
+func TestWilsonLowerBound(t *testing.T) {
+	tests := []struct {
+		positive, negative int
+		want               float64
+	}{
+		{0, 0, 0},
+		{0, 5, 0},
+		{1, 0, 0.20654329147389294},
+		{1, 1, 0.09452865480086611},
+		{5, 0, 0.565508505247919},
+		{100, 10, 0.8407019514690314},
+	}
+	for _, tt := range tests {
+		if got := wilsonLowerBound(tt.positive, tt.negative); math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("wilsonLowerBound(%d, %d) = %v, want %v", tt.positive, tt.negative, got, tt.want)
+		}
+	}
+}
+
+func TestRankByRating(t *testing.T) {
+	likes := []redis.Z{{Member: "1", Score: 1}, {Member: "2", Score: 100}, {Member: "3", Score: 2}, {Member: "4", Score: 2}, {Member: "x", Score: 9}}
+	dislikes := []redis.Z{{Member: "2", Score: 10}, {Member: "3", Score: 2}, {Member: "4", Score: 2}, {Member: "5", Score: 3}}
+
+	got := rankByRating(likes, dislikes)
+	// Many votes outrank a single like, ties go to the lower product ID and
+	// products without likes come last.
+	want := []int64{2, 1, 3, 4, 5}
+	if len(got) != len(want) {
+		t.Fatalf("ranked %d products, want %d", len(got), len(want))
+	}
+	for i, e := range got {
+		if e.ProductID != want[i] || e.Rank != i+1 {
+			t.Errorf("rank %d: product %d with rank %d, want product %d", i+1, e.ProductID, e.Rank, want[i])
+		}
+	}
+	if got[0].Likes != 100 || got[0].Dislikes != 10 {
+		t.Errorf("product 2 has %d likes and %d dislikes, want 100 and 10", got[0].Likes, got[0].Dislikes)
+	}
+}
+
+func TestNormalizeLeaderboardQuery(t *testing.T) {
+	tests := []struct {
+		q      models.LeaderboardQuery
+		window string
+		limit  int
+		err    bool
+	}{
+		{q: models.LeaderboardQuery{}, window: "7d", limit: defaultLeaderboardLen},
+		{q: models.LeaderboardQuery{Window: "all", Limit: maxLeaderboardLen}, window: "all", limit: maxLeaderboardLen},
+		{q: models.LeaderboardQuery{Window: "2d"}, err: true},
+		{q: models.LeaderboardQuery{Limit: -1}, err: true},
+		{q: models.LeaderboardQuery{Limit: maxLeaderboardLen + 1}, err: true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeLeaderboardQuery(tt.q)
+		if tt.err {
+			if err == nil {
+				t.Errorf("normalizeLeaderboardQuery(%+v) succeeded, want an error", tt.q)
+			}
+			continue
+		}
+		if err != nil || got.Window != tt.window || got.Limit != tt.limit {
+			t.Errorf("normalizeLeaderboardQuery(%+v) = %+v, %v, want window %s and limit %d", tt.q, got, err, tt.window, tt.limit)
+		}
+	}
+}
+
+func TestWindowKeys(t *testing.T) {
+	if got := windowKeys(models.BoardLikes, "all", "books"); len(got) != 1 || got[0] != "leaderboard:likes:all:books" {
+		t.Errorf("all-time keys = %v", got)
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	got := windowKeys(models.BoardLikes, "7d", "")
+	if len(got) != 7 {
+		t.Fatalf("7d window has %d keys, want 7", len(got))
+	}
+	if want := "leaderboard:likes:" + today.Format(time.DateOnly); got[0] != want {
+		t.Errorf("first key = %s, want %s", got[0], want)
+	}
+	if want := "leaderboard:likes:" + today.AddDate(0, 0, -6).Format(time.DateOnly); got[6] != want {
+		t.Errorf("last key = %s, want %s", got[6], want)
+	}
+}
+
+// sortedSets keeps sorted sets in memory and counts the window unions, which
+// the rating cache must avoid on every request.
+type sortedSets struct {
+	RedisStore
+
+	sets   map[string]map[string]float64
+	unions int
+}
+
+func (r *sortedSets) ZUnionRevRange(ctx context.Context, keys []string, limit int) ([]redis.Z, error) {
+	if len(keys) > 1 {
+		r.unions++
+	}
+	sum := make(map[string]float64)
+	for _, key := range keys {
+		for m, score := range r.sets[key] {
+			sum[m] += score
+		}
+	}
+	zs := make([]redis.Z, 0, len(sum))
+	for m, score := range sum {
+		zs = append(zs, redis.Z{Member: m, Score: score})
+	}
+	sort.Slice(zs, func(i, j int) bool {
+		if zs[i].Score != zs[j].Score {
+			return zs[i].Score > zs[j].Score
+		}
+		return zs[i].Member > zs[j].Member
+	})
+	if limit > 0 && len(zs) > limit {
+		zs = zs[:limit]
+	}
+	return zs, nil
+}
+
+func (r *sortedSets) Exists(ctx context.Context, key string) (bool, error) {
+	return len(r.sets[key]) > 0, nil
+}
+
+func (r *sortedSets) ZReplace(ctx context.Context, key string, members []redis.Z, ttl time.Duration) error {
+	set := make(map[string]float64, len(members))
+	for _, m := range members {
+		set[m.Member] = m.Score
+	}
+	r.sets[key] = set
+	return nil
+}
+
+func (r *sortedSets) ZScores(ctx context.Context, key string, members []string) ([]float64, error) {
+	scores := make([]float64, len(members))
+	for i, m := range members {
+		scores[i] = r.sets[key][m]
+	}
+	return scores, nil
+}
+
+func TestRatingLeaderboardIsCached(t *testing.T) {
+	logger, err := log.NewLogger(filepath.Join(t.TempDir(), "test.log"), "test", "recommendation-system", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	today := time.Now().UTC().Format(time.DateOnly)
+	store := &sortedSets{sets: map[string]map[string]float64{
+		"leaderboard:likes:" + today:    {"1": 1, "2": 100, "3": 2},
+		"leaderboard:dislikes:" + today: {"2": 10, "3": 2},
+	}}
+	svc := NewAnalyticsService(nil, nil, nil, store, Config{}, logger)
+
+	for i := 0; i < 2; i++ {
+		entries, err := svc.GetProductLeaderboard(context.Background(), models.LeaderboardQuery{Board: models.BoardRating, Limit: 2})
+		if err != nil {
+			t.Fatalf("failed to get rating leaderboard: %v", err)
+		}
+		if len(entries) != 2 || entries[0].ProductID != 2 || entries[1].ProductID != 1 {
+			t.Fatalf("leaderboard = %+v, want products 2 and 1", entries)
+		}
+		if e := entries[0]; e.Rank != 1 || e.Likes != 100 || e.Dislikes != 10 || math.Abs(e.Score-0.8407019514690314) > 1e-12 {
+			t.Errorf("first entry = %+v", e)
+		}
+	}
+	if store.unions != 2 {
+		t.Errorf("summed the window %d times, want once per board", store.unions)
+	}
+	for key := range store.sets {
+		if strings.HasPrefix(key, leaderboardPrefix+ratingCachePrefix) && !strings.HasSuffix(key, ":7d") {
+			t.Errorf("unexpected cache key %s", key)
+		}
+	}
+}
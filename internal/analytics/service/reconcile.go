@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"recommendation-system/internal/analytics/models"
+)
+
+// Reconcile compares the lifetime counters of products and users with the
+// likes, dislikes and purchases tables, which also reflect removed likes and
+// dislikes, and, when repair is set, overwrites the counters that differ. The
+// time series, category and leaderboard aggregates are not changed.
+func (s *analyticsService) Reconcile(ctx context.Context, repair bool) (*models.ReconcileReport, error) {
+	s.logger.Printf("Reconciling analytics counters (repair: %t)", repair)
+	report := &models.ReconcileReport{Repair: repair, StartedAt: time.Now().UTC()}
+	settle := s.cfg.Reconcile.Settle
+
+	products, err := s.repo.FindProductDiscrepancies(ctx, settle)
+	if err != nil {
+		return nil, err
+	}
+	users, err := s.repo.FindUserDiscrepancies(ctx, settle)
+	if err != nil {
+		return nil, err
+	}
+	report.ProductDiscrepancies, report.UserDiscrepancies = len(products), len(users)
+	report.Products = firstDiscrepancies(products, s.cfg.Reconcile.ReportLimit)
+	report.Users = firstDiscrepancies(users, s.cfg.Reconcile.ReportLimit)
+
+	if repair {
+		if report.ProductsRepaired, err = s.repo.RepairProductCounters(ctx, products, settle); err != nil {
+			return nil, err
+		}
+		if report.UsersRepaired, err = s.repo.RepairUserCounters(ctx, users, settle); err != nil {
+			return nil, err
+		}
+	}
+
+	report.FinishedAt = time.Now().UTC()
+	s.logger.Printf("Reconciled analytics counters: %d product and %d user discrepancies, %d and %d repaired",
+		report.ProductDiscrepancies, report.UserDiscrepancies, report.ProductsRepaired, report.UsersRepaired)
+	return report, nil
+}
+
+func firstDiscrepancies(discrepancies []*models.CounterDiscrepancy, limit int) []*models.CounterDiscrepancy {
+	if len(discrepancies) > limit {
+		return discrepancies[:limit]
+	}
+	if discrepancies == nil {
+		return []*models.CounterDiscrepancy{}
+	}
+	return discrepancies
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"recommendation-system/internal/analytics/models"
+)
+
+var ErrInvalidTimeSeriesQuery = errors.New("invalid time series query")
+
+// maxTimeSeriesPoints bounds the number of buckets one request may span.
+const maxTimeSeriesPoints = 2000
+
+func (s *analyticsService) GetProductTimeSeries(ctx context.Context, productID int64, q models.TimeSeriesQuery) (*models.TimeSeries, error) {
+	s.logger.Printf("Fetching time series for product ID: %d", productID)
+	q, step, err := normalizeTimeSeriesQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	points, err := s.repo.GetProductTimeSeries(ctx, productID, q)
+	if err != nil {
+		return nil, err
+	}
+	return &models.TimeSeries{
+		ProductID:   productID,
+		Granularity: q.Granularity,
+		From:        q.From,
+		To:          q.To,
+		Points:      fillTimeSeries(points, q.From, q.To, step),
+	}, nil
+}
+
+func (s *analyticsService) GetUserTimeSeries(ctx context.Context, userID int64, q models.TimeSeriesQuery) (*models.TimeSeries, error) {
+	s.logger.Printf("Fetching time series for user ID: %d", userID)
+	q, step, err := normalizeTimeSeriesQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	points, err := s.repo.GetUserTimeSeries(ctx, userID, q)
+	if err != nil {
+		return nil, err
+	}
+	return &models.TimeSeries{
+		UserID:      userID,
+		Granularity: q.Granularity,
+		From:        q.From,
+		To:          q.To,
+		Points:      fillTimeSeries(points, q.From, q.To, step),
+	}, nil
+}
+
+// GetRevenue returns the daily revenue of a category, or of all categories,
+// with the totals and the average order value of the range.
+func (s *analyticsService) GetRevenue(ctx context.Context, q models.RevenueQuery) (*models.RevenueSeries, error) {
+	s.logger.Printf("Fetching revenue for category: %q", q.Category)
+	tq, step, err := normalizeTimeSeriesQuery(models.TimeSeriesQuery{Granularity: models.GranularityDay, From: q.From, To: q.To})
+	if err != nil {
+		return nil, err
+	}
+	q.From, q.To = tq.From, tq.To
+
+	points, err := s.repo.GetRevenue(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	series := &models.RevenueSeries{Category: q.Category, From: q.From, To: q.To}
+	byBucket := make(map[time.Time]*models.RevenuePoint, len(points))
+	for _, p := range points {
+		byBucket[p.BucketStart.UTC()] = p
+		series.Purchases += p.Purchases
+		series.Revenue += p.Revenue
+	}
+	series.AverageOrderValue = averageOrderValue(series.Revenue, series.Purchases)
+
+	series.Points = make([]*models.RevenuePoint, 0, int(q.To.Sub(q.From)/step))
+	for t := q.From; t.Before(q.To); t = t.Add(step) {
+		p, ok := byBucket[t]
+		if !ok {
+			p = &models.RevenuePoint{}
+		}
+		p.BucketStart = t
+		series.Points = append(series.Points, p)
+	}
+	return series, nil
+}
+
+// normalizeTimeSeriesQuery aligns the range to whole buckets in UTC and fills
+// in the defaults: daily buckets of the last 30 days, or the last 48 hours for
+// hourly buckets.
+func normalizeTimeSeriesQuery(q models.TimeSeriesQuery) (models.TimeSeriesQuery, time.Duration, error) {
+	if q.Granularity == "" {
+		q.Granularity = models.GranularityDay
+	}
+
+	var step, defaultSpan time.Duration
+	switch q.Granularity {
+	case models.GranularityHour:
+		step, defaultSpan = time.Hour, 48*time.Hour
+	case models.GranularityDay:
+		step, defaultSpan = 24*time.Hour, 30*24*time.Hour
+	default:
+		return q, 0, ErrInvalidTimeSeriesQuery
+	}
+
+	if q.To.IsZero() {
+		q.To = time.Now()
+	}
+	// To is exclusive, so the bucket containing it is included by rounding up.
+	to := q.To.UTC().Truncate(step)
+	if !to.Equal(q.To.UTC()) {
+		to = to.Add(step)
+	}
+	q.To = to
+	if q.From.IsZero() {
+		q.From = q.To.Add(-defaultSpan)
+	}
+	q.From = q.From.UTC().Truncate(step)
+
+	if !q.From.Before(q.To) || q.To.Sub(q.From)/step > maxTimeSeriesPoints {
+		return q, 0, ErrInvalidTimeSeriesQuery
+	}
+	return q, step, nil
+}
+
+// fillTimeSeries returns one point per bucket in [from, to), with zero counts
+// for the buckets missing from points.
+func fillTimeSeries(points []*models.TimeSeriesPoint, from, to time.Time, step time.Duration) []*models.TimeSeriesPoint {
+	byBucket := make(map[time.Time]*models.TimeSeriesPoint, len(points))
+	for _, p := range points {
+		byBucket[p.BucketStart.UTC()] = p
+	}
+
+	filled := make([]*models.TimeSeriesPoint, 0, int(to.Sub(from)/step))
+	for t := from; t.Before(to); t = t.Add(step) {
+		if p, ok := byBucket[t]; ok {
+			p.BucketStart = t
+			filled = append(filled, p)
+			continue
+		}
+		filled = append(filled, &models.TimeSeriesPoint{BucketStart: t})
+	}
+	return filled
+}
+
+// RollupTimeSeries compacts hourly buckets older than the hourly retention
+// into daily buckets and drops daily buckets past their retention.
+func (s *analyticsService) RollupTimeSeries(ctx context.Context) error {
+	tc := s.cfg.TimeSeries
+	before := time.Now().UTC().Add(-tc.HourlyRetention).Truncate(time.Hour)
+	s.logger.Printf("Rolling up hourly analytics older than %s", before.Format(time.RFC3339))
+	if _, err := s.repo.RollupHourly(ctx, before); err != nil {
+		return err
+	}
+
+	if tc.DailyRetention > 0 {
+		before := time.Now().UTC().Add(-tc.DailyRetention).Truncate(24 * time.Hour)
+		s.logger.Printf("Pruning daily analytics older than %s", before.Format(time.RFC3339))
+		if _, err := s.repo.DeleteDailyBefore(ctx, before); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -10,6 +10,8 @@ import (
 )
 
 type ProductRepository interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+
 	CreateProduct(ctx context.Context, product *models.Product) error
 	GetProductByID(ctx context.Context, id int64) (*models.Product, error)
 	UpdateProduct(ctx context.Context, product *models.Product) error
@@ -26,6 +28,10 @@ func NewProductRepository(database *db.DB, logger *log.Logger) ProductRepository
 	return &productRepository{db: database, logger: logger}
 }
 
+func (r *productRepository) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return r.db.WithinTx(ctx, fn)
+}
+
 func (r *productRepository) CreateProduct(ctx context.Context, product *models.Product) error {
 	r.logger.Printf("Creating product: %s", product.Name)
 	query := `
@@ -33,7 +39,7 @@ func (r *productRepository) CreateProduct(ctx context.Context, product *models.P
         VALUES ($1, $2, $3, $4, NOW(), NOW())
         RETURNING id, created_at, updated_at
     `
-	err := r.db.Pool.QueryRow(ctx, query,
+	err := r.db.Conn(ctx).QueryRow(ctx, query,
 		product.Name,
 		product.Description,
 		product.Price,
@@ -55,7 +61,7 @@ func (r *productRepository) GetProductByID(ctx context.Context, id int64) (*mode
         FROM products
         WHERE id = $1
     `
-	err := r.db.Pool.QueryRow(ctx, query, id).Scan(
+	err := r.db.Conn(ctx).QueryRow(ctx, query, id).Scan(
 		&product.ID,
 		&product.Name,
 		&product.Description,
@@ -75,7 +81,7 @@ func (r *productRepository) GetProductByID(ctx context.Context, id int64) (*mode
         FROM likes
         WHERE product_id = $1
     `
-	rows, err := r.db.Pool.Query(ctx, likesQuery, id)
+	rows, err := r.db.Conn(ctx).Query(ctx, likesQuery, id)
 	if err != nil {
 		r.logger.Printf("Failed to fetch likes: %v", err)
 		return nil, fmt.Errorf("failed to get likes for product: %w", err)
@@ -101,7 +107,7 @@ func (r *productRepository) GetProductByID(ctx context.Context, id int64) (*mode
         FROM dislikes
         WHERE product_id = $1
     `
-	rows, err = r.db.Pool.Query(ctx, dislikesQuery, id)
+	rows, err = r.db.Conn(ctx).Query(ctx, dislikesQuery, id)
 	if err != nil {
 		r.logger.Printf("Failed to fetch dislikes: %v", err)
 		return nil, fmt.Errorf("failed to get dislikes for product: %w", err)
@@ -125,7 +131,7 @@ func (r *productRepository) GetProductByID(ctx context.Context, id int64) (*mode
 	purchaseCountQuery := `
         SELECT COUNT(*) FROM purchases WHERE product_id = $1
     `
-	err = r.db.Pool.QueryRow(ctx, purchaseCountQuery, id).Scan(&product.PurchaseCount)
+	err = r.db.Conn(ctx).QueryRow(ctx, purchaseCountQuery, id).Scan(&product.PurchaseCount)
 	if err != nil {
 		r.logger.Printf("Failed to fetch purchase count: %v", err)
 		return nil, fmt.Errorf("failed to get purchase count for product: %w", err)
@@ -143,7 +149,7 @@ func (r *productRepository) UpdateProduct(ctx context.Context, product *models.P
         WHERE id = $5
         RETURNING updated_at
     `
-	err := r.db.Pool.QueryRow(ctx, query,
+	err := r.db.Conn(ctx).QueryRow(ctx, query,
 		product.Name,
 		product.Description,
 		product.Price,
@@ -167,7 +173,7 @@ func (r *productRepository) GetAllProducts(ctx context.Context, limit, offset in
         ORDER BY id
         LIMIT $1 OFFSET $2
     `
-	rows, err := r.db.Pool.Query(ctx, query, limit, offset)
+	rows, err := r.db.Conn(ctx).Query(ctx, query, limit, offset)
 	if err != nil {
 		r.logger.Printf("Failed to fetch products: %v", err)
 		return nil, fmt.Errorf("failed to get products: %w", err)
@@ -206,7 +212,7 @@ func (r *productRepository) DeleteProduct(ctx context.Context, id int64) error {
         DELETE FROM products
         WHERE id = $1
     `
-	cmdTag, err := r.db.Pool.Exec(ctx, query, id)
+	cmdTag, err := r.db.Conn(ctx).Exec(ctx, query, id)
 	if err != nil {
 		r.logger.Printf("Failed to delete product: %v", err)
 		return fmt.Errorf("failed to delete product: %w", err)
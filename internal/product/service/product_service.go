@@ -2,13 +2,13 @@ package service
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
 	log "recommendation-system/pkg/logger"
+	"strconv"
 
 	"recommendation-system/internal/product/models"
 	"recommendation-system/internal/product/repository"
-	"recommendation-system/pkg/kafka"
+	"recommendation-system/pkg/events"
+	"recommendation-system/pkg/outbox"
 )
 
 type ProductService interface {
@@ -21,15 +21,15 @@ type ProductService interface {
 
 type productService struct {
 	repo   repository.ProductRepository
-	kafka  *kafka.KafkaClient
+	outbox *outbox.Store
 	topic  string
 	logger *log.Logger
 }
 
-func NewProductService(repo repository.ProductRepository, kafkaClient *kafka.KafkaClient, logger *log.Logger) ProductService {
+func NewProductService(repo repository.ProductRepository, outboxStore *outbox.Store, logger *log.Logger) ProductService {
 	return &productService{
 		repo:   repo,
-		kafka:  kafkaClient,
+		outbox: outboxStore,
 		topic:  "product_updates",
 		logger: logger,
 	}
@@ -37,17 +37,15 @@ func NewProductService(repo repository.ProductRepository, kafkaClient *kafka.Kaf
 
 func (s *productService) CreateProduct(ctx context.Context, product *models.Product) error {
 	s.logger.Printf("Creating product with ID: %d", product.ID)
-	if err := s.repo.CreateProduct(ctx, product); err != nil {
-		s.logger.Printf("Failed to create product: %v", err)
-		return err
-	}
+	return s.repo.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.repo.CreateProduct(ctx, product); err != nil {
+			s.logger.Printf("Failed to create product: %v", err)
+			return err
+		}
 
-	message := map[string]interface{}{
-		"event":   "product_created",
-		"product": product,
-	}
-	s.logger.Println("Publishing product creation event")
-	return s.publishMessage(message)
+		s.logger.Println("Enqueueing product creation event")
+		return s.enqueueEvent(ctx, product.ID, events.ProductCreated, events.ProductCreatedEvent{Product: toEventProduct(product)})
+	})
 }
 
 func (s *productService) GetProduct(ctx context.Context, id int64) (*models.Product, error) {
@@ -61,17 +59,15 @@ func (s *productService) GetProduct(ctx context.Context, id int64) (*models.Prod
 
 func (s *productService) UpdateProduct(ctx context.Context, product *models.Product) error {
 	s.logger.Printf("Updating product with ID: %d", product.ID)
-	if err := s.repo.UpdateProduct(ctx, product); err != nil {
-		s.logger.Printf("Failed to update product: %v", err)
-		return err
-	}
+	return s.repo.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.repo.UpdateProduct(ctx, product); err != nil {
+			s.logger.Printf("Failed to update product: %v", err)
+			return err
+		}
 
-	message := map[string]interface{}{
-		"event":   "product_updated",
-		"product": product,
-	}
-	s.logger.Println("Publishing product update event")
-	return s.publishMessage(message)
+		s.logger.Println("Enqueueing product update event")
+		return s.enqueueEvent(ctx, product.ID, events.ProductUpdated, events.ProductUpdatedEvent{Product: toEventProduct(product)})
+	})
 }
 
 func (s *productService) GetAllProducts(ctx context.Context, limit, offset int) ([]*models.Product, error) {
@@ -85,26 +81,36 @@ func (s *productService) GetAllProducts(ctx context.Context, limit, offset int)
 
 func (s *productService) DeleteProduct(ctx context.Context, id int64) error {
 	s.logger.Printf("Deleting product with ID: %d", id)
-	if err := s.repo.DeleteProduct(ctx, id); err != nil {
-		s.logger.Printf("Failed to delete product: %v", err)
-		return err
-	}
+	return s.repo.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.repo.DeleteProduct(ctx, id); err != nil {
+			s.logger.Printf("Failed to delete product: %v", err)
+			return err
+		}
 
-	message := map[string]interface{}{
-		"event":      "product_deleted",
-		"product_id": id,
-	}
-	s.logger.Println("Publishing product deletion event")
-	return s.publishMessage(message)
+		s.logger.Println("Enqueueing product deletion event")
+		return s.enqueueEvent(ctx, id, events.ProductDeleted, events.ProductDeletedEvent{ProductID: id})
+	})
 }
 
-func (s *productService) publishMessage(message interface{}) error {
-	valueBytes, err := json.Marshal(message)
-	if err != nil {
-		s.logger.Printf("Failed to marshal message: %v", err)
-		return fmt.Errorf("failed to marshal message: %w", err)
+func toEventProduct(product *models.Product) events.Product {
+	return events.Product{
+		ID:          product.ID,
+		Name:        product.Name,
+		Description: product.Description,
+		Price:       product.Price,
+		Category:    product.Category,
+		CreatedAt:   product.CreatedAt,
+		UpdatedAt:   product.UpdatedAt,
 	}
+}
 
-	s.logger.Printf("Publishing message to topic %s", s.topic)
-	return s.kafka.PublishMessage(s.topic, nil, valueBytes)
+// enqueueEvent stores the event in the outbox as part of the current
+// transaction; events of a product are keyed by the product ID.
+func (s *productService) enqueueEvent(ctx context.Context, productID int64, eventType string, payload interface{}) error {
+	s.logger.Printf("Enqueueing %s event for topic %s", eventType, s.topic)
+	if err := s.outbox.Enqueue(ctx, s.topic, strconv.FormatInt(productID, 10), eventType, payload); err != nil {
+		s.logger.Printf("Failed to enqueue event: %v", err)
+		return err
+	}
+	return nil
 }
@@ -1,6 +1,15 @@
 package http
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"recommendation-system/internal/recommendation/models"
 	"recommendation-system/internal/recommendation/service"
 	"recommendation-system/pkg/auth"
 	log "recommendation-system/pkg/logger"
@@ -18,14 +27,26 @@ import (
 // @name Authorization
 
 type Handler struct {
-	service service.RecommendationService
-	logger  *log.Logger
+	service       service.RecommendationService
+	hub           *service.Hub
+	maxBatchUsers int
+	logger        *log.Logger
 }
 
-func NewHandler(s service.RecommendationService, logger *log.Logger) *Handler {
+const (
+	defaultMaxBatchUsers = 50000
+	streamHeartbeat      = 15 * time.Second
+)
+
+func NewHandler(s service.RecommendationService, hub *service.Hub, maxBatchUsers int, logger *log.Logger) *Handler {
+	if maxBatchUsers <= 0 {
+		maxBatchUsers = defaultMaxBatchUsers
+	}
 	return &Handler{
-		service: s,
-		logger:  logger,
+		service:       s,
+		hub:           hub,
+		maxBatchUsers: maxBatchUsers,
+		logger:        logger,
 	}
 }
 
@@ -39,6 +60,9 @@ func NewFiberApp(h *Handler, jwtSecret string) *fiber.App {
 
 	recommendations := api.Group("/recommendations")
 	recommendations.Get("/:user_id/latest", h.GetLatestRecommendation)
+	recommendations.Get("/:user_id/price-band", h.GetUserPriceBand)
+	recommendations.Post("/batch", h.GetBatchRecommendations)
+	recommendations.Get("/stream", h.StreamRecommendations)
 
 	return app
 }
@@ -81,3 +105,223 @@ func (h *Handler) GetLatestRecommendation(c *fiber.Ctx) error {
 		"recommended_product_ids": productIDs,
 	})
 }
+
+// GetUserPriceBand godoc
+// @Summary      Get the learned price band of a user
+// @Description  Retrieve the price band learned from the user's purchase history (quartiles of purchased product prices). The band is used for ranking only when it is reliable, i.e. backed by enough purchases.
+// @Tags         recommendations :8082
+// @Accept       json
+// @Produce      json
+// @Param        user_id   path      int  true  "User ID"
+// @Param Authorization header string true "Bearer {token}"
+// @Security     BearerAuth
+// @Success      200       {object}  models.PriceBand
+// @Failure      400       {object}  map[string]interface{}
+// @Failure      500       {object}  map[string]interface{}
+// @Router       /recommendations/{user_id}/price-band [get]
+func (h *Handler) GetUserPriceBand(c *fiber.Ctx) error {
+	h.logger.Println("Processing request to get the user price band")
+
+	userID, err := c.ParamsInt("user_id")
+	if err != nil || userID <= 0 {
+		h.logger.Printf("Invalid user ID: %s", c.Params("user_id"))
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	band, err := h.service.GetUserPriceBand(c.Context(), int64(userID))
+	if err != nil {
+		h.logger.Printf("Failed to retrieve price band for user ID %d: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	h.logger.Printf("Successfully fetched price band for user ID: %d", userID)
+	return c.JSON(band)
+}
+
+// GetBatchRecommendations godoc
+// @Summary      Get recommendations for many users
+// @Description  Retrieve recommended products for a list of users in one call. Cached recommendations are reused, the rest are computed with bounded concurrency. Send "Accept: application/x-ndjson" or "stream=true" to receive one JSON object per line as soon as it is ready.
+// @Tags         recommendations :8082
+// @Accept       json
+// @Produce      json
+// @Produce      application/x-ndjson
+// @Param        request  body      models.BatchRecommendationRequest  true   "User IDs"
+// @Param        stream   query     bool                               false  "Stream the response as NDJSON"
+// @Param Authorization header string true "Bearer {token}"
+// @Security     BearerAuth
+// @Success      200      {object}  map[string]interface{}
+// @Failure      400      {object}  map[string]interface{}
+// @Failure      500      {object}  map[string]interface{}
+// @Router       /recommendations/batch [post]
+func (h *Handler) GetBatchRecommendations(c *fiber.Ctx) error {
+	h.logger.Println("Processing request to get batch recommendations")
+
+	var req models.BatchRecommendationRequest
+	if err := c.BodyParser(&req); err != nil {
+		h.logger.Printf("Failed to parse request body: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if len(req.UserIDs) == 0 {
+		h.logger.Println("Empty user ID list in batch request")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "user_ids must not be empty"})
+	}
+	if len(req.UserIDs) > h.maxBatchUsers {
+		h.logger.Printf("Batch request too large: %d users", len(req.UserIDs))
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Too many user IDs in a single batch",
+			"limit": h.maxBatchUsers,
+		})
+	}
+	for _, id := range req.UserIDs {
+		if id <= 0 {
+			h.logger.Printf("Invalid user ID in batch request: %d", id)
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+		}
+	}
+
+	if c.QueryBool("stream") || strings.Contains(c.Get(fiber.HeaderAccept), "application/x-ndjson") {
+		return h.streamBatchRecommendations(c, req.UserIDs)
+	}
+
+	byUser := make(map[int64]*models.BatchRecommendation, len(req.UserIDs))
+	err := h.service.GetBatchRecommendations(c.Context(), req.UserIDs, func(rec *models.BatchRecommendation) error {
+		byUser[rec.UserID] = rec
+		return nil
+	})
+	if err != nil {
+		h.logger.Printf("Failed to retrieve batch recommendations: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	results := make([]*models.BatchRecommendation, 0, len(byUser))
+	for _, id := range req.UserIDs {
+		if rec, ok := byUser[id]; ok {
+			results = append(results, rec)
+			delete(byUser, id)
+		}
+	}
+
+	h.logger.Printf("Successfully fetched batch recommendations for %d users", len(results))
+	return c.JSON(fiber.Map{
+		"recommendations": results,
+	})
+}
+
+func (h *Handler) streamBatchRecommendations(c *fiber.Ctx, userIDs []int64) error {
+	h.logger.Printf("Streaming batch recommendations for %d users", len(userIDs))
+	c.Set(fiber.HeaderContentType, "application/x-ndjson")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		// The request context is gone once the handler returns, so the stream
+		// owns its own and cancels it when writing a recommendation fails,
+		// which may only happen some time after the client disconnected.
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		enc := json.NewEncoder(w)
+		written := 0
+		err := h.service.GetBatchRecommendations(ctx, userIDs, func(rec *models.BatchRecommendation) error {
+			if err := enc.Encode(rec); err != nil {
+				cancel()
+				return err
+			}
+			if err := w.Flush(); err != nil {
+				cancel()
+				return err
+			}
+			written++
+			return nil
+		})
+		if err != nil {
+			h.logger.Printf("Batch recommendation stream aborted after %d users: %v", written, err)
+			return
+		}
+		h.logger.Printf("Successfully streamed batch recommendations for %d users", written)
+	})
+
+	return nil
+}
+
+// StreamRecommendations godoc
+// @Summary      Stream recommendation updates
+// @Description  Subscribe to the authenticated user's recommendations over Server-Sent Events. The current list is sent first, then a "recommendations" event is pushed every time the list is regenerated.
+// @Tags         recommendations :8082
+// @Produce      text/event-stream
+// @Param Authorization header string true "Bearer {token}"
+// @Security     BearerAuth
+// @Success      200  {string}  string  "event stream"
+// @Failure      401  {object}  map[string]interface{}
+// @Router       /recommendations/stream [get]
+func (h *Handler) StreamRecommendations(c *fiber.Ctx) error {
+	h.logger.Println("Processing request to stream recommendations")
+
+	subject, _ := c.Locals("userID").(string)
+	userID, err := strconv.ParseInt(subject, 10, 64)
+	if err != nil || userID <= 0 {
+		h.logger.Printf("Invalid user ID in token subject: %q", subject)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": auth.ErrUnauthorized.Error()})
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	updates, unsubscribe := h.hub.Subscribe(userID)
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer unsubscribe()
+
+		productIDs, err := h.service.GetLatestRecommendation(context.Background(), userID)
+		if err != nil {
+			h.logger.Printf("Failed to load initial recommendations for user ID %d: %v", userID, err)
+		} else {
+			current := &models.Recommendation{UserID: userID, ProductIDs: make([]int, len(productIDs)), CreatedAt: time.Now()}
+			for i, id := range productIDs {
+				current.ProductIDs[i] = int(id)
+			}
+			if err := writeRecommendationEvent(w, current); err != nil {
+				return
+			}
+		}
+
+		ticker := time.NewTicker(streamHeartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case rec, ok := <-updates:
+				if !ok {
+					h.logger.Printf("Recommendation stream closed for user ID: %d", userID)
+					return
+				}
+				if err := writeRecommendationEvent(w, rec); err != nil {
+					h.logger.Printf("Recommendation stream for user ID %d disconnected: %v", userID, err)
+					return
+				}
+			case <-ticker.C:
+				if _, err := w.WriteString(": ping\n\n"); err != nil {
+					return
+				}
+				if err := w.Flush(); err != nil {
+					h.logger.Printf("Recommendation stream for user ID %d disconnected: %v", userID, err)
+					return
+				}
+			}
+		}
+	})
+
+	return nil
+}
+
+func writeRecommendationEvent(w *bufio.Writer, rec *models.Recommendation) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: recommendations\ndata: %s\n\n", data); err != nil {
+		return err
+	}
+	return w.Flush()
+}
@@ -7,4 +7,33 @@ type Recommendation struct {
     UserID     int64     `db:"user_id" json:"user_id"`
     ProductIDs []int     `db:"product_ids" json:"product_ids"`
     CreatedAt  time.Time `db:"created_at" json:"created_at"`
-}
\ No newline at end of file
+}
+
+type BatchRecommendationRequest struct {
+    UserIDs []int64 `json:"user_ids"`
+}
+
+type BatchRecommendation struct {
+    UserID     int64   `json:"user_id"`
+    ProductIDs []int64 `json:"recommended_product_ids"`
+    Cached     bool    `json:"cached"`
+    Error      string  `json:"error,omitempty"`
+}
+
+type PriceBand struct {
+    UserID    int64   `json:"user_id"`
+    Purchases int     `json:"purchases"`
+    Min       float64 `json:"min"`
+    Lower     float64 `json:"lower"`
+    Median    float64 `json:"median"`
+    Upper     float64 `json:"upper"`
+    Max       float64 `json:"max"`
+    Reliable  bool    `json:"reliable"`
+}
+
+type CandidateProduct struct {
+    ProductID     int64
+    Category      string
+    Price         float64
+    CategoryScore float64
+}
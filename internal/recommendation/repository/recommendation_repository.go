@@ -7,14 +7,19 @@ import (
 
 	"recommendation-system/internal/recommendation/models"
 	"recommendation-system/pkg/db"
+	"recommendation-system/pkg/trending"
 )
 
 type RecommendationRepository interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+
 	CreateRecommendation(ctx context.Context, rec *models.Recommendation) error
 	GetRecommendationsByUserID(ctx context.Context, userID int64) ([]*models.Recommendation, error)
 	GetAllUserIDs(ctx context.Context) ([]int64, error)
 	UpdateUserCategoryScore(ctx context.Context, userID int64, category string, delta float64) error
-	GetTopProductsByUserPreference(ctx context.Context, userID int64, limit int) ([]int64, error)
+	GetCandidateProducts(ctx context.Context, userID int64, limit int) ([]*models.CandidateProduct, error)
+	GetUserPriceBand(ctx context.Context, userID int64) (*models.PriceBand, error)
+	GetTrendingProductIDs(ctx context.Context, q trending.Query) ([]int64, error)
 	GetProductCategory(ctx context.Context, productID int64) (string, error)
 }
 
@@ -27,6 +32,10 @@ func NewRecommendationRepository(database *db.DB, logger *log.Logger) Recommenda
 	return &recommendationRepository{db: database, logger: logger}
 }
 
+func (r *recommendationRepository) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return r.db.WithinTx(ctx, fn)
+}
+
 func (r *recommendationRepository) CreateRecommendation(ctx context.Context, rec *models.Recommendation) error {
 	r.logger.Printf("Creating recommendation for user ID: %d", rec.UserID)
 	query := `
@@ -34,7 +43,7 @@ func (r *recommendationRepository) CreateRecommendation(ctx context.Context, rec
         VALUES ($1, $2, NOW())
         RETURNING id, created_at
     `
-	err := r.db.Pool.QueryRow(ctx, query, rec.UserID, rec.ProductIDs).Scan(&rec.ID, &rec.CreatedAt)
+	err := r.db.Conn(ctx).QueryRow(ctx, query, rec.UserID, rec.ProductIDs).Scan(&rec.ID, &rec.CreatedAt)
 	if err != nil {
 		r.logger.Printf("Failed to create recommendation: %v", err)
 		return fmt.Errorf("failed to create recommendation: %w", err)
@@ -51,7 +60,7 @@ func (r *recommendationRepository) GetRecommendationsByUserID(ctx context.Contex
         FROM recommendations
         WHERE user_id = $1
     `
-	rows, err := r.db.Pool.Query(ctx, query, userID)
+	rows, err := r.db.Conn(ctx).Query(ctx, query, userID)
 	if err != nil {
 		r.logger.Printf("Failed to get recommendations: %v", err)
 		return nil, fmt.Errorf("failed to get recommendations: %w", err)
@@ -82,7 +91,7 @@ func (r *recommendationRepository) GetAllUserIDs(ctx context.Context) ([]int64,
 	query := `
         SELECT id FROM users
     `
-	rows, err := r.db.Pool.Query(ctx, query)
+	rows, err := r.db.Conn(ctx).Query(ctx, query)
 	if err != nil {
 		r.logger.Printf("Failed to get user IDs: %v", err)
 		return nil, fmt.Errorf("failed to get user IDs: %w", err)
@@ -115,7 +124,7 @@ func (r *recommendationRepository) UpdateUserCategoryScore(ctx context.Context,
         ON CONFLICT (user_id, category)
         DO UPDATE SET score = user_category_preferences.score + EXCLUDED.score
     `
-	_, err := r.db.Pool.Exec(ctx, query, userID, category, delta)
+	_, err := r.db.Conn(ctx).Exec(ctx, query, userID, category, delta)
 	if err != nil {
 		r.logger.Printf("Failed to update category score: %v", err)
 		return fmt.Errorf("failed to update category score: %w", err)
@@ -124,71 +133,84 @@ func (r *recommendationRepository) UpdateUserCategoryScore(ctx context.Context,
 	return nil
 }
 
-func (r *recommendationRepository) GetTopProductsByUserPreference(ctx context.Context, userID int64, limit int) ([]int64, error) {
-	r.logger.Printf("Fetching top products by user preference for user ID: %d", userID)
-	catQuery := `
-        SELECT category, score 
-        FROM user_category_preferences
-        WHERE user_id = $1
-        ORDER BY score DESC
-        LIMIT 10
+func (r *recommendationRepository) GetCandidateProducts(ctx context.Context, userID int64, limit int) ([]*models.CandidateProduct, error) {
+	r.logger.Printf("Fetching candidate products by user preference for user ID: %d", userID)
+	query := `
+        SELECT p.id, p.category, p.price::float8, prefs.score::float8
+        FROM products p
+        JOIN (
+            SELECT category, score
+            FROM user_category_preferences
+            WHERE user_id = $1
+            ORDER BY score DESC
+            LIMIT 10
+        ) prefs ON prefs.category = p.category
+        ORDER BY prefs.score DESC, p.updated_at DESC
+        LIMIT $2
     `
-	rows, err := r.db.Pool.Query(ctx, catQuery, userID)
+	rows, err := r.db.Conn(ctx).Query(ctx, query, userID, limit)
 	if err != nil {
-		r.logger.Printf("Failed to get user categories: %v", err)
-		return nil, fmt.Errorf("failed to get user categories: %w", err)
+		r.logger.Printf("Failed to get candidate products: %v", err)
+		return nil, fmt.Errorf("failed to get candidate products: %w", err)
 	}
 	defer rows.Close()
 
-	var topCategories []string
+	var candidates []*models.CandidateProduct
 	for rows.Next() {
-		var cat string
-		var sc float64
-		if err := rows.Scan(&cat, &sc); err != nil {
-			r.logger.Printf("Failed to scan categories: %v", err)
-			return nil, fmt.Errorf("failed to scan categories: %w", err)
+		var c models.CandidateProduct
+		if err := rows.Scan(&c.ProductID, &c.Category, &c.Price, &c.CategoryScore); err != nil {
+			r.logger.Printf("Failed to scan candidate product: %v", err)
+			return nil, fmt.Errorf("failed to scan candidate product: %w", err)
 		}
-		topCategories = append(topCategories, cat)
+		candidates = append(candidates, &c)
 	}
 	if err := rows.Err(); err != nil {
 		r.logger.Printf("Rows error: %v", err)
 		return nil, fmt.Errorf("rows error: %w", err)
 	}
 
-	if len(topCategories) == 0 {
-		r.logger.Println("No categories found for user preferences")
-		return []int64{}, nil
-	}
+	r.logger.Printf("Successfully fetched %d candidate products for user ID: %d", len(candidates), userID)
+	return candidates, nil
+}
 
-	prodQuery := `
-        SELECT id 
-        FROM products
-        WHERE category = ANY($1)
-        ORDER BY updated_at DESC
-        LIMIT $2
+func (r *recommendationRepository) GetUserPriceBand(ctx context.Context, userID int64) (*models.PriceBand, error) {
+	r.logger.Printf("Fetching price band for user ID: %d", userID)
+	query := `
+        SELECT
+            COUNT(*),
+            COALESCE(MIN(pu.price), 0)::float8,
+            COALESCE(percentile_cont(0.25) WITHIN GROUP (ORDER BY pu.price), 0)::float8,
+            COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY pu.price), 0)::float8,
+            COALESCE(percentile_cont(0.75) WITHIN GROUP (ORDER BY pu.price), 0)::float8,
+            COALESCE(MAX(pu.price), 0)::float8
+        FROM purchases pu
+        WHERE pu.user_id = $1
     `
-	rows2, err := r.db.Pool.Query(ctx, prodQuery, topCategories, limit)
+	band := models.PriceBand{UserID: userID}
+	err := r.db.Conn(ctx).QueryRow(ctx, query, userID).Scan(
+		&band.Purchases, &band.Min, &band.Lower, &band.Median, &band.Upper, &band.Max,
+	)
 	if err != nil {
-		r.logger.Printf("Failed to get top products: %v", err)
-		return nil, fmt.Errorf("failed to get top products: %w", err)
-	}
-	defer rows2.Close()
-
-	var productIDs []int64
-	for rows2.Next() {
-		var pid int64
-		if err := rows2.Scan(&pid); err != nil {
-			r.logger.Printf("Failed to scan product ID: %v", err)
-			return nil, fmt.Errorf("failed to scan product ID: %w", err)
-		}
-		productIDs = append(productIDs, pid)
+		r.logger.Printf("Failed to get user price band: %v", err)
+		return nil, fmt.Errorf("failed to get user price band: %w", err)
 	}
-	if err := rows2.Err(); err != nil {
-		r.logger.Printf("Rows2 error: %v", err)
-		return nil, fmt.Errorf("rows2 error: %w", err)
+	r.logger.Printf("Successfully fetched price band for user ID: %d from %d purchases", userID, band.Purchases)
+	return &band, nil
+}
+
+func (r *recommendationRepository) GetTrendingProductIDs(ctx context.Context, q trending.Query) ([]int64, error) {
+	r.logger.Printf("Fetching trending products for categories: %v", q.Categories)
+	products, err := trending.Products(ctx, r.db.Conn(ctx), q)
+	if err != nil {
+		r.logger.Printf("Failed to get trending products: %v", err)
+		return nil, err
 	}
 
-	r.logger.Printf("Successfully fetched %d top products for user ID: %d", len(productIDs), userID)
+	productIDs := make([]int64, len(products))
+	for i, p := range products {
+		productIDs[i] = p.ProductID
+	}
+	r.logger.Printf("Successfully fetched %d trending products", len(productIDs))
 	return productIDs, nil
 }
 
@@ -196,7 +218,7 @@ func (r *recommendationRepository) GetProductCategory(ctx context.Context, produ
 	r.logger.Printf("Fetching category for product ID: %d", productID)
 	query := `SELECT category FROM products WHERE id = $1`
 	var cat string
-	err := r.db.Pool.QueryRow(ctx, query, productID).Scan(&cat)
+	err := r.db.Conn(ctx).QueryRow(ctx, query, productID).Scan(&cat)
 	if err != nil {
 		r.logger.Printf("Failed to get product category: %v", err)
 		return "", fmt.Errorf("failed to get product category: %w", err)
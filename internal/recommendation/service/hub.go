@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"recommendation-system/internal/recommendation/models"
+	"recommendation-system/pkg/events"
+	log "recommendation-system/pkg/logger"
+
+	kafka_go "github.com/segmentio/kafka-go"
+)
+
+// Hub fans out freshly generated recommendation lists to the clients that are
+// subscribed to the corresponding user. It is fed from the
+// recommendation_updates topic, so every instance of the service sees the
+// updates no matter which instance regenerated them.
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[int64]map[chan *models.Recommendation]struct{}
+	closed      bool
+	logger      *log.Logger
+}
+
+func NewHub(logger *log.Logger) *Hub {
+	return &Hub{
+		subscribers: make(map[int64]map[chan *models.Recommendation]struct{}),
+		logger:      logger,
+	}
+}
+
+// Subscribe registers a listener for the given user. The returned channel is
+// closed when the hub shuts down; the returned function must be called once
+// the listener goes away.
+func (h *Hub) Subscribe(userID int64) (<-chan *models.Recommendation, func()) {
+	ch := make(chan *models.Recommendation, 1)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		close(ch)
+		return ch, func() {}
+	}
+
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = make(map[chan *models.Recommendation]struct{})
+	}
+	h.subscribers[userID][ch] = struct{}{}
+	h.logger.Printf("Stream subscriber added for user ID: %d", userID)
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+
+			subs, ok := h.subscribers[userID]
+			if !ok {
+				return
+			}
+			if _, ok := subs[ch]; !ok {
+				return
+			}
+			delete(subs, ch)
+			if len(subs) == 0 {
+				delete(h.subscribers, userID)
+			}
+			close(ch)
+			h.logger.Printf("Stream subscriber removed for user ID: %d", userID)
+		})
+	}
+}
+
+// Publish delivers the recommendation to every subscriber of its user. Only
+// the newest list matters, so a slow subscriber has its pending update
+// replaced instead of blocking the hub.
+func (h *Hub) Publish(rec *models.Recommendation) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers[rec.UserID] {
+		select {
+		case ch <- rec:
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- rec
+		}
+	}
+}
+
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return
+	}
+	h.closed = true
+
+	for userID, subs := range h.subscribers {
+		for ch := range subs {
+			close(ch)
+		}
+		delete(h.subscribers, userID)
+	}
+	h.logger.Println("Recommendation stream hub closed")
+}
+
+func (h *Hub) ProcessKafkaMessage(ctx context.Context, m kafka_go.Message) error {
+	env, err := events.DecodeMessage(m)
+	if err != nil {
+		h.logger.Printf("Failed to decode recommendation update: %v", err)
+		return fmt.Errorf("failed to decode recommendation update: %w", err)
+	}
+	if err := events.Validate(env); err != nil {
+		h.logger.Printf("Invalid recommendation update %s: %v", env.ID, err)
+		return err
+	}
+
+	if env.Type != events.RecommendationCreated {
+		return nil
+	}
+
+	var e events.RecommendationCreatedEvent
+	if err := env.DecodeData(&e); err != nil {
+		h.logger.Printf("Failed to decode recommendation update: %v", err)
+		return err
+	}
+
+	rec := &models.Recommendation{
+		ID:         e.RecommendationID,
+		UserID:     e.UserID,
+		ProductIDs: make([]int, len(e.ProductIDs)),
+		CreatedAt:  e.CreatedAt,
+	}
+	for i, id := range e.ProductIDs {
+		rec.ProductIDs[i] = int(id)
+	}
+
+	h.Publish(rec)
+	return nil
+}
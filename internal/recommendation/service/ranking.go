@@ -0,0 +1,148 @@
+package service
+
+import (
+	"math"
+	"sort"
+
+	"recommendation-system/internal/recommendation/models"
+	"recommendation-system/pkg/trending"
+)
+
+// PriceConfig controls how the learned price band of a user influences the
+// ranking of candidate products.
+type PriceConfig struct {
+	// Weight of the price affinity relative to the normalized category score.
+	Weight float64
+	// Filter drops candidates priced outside the band widened by Tolerance.
+	Filter bool
+	// Tolerance is the multiplicative slack applied to the band bounds.
+	Tolerance float64
+	// MinPurchases is the number of purchases needed before a band is used.
+	MinPurchases int
+}
+
+const (
+	defaultPriceTolerance    = 1.5
+	defaultPriceMinPurchases = 3
+	candidatePoolFactor      = 20
+	minLogPriceSpread        = 0.1
+)
+
+// priceAffinity is 1 at the median of the band and decays as a gaussian in
+// log-price space, with the interquartile range setting the width.
+func priceAffinity(price float64, band *models.PriceBand) float64 {
+	if price <= 0 || band.Median <= 0 {
+		return 0
+	}
+
+	spread := minLogPriceSpread
+	if band.Lower > 0 && band.Upper > band.Lower {
+		spread = math.Max(math.Log(band.Upper/band.Lower)/2, minLogPriceSpread)
+	}
+
+	d := math.Log(price/band.Median) / spread
+	return math.Exp(-d * d / 2)
+}
+
+func withinPriceBand(price float64, band *models.PriceBand, tolerance float64) bool {
+	return price >= band.Lower/tolerance && price <= band.Upper*tolerance
+}
+
+// rankCandidates orders candidates by their normalized category score plus the
+// weighted price affinity. Candidates arrive ordered by category score and
+// recency, which the stable sort keeps as the tie breaker. band may be nil
+// when the user has too little purchase history.
+func rankCandidates(candidates []*models.CandidateProduct, band *models.PriceBand, cfg PriceConfig, limit int) []int64 {
+	maxScore := 0.0
+	for _, c := range candidates {
+		maxScore = math.Max(maxScore, math.Abs(c.CategoryScore))
+	}
+
+	type scored struct {
+		productID int64
+		score     float64
+	}
+	ranked := make([]scored, 0, len(candidates))
+	for _, c := range candidates {
+		if band != nil && cfg.Filter && !withinPriceBand(c.Price, band, cfg.Tolerance) {
+			continue
+		}
+
+		score := 0.0
+		if maxScore > 0 {
+			score = c.CategoryScore / maxScore
+		}
+		if band != nil {
+			score += cfg.Weight * priceAffinity(c.Price, band)
+		}
+		ranked = append(ranked, scored{productID: c.ProductID, score: score})
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].score > ranked[j].score
+	})
+
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	productIDs := make([]int64, len(ranked))
+	for i, r := range ranked {
+		productIDs[i] = r.productID
+	}
+	return productIDs
+}
+
+// TrendingConfig controls how many slots of a recommendation list are given to
+// products trending in the user's categories, and how trending is measured.
+// Users without any preferences get a list made only of trending products.
+type TrendingConfig struct {
+	Slots int
+	trending.Config
+}
+
+func candidateCategories(candidates []*models.CandidateProduct) []string {
+	seen := make(map[string]struct{})
+	var categories []string
+	for _, c := range candidates {
+		if _, ok := seen[c.Category]; ok {
+			continue
+		}
+		seen[c.Category] = struct{}{}
+		categories = append(categories, c.Category)
+	}
+	return categories
+}
+
+// blendTrending keeps the best personalized products, reserves up to slots
+// positions for trending products that are not already in the list and fills
+// whatever is left with the remaining personalized products.
+func blendTrending(ranked, trending []int64, slots, limit int) []int64 {
+	keep := limit - slots
+	if keep < 0 {
+		keep = 0
+	}
+	if keep > len(ranked) {
+		keep = len(ranked)
+	}
+
+	result := make([]int64, 0, limit)
+	seen := make(map[int64]struct{}, limit)
+	add := func(id int64) {
+		if _, ok := seen[id]; ok || len(result) >= limit {
+			return
+		}
+		seen[id] = struct{}{}
+		result = append(result, id)
+	}
+
+	for _, id := range ranked[:keep] {
+		add(id)
+	}
+	for _, id := range trending {
+		add(id)
+	}
+	for _, id := range ranked[keep:] {
+		add(id)
+	}
+	return result
+}
@@ -3,14 +3,15 @@ package service
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	log "recommendation-system/pkg/logger"
+	"strconv"
+	"sync"
 
 	"recommendation-system/internal/recommendation/models"
 	"recommendation-system/internal/recommendation/repository"
+	"recommendation-system/pkg/events"
 	"recommendation-system/pkg/kafka"
-	"recommendation-system/pkg/redis"
 	"time"
 
 	kafka_go "github.com/segmentio/kafka-go"
@@ -19,27 +20,101 @@ import (
 type RecommendationService interface {
 	GenerateRecommendations(ctx context.Context, userID int64, productID int64) error
 	GetLatestRecommendation(ctx context.Context, userID int64) ([]int64, error)
+	GetBatchRecommendations(ctx context.Context, userIDs []int64, emit func(*models.BatchRecommendation) error) error
+	RefreshRecommendations(ctx context.Context, userID int64) ([]int64, error)
+	RefreshPending(ctx context.Context) error
+	GetUserPriceBand(ctx context.Context, userID int64) (*models.PriceBand, error)
 	ProcessKafkaMessage(ctx context.Context, message kafka_go.Message) error
+	PruneProcessedEvents(ctx context.Context) error
+}
+
+// Config holds the tunables of the recommendation service.
+type Config struct {
+	// BatchConcurrency bounds how many cache misses of a batch request are
+	// computed against the database at the same time.
+	BatchConcurrency int
+	Price            PriceConfig
+	Trending         TrendingConfig
+	// ProcessedRetention is how long IDs of applied events are kept for
+	// deduplication. It must exceed the retention of the consumed topics.
+	ProcessedRetention time.Duration
+	// EventMode is the CloudEvents layout of published events.
+	EventMode events.Mode
+	// RefreshInterval is how often RefreshPending is expected to run. When it
+	// is positive, ProcessKafkaMessage queues users whose category scores
+	// changed, so that a burst of interactions leads to one refresh per user.
+	// The queue is kept in memory; users still queued at shutdown are
+	// refreshed after their next interaction. Zero disables the queue, as
+	// the replay tool does, which refreshes every affected user at the end.
+	RefreshInterval time.Duration
+}
+
+const (
+	defaultBatchConcurrency = 8
+	batchCacheChunkSize     = 500
+	recommendationsLimit    = 5
+)
+
+// ProcessedEvents is the part of events.ProcessedStore used by the service.
+type ProcessedEvents interface {
+	MarkProcessed(ctx context.Context, eventID string) (bool, error)
+	DeleteProcessedBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Cache is the part of redis.RedisClient holding the cached recommendations.
+type Cache interface {
+	Get(ctx context.Context, key string) (string, error)
+	MGet(ctx context.Context, keys ...string) ([]string, error)
+	Set(ctx context.Context, key string, value string, expiration time.Duration) error
+	Delete(ctx context.Context, key string) error
 }
 
 type recommendationService struct {
 	repo        repository.RecommendationRepository
-	kafka       *kafka.KafkaClient
+	processed   ProcessedEvents
+	kafka       kafka.Publisher
 	topic       string
-	redisClient *redis.RedisClient
+	redisClient Cache
+	cfg         Config
 	logger      *log.Logger
+
+	pendingMu sync.Mutex
+	pending   map[int64]struct{}
 }
 
-func NewRecommendationService(repo repository.RecommendationRepository, kafkaClient *kafka.KafkaClient, redisClient *redis.RedisClient, logger *log.Logger) RecommendationService {
+func NewRecommendationService(repo repository.RecommendationRepository, processed ProcessedEvents, kafkaClient kafka.Publisher, redisClient Cache, cfg Config, logger *log.Logger) RecommendationService {
+	if cfg.BatchConcurrency <= 0 {
+		cfg.BatchConcurrency = defaultBatchConcurrency
+	}
+	if cfg.Price.Tolerance < 1 {
+		cfg.Price.Tolerance = defaultPriceTolerance
+	}
+	if cfg.Price.MinPurchases <= 0 {
+		cfg.Price.MinPurchases = defaultPriceMinPurchases
+	}
+	cfg.Trending.Config = cfg.Trending.Config.WithDefaults()
+	if cfg.ProcessedRetention <= 0 {
+		cfg.ProcessedRetention = 7 * 24 * time.Hour
+	}
+	if cfg.EventMode == "" {
+		cfg.EventMode = events.ModeStructured
+	}
 	return &recommendationService{
 		repo:        repo,
+		processed:   processed,
 		kafka:       kafkaClient,
 		topic:       "recommendation_updates",
 		redisClient: redisClient,
+		cfg:         cfg,
 		logger:      logger,
+		pending:     make(map[int64]struct{}),
 	}
 }
 
+func recommendationsCacheKey(userID int64) string {
+	return fmt.Sprintf("recommendations:user:%d", userID)
+}
+
 func (s *recommendationService) GenerateRecommendations(ctx context.Context, userID int64, productID int64) error {
 	s.logger.Printf("Generating recommendations for user ID: %d and product ID: %d", userID, productID)
 	rec := &models.Recommendation{
@@ -52,21 +127,17 @@ func (s *recommendationService) GenerateRecommendations(ctx context.Context, use
 		return err
 	}
 
-	cacheKey := fmt.Sprintf("recommendations:user:%d", userID)
+	cacheKey := recommendationsCacheKey(userID)
 	s.redisClient.Delete(ctx, cacheKey)
 	s.logger.Printf("Cache cleared for user ID: %d", userID)
 
-	message := map[string]interface{}{
-		"event":          "recommendation_created",
-		"recommendation": rec,
-	}
 	s.logger.Println("Publishing recommendation creation event")
-	return s.publishMessage(message)
+	return s.publishMessage(rec.UserID, events.RecommendationCreated, toRecommendationCreatedEvent(rec))
 }
 
 func (s *recommendationService) GetLatestRecommendation(ctx context.Context, userID int64) ([]int64, error) {
 	s.logger.Printf("Fetching latest recommendations for user ID: %d", userID)
-	cacheKey := fmt.Sprintf("recommendations:user:%d", userID)
+	cacheKey := recommendationsCacheKey(userID)
 
 	cachedData, err := s.redisClient.Get(ctx, cacheKey)
 	if err == nil && cachedData != "" {
@@ -78,114 +149,360 @@ func (s *recommendationService) GetLatestRecommendation(ctx context.Context, use
 	}
 	s.logger.Printf("Cache miss for user ID: %d, querying repository", userID)
 
-	recommendedPIDs, err := s.repo.GetTopProductsByUserPreference(ctx, userID, 5)
+	return s.computeRecommendations(ctx, userID)
+}
+
+func (s *recommendationService) computeRecommendations(ctx context.Context, userID int64) ([]int64, error) {
+	candidates, err := s.repo.GetCandidateProducts(ctx, userID, recommendationsLimit*candidatePoolFactor)
 	if err != nil {
 		s.logger.Printf("Failed to fetch recommendations from repository: %v", err)
 		return nil, err
 	}
 
+	var band *models.PriceBand
+	if len(candidates) > 0 {
+		band, err = s.GetUserPriceBand(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if !band.Reliable {
+			band = nil
+		}
+	}
+
+	recommendedPIDs := rankCandidates(candidates, band, s.cfg.Price, recommendationsLimit)
+
+	slots := s.cfg.Trending.Slots
+	if len(candidates) == 0 {
+		slots = recommendationsLimit
+	}
+	if slots > 0 {
+		trending, err := s.getTrendingProductIDs(ctx, candidateCategories(candidates), recommendationsLimit)
+		if err != nil {
+			s.logger.Printf("Failed to fetch trending candidates, using personalized list only: %v", err)
+		} else {
+			recommendedPIDs = blendTrending(recommendedPIDs, trending, slots, recommendationsLimit)
+		}
+	}
+
 	dataToCache, _ := json.Marshal(recommendedPIDs)
-	s.redisClient.Set(ctx, cacheKey, string(dataToCache), time.Hour)
+	s.redisClient.Set(ctx, recommendationsCacheKey(userID), string(dataToCache), time.Hour)
 	s.logger.Printf("Recommendations cached for user ID: %d", userID)
 
 	return recommendedPIDs, nil
 }
 
-func (s *recommendationService) ProcessKafkaMessage(ctx context.Context, m kafka_go.Message) error {
-	s.logger.Println("Processing Kafka message")
-
-	var msg map[string]interface{}
-	if err := json.Unmarshal(m.Value, &msg); err != nil {
-		s.logger.Printf("Failed to unmarshal message: %v", err)
-		return fmt.Errorf("failed to unmarshal message: %w", err)
-	}
+// GetBatchRecommendations emits cached recommendations first and computes the
+// rest with bounded concurrency. emit is never called concurrently.
+func (s *recommendationService) GetBatchRecommendations(ctx context.Context, userIDs []int64, emit func(*models.BatchRecommendation) error) error {
+	s.logger.Printf("Fetching batch recommendations for %d users", len(userIDs))
 
-	event, ok := msg["event"].(string)
-	if !ok {
-		s.logger.Println("Event type missing or invalid in message")
-		return errors.New("event type missing or invalid")
+	seen := make(map[int64]struct{}, len(userIDs))
+	unique := make([]int64, 0, len(userIDs))
+	for _, id := range userIDs {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		unique = append(unique, id)
 	}
 
-	s.logger.Printf("Event type: %s", event)
+	var misses []int64
+	for start := 0; start < len(unique); start += batchCacheChunkSize {
+		end := start + batchCacheChunkSize
+		if end > len(unique) {
+			end = len(unique)
+		}
+		chunk := unique[start:end]
 
-	switch event {
-	case "user_liked":
-		userID, productID, err := extractUserAndProductID(msg)
-		if err != nil {
-			s.logger.Printf("Parse error: %v", err)
-			return nil
+		keys := make([]string, len(chunk))
+		for i, id := range chunk {
+			keys[i] = recommendationsCacheKey(id)
 		}
 
-		category, err := s.repo.GetProductCategory(ctx, productID)
+		cached, err := s.redisClient.MGet(ctx, keys...)
 		if err != nil {
-			s.logger.Printf("Failed to get product category for product ID %d: %v", productID, err)
-			return nil
+			s.logger.Printf("Failed to read batch from cache, computing %d users: %v", len(chunk), err)
+			misses = append(misses, chunk...)
+			continue
 		}
 
-		if err := s.repo.UpdateUserCategoryScore(ctx, userID, category, 2.0); err != nil {
-			s.logger.Printf("Failed to update user category score: %v", err)
+		for i, id := range chunk {
+			var productIDs []int64
+			if cached[i] == "" || json.Unmarshal([]byte(cached[i]), &productIDs) != nil {
+				misses = append(misses, id)
+				continue
+			}
+			if err := emit(&models.BatchRecommendation{UserID: id, ProductIDs: productIDs, Cached: true}); err != nil {
+				return err
+			}
 		}
+	}
 
-	case "user_disliked":
-		userID, productID, err := extractUserAndProductID(msg)
-		if err != nil {
-			s.logger.Printf("Parse error: %v", err)
-			return nil
-		}
+	s.logger.Printf("Batch cache hits: %d, misses: %d", len(unique)-len(misses), len(misses))
+	if len(misses) == 0 {
+		return nil
+	}
 
-		category, err := s.repo.GetProductCategory(ctx, productID)
-		if err != nil {
-			s.logger.Printf("Failed to get product category for product ID %d: %v", productID, err)
-			return nil
-		}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan int64)
+	results := make(chan *models.BatchRecommendation)
 
-		if err := s.repo.UpdateUserCategoryScore(ctx, userID, category, -1.0); err != nil {
-			s.logger.Printf("Failed to update user category score: %v", err)
+	var wg sync.WaitGroup
+	workers := s.cfg.BatchConcurrency
+	if workers > len(misses) {
+		workers = len(misses)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range jobs {
+				res := &models.BatchRecommendation{UserID: id}
+				productIDs, err := s.computeRecommendations(ctx, id)
+				if err != nil {
+					res.Error = err.Error()
+				} else {
+					res.ProductIDs = productIDs
+				}
+				select {
+				case results <- res:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for _, id := range misses {
+			select {
+			case jobs <- id:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	for res := range results {
+		if err := emit(res); err != nil {
+			cancel()
+			for range results {
+			}
+			return err
 		}
+	}
 
-	case "user_purchased":
-		userID, productID, err := extractUserAndProductID(msg)
-		if err != nil {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *recommendationService) ProcessKafkaMessage(ctx context.Context, m kafka_go.Message) error {
+	s.logger.Println("Processing Kafka message")
+
+	env, err := events.DecodeMessage(m)
+	if err != nil {
+		s.logger.Printf("Failed to decode message: %v", err)
+		return kafka.Quarantine(fmt.Errorf("failed to decode message: %w", err))
+	}
+	if err := events.Validate(env); err != nil {
+		s.logger.Printf("Invalid event %s: %v", env.ID, err)
+		return kafka.Quarantine(err)
+	}
+
+	s.logger.Printf("Event type: %s, version: %d, ID: %s", env.Type, env.Version, env.ID)
+
+	switch env.Type {
+	case events.UserLiked, events.UserDisliked, events.UserPurchased:
+		var interaction events.Interaction
+		if err := env.DecodeData(&interaction); err != nil {
 			s.logger.Printf("Parse error: %v", err)
-			return nil
+			return kafka.Quarantine(err)
 		}
 
-		category, err := s.repo.GetProductCategory(ctx, productID)
-		if err != nil {
-			s.logger.Printf("Failed to get product category for product ID %d: %v", productID, err)
+		eventID := events.MessageID(env, m.Topic, m.Partition, m.Offset)
+		applied := false
+		err := s.repo.WithinTx(ctx, func(ctx context.Context) error {
+			first, err := s.processed.MarkProcessed(ctx, eventID)
+			if err != nil {
+				s.logger.Printf("Failed to mark event %s as processed: %v", eventID, err)
+				return err
+			}
+			if !first {
+				s.logger.Printf("Event %s already processed, skipping", eventID)
+				return nil
+			}
+
+			category, err := s.repo.GetProductCategory(ctx, interaction.ProductID)
+			if err != nil {
+				s.logger.Printf("Failed to get product category for product ID %d: %v", interaction.ProductID, err)
+				return fmt.Errorf("failed to get product category: %w", err)
+			}
+
+			if err := s.repo.UpdateUserCategoryScore(ctx, interaction.UserID, category, categoryScoreDeltas[env.Type]); err != nil {
+				s.logger.Printf("Failed to update user category score: %v", err)
+				return fmt.Errorf("failed to update user category score: %w", err)
+			}
+			applied = true
 			return nil
+		})
+		if err != nil {
+			return err
 		}
-
-		if err := s.repo.UpdateUserCategoryScore(ctx, userID, category, 5.0); err != nil {
-			s.logger.Printf("Failed to update user category score: %v", err)
+		if applied && s.cfg.RefreshInterval > 0 {
+			s.queueRefresh(interaction.UserID)
 		}
 
-	case "product_created", "product_updated":
-		s.logger.Printf("[INFO] Product event: %s", event)
+	case events.ProductCreated, events.ProductUpdated, events.ProductDeleted:
+		s.logger.Printf("[INFO] Product event: %s", env.Type)
+
+	case events.UserCreated, events.UserUpdated:
+		s.logger.Printf("[INFO] User event: %s", env.Type)
 
 	default:
-		s.logger.Printf("[WARN] Unhandled event type: %s", event)
+		s.logger.Printf("[WARN] Unhandled event type: %s", env.Type)
 	}
 
 	s.logger.Println("Kafka message processing completed")
 	return nil
 }
 
-func extractUserAndProductID(msg map[string]interface{}) (int64, int64, error) {
-	userIDFloat, ok1 := msg["user_id"].(float64)
-	productIDFloat, ok2 := msg["product_id"].(float64)
-	if !ok1 || !ok2 {
-		return 0, 0, fmt.Errorf("failed to parse user_id or product_id from message")
+func (s *recommendationService) getTrendingProductIDs(ctx context.Context, categories []string, limit int) ([]int64, error) {
+	return s.repo.GetTrendingProductIDs(ctx, s.cfg.Trending.Query(time.Now(), categories, limit))
+}
+
+func (s *recommendationService) GetUserPriceBand(ctx context.Context, userID int64) (*models.PriceBand, error) {
+	s.logger.Printf("Learning price band for user ID: %d", userID)
+	band, err := s.repo.GetUserPriceBand(ctx, userID)
+	if err != nil {
+		s.logger.Printf("Failed to fetch price band from repository: %v", err)
+		return nil, err
 	}
-	return int64(userIDFloat), int64(productIDFloat), nil
+	band.Reliable = band.Purchases >= s.cfg.Price.MinPurchases
+	return band, nil
+}
+
+var categoryScoreDeltas = map[string]float64{
+	events.UserLiked:     2.0,
+	events.UserDisliked:  -1.0,
+	events.UserPurchased: 5.0,
 }
 
-func (s *recommendationService) publishMessage(message interface{}) error {
-	valueBytes, err := json.Marshal(message)
+// RefreshRecommendations regenerates the user's list after their preferences
+// changed, stores and caches it, and announces it on recommendation_updates.
+func (s *recommendationService) RefreshRecommendations(ctx context.Context, userID int64) ([]int64, error) {
+	s.logger.Printf("Refreshing recommendations for user ID: %d", userID)
+	productIDs, err := s.computeRecommendations(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &models.Recommendation{
+		UserID:     userID,
+		ProductIDs: make([]int, len(productIDs)),
+	}
+	for i, id := range productIDs {
+		rec.ProductIDs[i] = int(id)
+	}
+
+	if err := s.repo.CreateRecommendation(ctx, rec); err != nil {
+		s.logger.Printf("Failed to store refreshed recommendation: %v", err)
+		return nil, err
+	}
+
+	s.logger.Println("Publishing refreshed recommendation event")
+	if err := s.publishMessage(rec.UserID, events.RecommendationCreated, toRecommendationCreatedEvent(rec)); err != nil {
+		return nil, err
+	}
+
+	return productIDs, nil
+}
+
+func (s *recommendationService) queueRefresh(userID int64) {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	s.pending[userID] = struct{}{}
+}
+
+// RefreshPending regenerates the lists of the users queued by
+// ProcessKafkaMessage since the previous call. Users whose refresh fails or is
+// cut short by ctx are queued again for the next call.
+func (s *recommendationService) RefreshPending(ctx context.Context) error {
+	s.pendingMu.Lock()
+	pending := s.pending
+	s.pending = make(map[int64]struct{})
+	s.pendingMu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+	s.logger.Printf("Refreshing recommendations for %d users", len(pending))
+
+	failed := 0
+	for userID := range pending {
+		if ctx.Err() != nil {
+			s.queueRefresh(userID)
+			continue
+		}
+		if _, err := s.RefreshRecommendations(ctx, userID); err != nil {
+			s.logger.Printf("Failed to refresh recommendations for user ID %d: %v", userID, err)
+			s.queueRefresh(userID)
+			failed++
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to refresh recommendations for %d of %d users", failed, len(pending))
+	}
+	return nil
+}
+
+func toRecommendationCreatedEvent(rec *models.Recommendation) events.RecommendationCreatedEvent {
+	productIDs := make([]int64, len(rec.ProductIDs))
+	for i, id := range rec.ProductIDs {
+		productIDs[i] = int64(id)
+	}
+	return events.RecommendationCreatedEvent{
+		RecommendationID: rec.ID,
+		UserID:           rec.UserID,
+		ProductIDs:       productIDs,
+		CreatedAt:        rec.CreatedAt,
+	}
+}
+
+// publishMessage keys the event by user ID, so updates of one user stay in
+// order on a single partition.
+func (s *recommendationService) publishMessage(userID int64, eventType string, payload interface{}) error {
+	env, err := events.New("recommendation-service", eventType, payload)
+	if err != nil {
+		s.logger.Printf("Failed to marshal message: %v", err)
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	msg, err := events.NewMessage(s.topic, []byte(strconv.FormatInt(userID, 10)), env, s.cfg.EventMode)
 	if err != nil {
 		s.logger.Printf("Failed to marshal message: %v", err)
 		return fmt.Errorf("failed to marshal message: %w", err)
 	}
 	s.logger.Printf("Publishing message to topic %s", s.topic)
-	return s.kafka.PublishMessage(s.topic, nil, valueBytes)
+	return s.kafka.PublishMessages(context.Background(), msg)
+}
+
+func (s *recommendationService) PruneProcessedEvents(ctx context.Context) error {
+	before := time.Now().UTC().Add(-s.cfg.ProcessedRetention)
+	s.logger.Printf("Pruning processed events older than %s", before.Format(time.RFC3339))
+	_, err := s.processed.DeleteProcessedBefore(ctx, before)
+	return err
 }
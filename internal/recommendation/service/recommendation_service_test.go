@@ -0,0 +1,436 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"recommendation-system/internal/recommendation/models"
+	"recommendation-system/internal/recommendation/repository"
+	"recommendation-system/pkg/events"
+	"recommendation-system/pkg/kafka"
+	log "recommendation-system/pkg/logger"
+
+	kafkaGo "github.com/segmentio/kafka-go"
+)
+
+// recommendationStore keeps the category scores and processed events of the
+// recommendation service in memory. WithinTx rolls both back when fn fails,
+// like the Postgres transaction it stands in for.
+type recommendationStore struct {
+	repository.RecommendationRepository
+
+	mu         sync.Mutex
+	categories map[int64]string
+	scores     map[string]float64
+	processed  map[string]bool
+	failScores int
+
+	created     []int64
+	failCreates int
+}
+
+// memoryCache stands in for Redis.
+type memoryCache struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func (c *memoryCache) Get(ctx context.Context, key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[key], nil
+}
+
+func (c *memoryCache) MGet(ctx context.Context, keys ...string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		values[i] = c.values[key]
+	}
+	return values, nil
+}
+
+func (c *memoryCache) Set(ctx context.Context, key string, value string, expiration time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] = value
+	return nil
+}
+
+func (c *memoryCache) Delete(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.values, key)
+	return nil
+}
+
+func newRecommendationStore(categories map[int64]string) *recommendationStore {
+	return &recommendationStore{
+		categories: categories,
+		scores:     make(map[string]float64),
+		processed:  make(map[string]bool),
+	}
+}
+
+func (s *recommendationStore) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	s.mu.Lock()
+	scores := make(map[string]float64, len(s.scores))
+	for k, v := range s.scores {
+		scores[k] = v
+	}
+	processed := make(map[string]bool, len(s.processed))
+	for k, v := range s.processed {
+		processed[k] = v
+	}
+	s.mu.Unlock()
+
+	err := fn(ctx)
+	if err != nil {
+		s.mu.Lock()
+		s.scores, s.processed = scores, processed
+		s.mu.Unlock()
+	}
+	return err
+}
+
+func (s *recommendationStore) GetProductCategory(ctx context.Context, productID int64) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.categories[productID], nil
+}
+
+func (s *recommendationStore) UpdateUserCategoryScore(ctx context.Context, userID int64, category string, delta float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failScores > 0 {
+		s.failScores--
+		return errors.New("connection reset")
+	}
+	s.scores[category] += delta
+	return nil
+}
+
+func (s *recommendationStore) MarkProcessed(ctx context.Context, eventID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.processed[eventID] {
+		return false, nil
+	}
+	s.processed[eventID] = true
+	return true, nil
+}
+
+func (s *recommendationStore) DeleteProcessedBefore(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (s *recommendationStore) GetCandidateProducts(ctx context.Context, userID int64, limit int) ([]*models.CandidateProduct, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var candidates []*models.CandidateProduct
+	for productID, category := range s.categories {
+		candidates = append(candidates, &models.CandidateProduct{ProductID: productID, Category: category, CategoryScore: s.scores[category]})
+	}
+	return candidates, nil
+}
+
+func (s *recommendationStore) GetUserPriceBand(ctx context.Context, userID int64) (*models.PriceBand, error) {
+	return &models.PriceBand{UserID: userID}, nil
+}
+
+func (s *recommendationStore) CreateRecommendation(ctx context.Context, rec *models.Recommendation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failCreates > 0 {
+		s.failCreates--
+		return errors.New("connection reset")
+	}
+	s.created = append(s.created, rec.UserID)
+	rec.ID = int64(len(s.created))
+	rec.CreatedAt = time.Now().UTC()
+	return nil
+}
+
+func (s *recommendationStore) score(category string) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.scores[category]
+}
+
+// TestProcessKafkaMessage publishes events of the user service through the
+// in-memory broker, laid out like the outbox relay does, to the Kafka handler
+// of the recommendation service, in both CloudEvents modes.
+func TestProcessKafkaMessage(t *testing.T) {
+	for _, mode := range []events.Mode{events.ModeStructured, events.ModeBinary} {
+		t.Run(string(mode), func(t *testing.T) {
+			testProcessKafkaMessage(t, mode)
+		})
+	}
+}
+
+func newTestLogger(t *testing.T) *log.Logger {
+	t.Helper()
+	logger, err := log.NewLogger(filepath.Join(t.TempDir(), "test.log"), "test", "recommendation-system", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return logger
+}
+
+func testProcessKafkaMessage(t *testing.T, mode events.Mode) {
+	logger := newTestLogger(t)
+
+	broker := kafka.NewMemoryBroker(4)
+	broker.Retry = kafka.RetryConfig{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	defer broker.Close()
+
+	store := newRecommendationStore(map[int64]string{10: "books", 11: "games"})
+	// The first score update fails and must be retried without marking the
+	// event as processed.
+	store.failScores = 1
+	svc := NewRecommendationService(store, store, broker, nil, Config{}, logger)
+
+	now := time.Now().UTC()
+	var msgs []kafkaGo.Message
+	publish := func(eventType string, payload interface{}) {
+		env, err := events.New("user-service", eventType, payload)
+		if err != nil {
+			t.Fatalf("failed to build %s: %v", eventType, err)
+		}
+		m, err := events.NewMessage("user_updates", []byte("1"), env, mode)
+		if err != nil {
+			t.Fatalf("failed to lay out %s: %v", eventType, err)
+		}
+		msgs = append(msgs, m)
+	}
+	publish(events.UserLiked, events.UserLikedEvent{Interaction: events.Interaction{UserID: 1, ProductID: 10}, LikedAt: now})
+	publish(events.UserLiked, events.UserLikedEvent{Interaction: events.Interaction{UserID: 1, ProductID: 11}, LikedAt: now})
+	publish(events.UserDisliked, events.UserDislikedEvent{Interaction: events.Interaction{UserID: 1, ProductID: 10}, DislikedAt: now})
+	publish(events.UserPurchased, events.UserPurchasedEvent{Interaction: events.Interaction{UserID: 1, ProductID: 11}, PurchaseID: 7, Price: 19.99, PurchasedAt: now})
+	// An event published twice, e.g. by a relay that crashed before marking
+	// it published, is applied once.
+	msgs = append(msgs, msgs[3])
+	// A message that is not an event is quarantined.
+	msgs = append(msgs, kafkaGo.Message{Topic: "user_updates", Key: []byte("1"), Value: []byte("not an event")})
+
+	if err := broker.PublishMessages(context.Background(), msgs...); err != nil {
+		t.Fatalf("failed to publish events: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan kafkaGo.Message, len(msgs))
+	done := make(chan error, 1)
+	go func() {
+		done <- broker.SubscribeToTopicsFallback(ctx, []string{"user_updates"}, "recommendation_service_group", func(m kafkaGo.Message) error {
+			err := svc.ProcessKafkaMessage(context.Background(), m)
+			if err == nil || kafka.IsPermanent(err) {
+				finished <- m
+			}
+			return err
+		})
+	}()
+
+	for i := 0; i < len(msgs); i++ {
+		select {
+		case m := <-finished:
+			if m.Offset != int64(i) {
+				t.Errorf("message %d finished out of order, at offset %d", i, m.Offset)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only %d of %d messages were handled", i, len(msgs))
+		}
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("consumer stopped with error: %v", err)
+	}
+
+	if store.failScores != 0 {
+		t.Errorf("the failing score update was not retried")
+	}
+	if got := store.score("books"); got != 1 {
+		t.Errorf("books score = %v, want 1 (like 2, dislike -1)", got)
+	}
+	if got := store.score("games"); got != 7 {
+		t.Errorf("games score = %v, want 7 (like 2, purchase 5, duplicate ignored)", got)
+	}
+
+	quarantined := readTopic(t, broker, kafka.QuarantineTopic("user_updates"), 1)
+	if string(quarantined[0].Value) != "not an event" {
+		t.Errorf("quarantined %q, want the invalid row", quarantined[0].Value)
+	}
+
+	// Every handled message was committed, so the group resumes after them.
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := broker.SubscribeToTopicsFallback(ctx, []string{"user_updates"}, "recommendation_service_group", func(m kafkaGo.Message) error {
+		t.Errorf("message at offset %d redelivered after it was committed", m.Offset)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("consumer stopped with error: %v", err)
+	}
+}
+
+func readTopic(t *testing.T, broker *kafka.MemoryBroker, topic string, n int) []kafkaGo.Message {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan kafkaGo.Message, n)
+	go broker.SubscribeToTopicsFallback(ctx, []string{topic}, "test_reader", func(m kafkaGo.Message) error {
+		received <- m
+		return nil
+	})
+
+	msgs := make([]kafkaGo.Message, 0, n)
+	for len(msgs) < n {
+		select {
+		case m := <-received:
+			msgs = append(msgs, m)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("read %d of %d messages from %s", len(msgs), n, topic)
+		}
+	}
+	return msgs
+}
+
+// TestProcessKafkaMessageQuarantinesInvalidEvents checks that events which do
+// not match their schema are quarantined without being applied.
+func TestProcessKafkaMessageQuarantinesInvalidEvents(t *testing.T) {
+	logger := newTestLogger(t)
+
+	broker := kafka.NewMemoryBroker(1)
+	broker.Retry = kafka.RetryConfig{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	defer broker.Close()
+
+	store := newRecommendationStore(map[int64]string{10: "books"})
+	svc := NewRecommendationService(store, store, broker, nil, Config{}, logger)
+
+	// New refuses invalid payloads, so the producer bug is laid out by hand.
+	var msgs []kafkaGo.Message
+	for i, mode := range []events.Mode{events.ModeStructured, events.ModeBinary} {
+		env := &events.Envelope{
+			ID:        "invalid-" + string(mode),
+			Type:      events.UserLiked,
+			Version:   events.CurrentVersion,
+			Timestamp: time.Now().UTC(),
+			Producer:  "user-service",
+			Data:      []byte(`{"user_id":0,"product_id":10}`),
+		}
+		m, err := events.NewMessage("user_updates", []byte("0"), env, mode)
+		if err != nil {
+			t.Fatalf("failed to lay out event %d: %v", i, err)
+		}
+		msgs = append(msgs, m)
+	}
+	if err := broker.PublishMessages(context.Background(), msgs...); err != nil {
+		t.Fatalf("failed to publish events: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- broker.SubscribeToTopicsFallback(ctx, []string{"user_updates"}, "recommendation_service_group", func(m kafkaGo.Message) error {
+			return svc.ProcessKafkaMessage(context.Background(), m)
+		})
+	}()
+
+	quarantined := readTopic(t, broker, kafka.QuarantineTopic("user_updates"), len(msgs))
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("consumer stopped with error: %v", err)
+	}
+
+	for i, m := range quarantined {
+		if got := kafka.HeaderValue(m, kafka.HeaderDLQError); !strings.Contains(got, events.ErrInvalidEvent.Error()) {
+			t.Errorf("message %d quarantined with error %q, want an invalid event", i, got)
+		}
+		if got := kafka.HeaderValue(m, kafka.HeaderDLQAttempts); got != "1" {
+			t.Errorf("message %d quarantined after %s attempts, want 1", i, got)
+		}
+	}
+	if got := store.score("books"); got != 0 {
+		t.Errorf("books score = %v, want the invalid events ignored", got)
+	}
+}
+
+// TestRefreshPending checks that the interactions of a user since the
+// previous refresh lead to one new list and one recommendation_created event.
+func TestRefreshPending(t *testing.T) {
+	logger := newTestLogger(t)
+
+	broker := kafka.NewMemoryBroker(1)
+	defer broker.Close()
+
+	store := newRecommendationStore(map[int64]string{10: "books", 11: "games"})
+	cache := &memoryCache{values: make(map[string]string)}
+	svc := NewRecommendationService(store, store, broker, cache, Config{RefreshInterval: time.Minute}, logger)
+
+	process := func(userID, productID int64) {
+		t.Helper()
+		env, err := events.New("user-service", events.UserLiked, events.UserLikedEvent{
+			Interaction: events.Interaction{UserID: userID, ProductID: productID},
+			LikedAt:     time.Now().UTC(),
+		})
+		if err != nil {
+			t.Fatalf("failed to build event: %v", err)
+		}
+		m, err := events.NewMessage("user_updates", []byte(strconv.FormatInt(userID, 10)), env, events.ModeStructured)
+		if err != nil {
+			t.Fatalf("failed to lay out event: %v", err)
+		}
+		if err := svc.ProcessKafkaMessage(context.Background(), m); err != nil {
+			t.Fatalf("failed to process event: %v", err)
+		}
+	}
+	process(1, 10)
+	process(1, 11)
+	process(1, 10)
+	process(2, 11)
+
+	// The first attempt fails and the users are refreshed on the next call.
+	store.failCreates = 2
+	if err := svc.RefreshPending(context.Background()); err == nil {
+		t.Fatal("RefreshPending() succeeded although storing failed")
+	}
+	if err := svc.RefreshPending(context.Background()); err != nil {
+		t.Fatalf("RefreshPending() error = %v", err)
+	}
+	if err := svc.RefreshPending(context.Background()); err != nil {
+		t.Fatalf("RefreshPending() error = %v", err)
+	}
+	if len(store.created) != 2 {
+		t.Fatalf("stored %d lists for users %v, want one per user", len(store.created), store.created)
+	}
+
+	users := make(map[int64]bool)
+	for _, m := range readTopic(t, broker, "recommendation_updates", 2) {
+		env, err := events.DecodeMessage(m)
+		if err != nil {
+			t.Fatalf("failed to decode %s: %v", m.Value, err)
+		}
+		var e events.RecommendationCreatedEvent
+		if err := env.DecodeData(&e); err != nil {
+			t.Fatalf("failed to decode %s: %v", m.Value, err)
+		}
+		if env.Type != events.RecommendationCreated || string(m.Key) != strconv.FormatInt(e.UserID, 10) || len(e.ProductIDs) == 0 {
+			t.Errorf("published %s for user %d with key %s and products %v", env.Type, e.UserID, m.Key, e.ProductIDs)
+		}
+		users[e.UserID] = true
+	}
+	if !users[1] || !users[2] {
+		t.Errorf("published lists of users %v, want 1 and 2", users)
+	}
+	if cache.values[recommendationsCacheKey(1)] == "" {
+		t.Error("refreshed list of user 1 was not cached")
+	}
+}
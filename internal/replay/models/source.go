@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+type Interaction struct {
+    Kind       string    `db:"kind" json:"kind"`
+    ID         int64     `db:"id" json:"id"`
+    UserID     int64     `db:"user_id" json:"user_id"`
+    ProductID  int64     `db:"product_id" json:"product_id"`
+    Price      float64   `db:"price" json:"price"`
+    OccurredAt time.Time `db:"occurred_at" json:"occurred_at"`
+}
+
+type Product struct {
+    ID          int64     `db:"id" json:"id"`
+    Name        string    `db:"name" json:"name"`
+    Description string    `db:"description" json:"description"`
+    Price       float64   `db:"price" json:"price"`
+    Category    string    `db:"category" json:"category"`
+    CreatedAt   time.Time `db:"created_at" json:"created_at"`
+    UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type RebuildResult struct {
+    Products     int `json:"products"`
+    Interactions int `json:"interactions"`
+    Users        int `json:"users"`
+    Failed       int `json:"failed"`
+}
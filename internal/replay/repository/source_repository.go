@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"recommendation-system/internal/replay/models"
+	"recommendation-system/pkg/db"
+	log "recommendation-system/pkg/logger"
+)
+
+// Interaction kinds returned by StreamInteractions.
+const (
+	KindLike     = "like"
+	KindDislike  = "dislike"
+	KindPurchase = "purchase"
+)
+
+type SourceRepository interface {
+	StreamProducts(ctx context.Context, fn func(*models.Product) error) error
+	StreamInteractions(ctx context.Context, fn func(*models.Interaction) error) error
+	TruncateAnalytics(ctx context.Context) error
+	TruncatePreferences(ctx context.Context) error
+}
+
+type sourceRepository struct {
+	db     *db.DB
+	logger *log.Logger
+}
+
+func NewSourceRepository(database *db.DB, logger *log.Logger) SourceRepository {
+	return &sourceRepository{db: database, logger: logger}
+}
+
+func (r *sourceRepository) StreamProducts(ctx context.Context, fn func(*models.Product) error) error {
+	r.logger.Println("Streaming products")
+	query := `
+        SELECT id, name, description, price::float8, category, created_at, updated_at
+        FROM products
+        ORDER BY id
+    `
+	rows, err := r.db.Pool.Query(ctx, query)
+	if err != nil {
+		r.logger.Printf("Failed to get products: %v", err)
+		return fmt.Errorf("failed to get products: %w", err)
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		var p models.Product
+		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.Price, &p.Category, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			r.logger.Printf("Failed to scan product: %v", err)
+			return fmt.Errorf("failed to scan product: %w", err)
+		}
+		if err := fn(&p); err != nil {
+			return err
+		}
+		count++
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.Printf("Rows error: %v", err)
+		return fmt.Errorf("rows error: %w", err)
+	}
+
+	r.logger.Printf("Streamed %d products", count)
+	return nil
+}
+
+// StreamInteractions yields likes, dislikes and purchases merged in the order
+// they happened.
+func (r *sourceRepository) StreamInteractions(ctx context.Context, fn func(*models.Interaction) error) error {
+	r.logger.Println("Streaming interactions")
+	query := `
+        SELECT kind, id, user_id, product_id, price, occurred_at
+        FROM (
+            SELECT 'like' AS kind, id, user_id, product_id, 0::float8 AS price, liked_at AS occurred_at FROM likes
+            UNION ALL
+            SELECT 'dislike', id, user_id, product_id, 0::float8, disliked_at FROM dislikes
+            UNION ALL
+            SELECT 'purchase', id, user_id, product_id, price::float8, purchased_at FROM purchases
+        ) interactions
+        ORDER BY occurred_at, kind, id
+    `
+	rows, err := r.db.Pool.Query(ctx, query)
+	if err != nil {
+		r.logger.Printf("Failed to get interactions: %v", err)
+		return fmt.Errorf("failed to get interactions: %w", err)
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		var i models.Interaction
+		if err := rows.Scan(&i.Kind, &i.ID, &i.UserID, &i.ProductID, &i.Price, &i.OccurredAt); err != nil {
+			r.logger.Printf("Failed to scan interaction: %v", err)
+			return fmt.Errorf("failed to scan interaction: %w", err)
+		}
+		if err := fn(&i); err != nil {
+			return err
+		}
+		count++
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.Printf("Rows error: %v", err)
+		return fmt.Errorf("rows error: %w", err)
+	}
+
+	r.logger.Printf("Streamed %d interactions", count)
+	return nil
+}
+
+// TruncateAnalytics clears the tables rebuilt from the source tables. Views
+// are only recorded in the event stream and cannot be replayed, so the views
+// in statistics are kept and only its purchases are reset. For the same reason
+// user_cohorts and user_activity_weeks are kept; replaying into them is
+// idempotent.
+func (r *sourceRepository) TruncateAnalytics(ctx context.Context) error {
+	r.logger.Println("Truncating analytics tables")
+	query := `
+        TRUNCATE product_analytics, user_analytics, product_activity,
+                 product_analytics_hourly, product_analytics_daily,
+                 user_analytics_hourly, user_analytics_daily,
+                 category_revenue_daily, category_analytics, category_users;
+        UPDATE statistics SET purchases = 0, updated_at = NOW() WHERE purchases <> 0
+    `
+	if _, err := r.db.Pool.Exec(ctx, query); err != nil {
+		r.logger.Printf("Failed to truncate analytics tables: %v", err)
+		return fmt.Errorf("failed to truncate analytics tables: %w", err)
+	}
+	r.logger.Println("Analytics tables truncated")
+	return nil
+}
+
+func (r *sourceRepository) TruncatePreferences(ctx context.Context) error {
+	r.logger.Println("Truncating user category preferences")
+	query := `
+        TRUNCATE user_category_preferences
+    `
+	if _, err := r.db.Pool.Exec(ctx, query); err != nil {
+		r.logger.Printf("Failed to truncate user category preferences: %v", err)
+		return fmt.Errorf("failed to truncate user category preferences: %w", err)
+	}
+	r.logger.Println("User category preferences truncated")
+	return nil
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	analyticsService "recommendation-system/internal/analytics/service"
+	recommendationService "recommendation-system/internal/recommendation/service"
+	"recommendation-system/internal/replay/models"
+	"recommendation-system/internal/replay/repository"
+	"recommendation-system/pkg/events"
+	log "recommendation-system/pkg/logger"
+
+	kafka_go "github.com/segmentio/kafka-go"
+)
+
+const producer = "replay"
+
+type RebuildOptions struct {
+	Analytics       bool
+	Recommendations bool
+	// Refresh regenerates the recommendation list of every user seen in the
+	// replayed interactions once the preferences are rebuilt.
+	Refresh bool
+}
+
+type ReplayService interface {
+	Rebuild(ctx context.Context, opts RebuildOptions) (*models.RebuildResult, error)
+}
+
+type replayService struct {
+	repo            repository.SourceRepository
+	analytics       analyticsService.AnalyticsService
+	recommendations recommendationService.RecommendationService
+	logger          *log.Logger
+}
+
+func NewReplayService(repo repository.SourceRepository, analytics analyticsService.AnalyticsService, recommendations recommendationService.RecommendationService, logger *log.Logger) ReplayService {
+	return &replayService{
+		repo:            repo,
+		analytics:       analytics,
+		recommendations: recommendations,
+		logger:          logger,
+	}
+}
+
+// Rebuild clears the derived tables of the selected consumers and feeds
+// events synthesized from the source tables through their handlers. The
+// source tables hold the current state only, so a like that was later turned
+// into a dislike is replayed as the dislike alone.
+func (s *replayService) Rebuild(ctx context.Context, opts RebuildOptions) (*models.RebuildResult, error) {
+	var handlers []func(ctx context.Context, m kafka_go.Message) error
+	if opts.Analytics {
+		if err := s.repo.TruncateAnalytics(ctx); err != nil {
+			return nil, err
+		}
+		if err := s.analytics.ResetLeaderboards(ctx); err != nil {
+			return nil, err
+		}
+		handlers = append(handlers, s.analytics.ProcessKafkaMessage)
+	}
+	if opts.Recommendations {
+		if err := s.repo.TruncatePreferences(ctx); err != nil {
+			return nil, err
+		}
+		handlers = append(handlers, s.recommendations.ProcessKafkaMessage)
+	}
+
+	result := &models.RebuildResult{}
+	var offset int64
+	dispatch := func(topic string, key int64, eventType string, payload interface{}) error {
+		value, err := events.Marshal(producer, eventType, payload)
+		if err != nil {
+			return err
+		}
+		m := kafka_go.Message{
+			Topic:  topic,
+			Offset: offset,
+			Key:    []byte(strconv.FormatInt(key, 10)),
+			Value:  value,
+		}
+		offset++
+
+		for _, handle := range handlers {
+			if err := handle(ctx, m); err != nil {
+				s.logger.Printf("Failed to replay %s event for key %d: %v", eventType, key, err)
+				result.Failed++
+			}
+		}
+		return ctx.Err()
+	}
+
+	s.logger.Println("Replaying product events")
+	err := s.repo.StreamProducts(ctx, func(p *models.Product) error {
+		result.Products++
+		return dispatch("product_updates", p.ID, events.ProductCreated, events.ProductCreatedEvent{
+			Product: events.Product{
+				ID:          p.ID,
+				Name:        p.Name,
+				Description: p.Description,
+				Price:       p.Price,
+				Category:    p.Category,
+				CreatedAt:   p.CreatedAt,
+				UpdatedAt:   p.UpdatedAt,
+			},
+		})
+	})
+	if err != nil {
+		return result, fmt.Errorf("failed to replay products: %w", err)
+	}
+
+	s.logger.Println("Replaying interaction events")
+	users := make(map[int64]struct{})
+	err = s.repo.StreamInteractions(ctx, func(i *models.Interaction) error {
+		result.Interactions++
+		users[i.UserID] = struct{}{}
+
+		interaction := events.Interaction{UserID: i.UserID, ProductID: i.ProductID}
+		switch i.Kind {
+		case repository.KindLike:
+			return dispatch("user_updates", i.UserID, events.UserLiked, events.UserLikedEvent{Interaction: interaction, LikedAt: i.OccurredAt})
+		case repository.KindDislike:
+			return dispatch("user_updates", i.UserID, events.UserDisliked, events.UserDislikedEvent{Interaction: interaction, DislikedAt: i.OccurredAt})
+		case repository.KindPurchase:
+			return dispatch("user_updates", i.UserID, events.UserPurchased, events.UserPurchasedEvent{Interaction: interaction, PurchaseID: i.ID, Price: i.Price, PurchasedAt: i.OccurredAt})
+		}
+		return nil
+	})
+	if err != nil {
+		return result, fmt.Errorf("failed to replay interactions: %w", err)
+	}
+	result.Users = len(users)
+
+	if opts.Recommendations && opts.Refresh {
+		s.logger.Printf("Refreshing recommendations of %d users", len(users))
+		for userID := range users {
+			if _, err := s.recommendations.RefreshRecommendations(ctx, userID); err != nil {
+				s.logger.Printf("Failed to refresh recommendations for user ID %d: %v", userID, err)
+				result.Failed++
+			}
+			if ctx.Err() != nil {
+				return result, ctx.Err()
+			}
+		}
+	}
+
+	s.logger.Printf("Rebuild finished: %d products, %d interactions, %d users, %d failures", result.Products, result.Interactions, result.Users, result.Failed)
+	return result, nil
+}
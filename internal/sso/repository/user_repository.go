@@ -11,6 +11,8 @@ import (
 )
 
 type UserRepository interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+
 	CreateUser(ctx context.Context, user *models.UserSSO) error
 	GetUserByEmail(ctx context.Context, email string) (*models.UserSSO, error)
 }
@@ -24,6 +26,10 @@ func NewUserRepository(database *db.DB, logger *log.Logger) UserRepository {
 	return &userRepository{db: database, logger: logger}
 }
 
+func (r *userRepository) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return r.db.WithinTx(ctx, fn)
+}
+
 func (r *userRepository) CreateUser(ctx context.Context, user *models.UserSSO) error {
 	r.logger.Println("Creating new user")
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.PasswordHash), bcrypt.DefaultCost)
@@ -38,7 +44,7 @@ func (r *userRepository) CreateUser(ctx context.Context, user *models.UserSSO) e
 		RETURNING id, created_at, updated_at
 	`
 	r.logger.Printf("Executing query to insert user: %s", user.Email)
-	err = r.db.Pool.QueryRow(ctx, query, user.Name, user.Email, string(hashedPassword)).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+	err = r.db.Conn(ctx).QueryRow(ctx, query, user.Name, user.Email, string(hashedPassword)).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		r.logger.Printf("Failed to create user: %v", err)
 		return fmt.Errorf("failed to create user: %w", err)
@@ -57,7 +63,7 @@ func (r *userRepository) GetUserByEmail(ctx context.Context, email string) (*mod
 		FROM users
 		WHERE email = $1
 	`
-	err := r.db.Pool.QueryRow(ctx, query, email).Scan(&user.ID, &user.Name, &user.Email, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt)
+	err := r.db.Conn(ctx).QueryRow(ctx, query, email).Scan(&user.ID, &user.Name, &user.Email, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		r.logger.Printf("Failed to get user by email: %v", err)
 		return nil, fmt.Errorf("failed to get user by email: %w", err)
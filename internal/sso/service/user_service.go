@@ -2,13 +2,14 @@ package service
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"recommendation-system/internal/sso/models"
 	"recommendation-system/internal/sso/repository"
-	"recommendation-system/pkg/kafka"
+	"recommendation-system/pkg/events"
 	log "recommendation-system/pkg/logger"
+	"recommendation-system/pkg/outbox"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -26,16 +27,16 @@ type UserService interface {
 
 type userService struct {
 	repo   repository.UserRepository
-	kafka  *kafka.KafkaClient
+	outbox *outbox.Store
 	topic  string
 	jwtKey []byte
 	logger *log.Logger
 }
 
-func NewUserService(repo repository.UserRepository, kafkaClient *kafka.KafkaClient, jwtKey []byte, logger *log.Logger) UserService {
+func NewUserService(repo repository.UserRepository, outboxStore *outbox.Store, jwtKey []byte, logger *log.Logger) UserService {
 	return &userService{
 		repo:   repo,
-		kafka:  kafkaClient,
+		outbox: outboxStore,
 		topic:  "user_updates",
 		jwtKey: jwtKey,
 		logger: logger,
@@ -50,27 +51,32 @@ func (s *userService) RegisterUser(ctx context.Context, req *models.RegisterRequ
 		PasswordHash: req.Password,
 	}
 
-	s.logger.Printf("Creating user: %s", user.Email)
-	if err := s.repo.CreateUser(ctx, user); err != nil {
-		s.logger.Printf("Failed to create user: %v", err)
+	err := s.repo.WithinTx(ctx, func(ctx context.Context) error {
+		s.logger.Printf("Creating user: %s", user.Email)
+		if err := s.repo.CreateUser(ctx, user); err != nil {
+			s.logger.Printf("Failed to create user: %v", err)
+			return err
+		}
+
+		s.logger.Printf("Enqueueing user creation event for user ID: %d", user.ID)
+		if err := s.outbox.Enqueue(ctx, s.topic, strconv.FormatInt(user.ID, 10), events.UserCreated, events.UserCreatedEvent{
+			User: events.User{
+				ID:        user.ID,
+				Name:      user.Name,
+				Email:     user.Email,
+				CreatedAt: user.CreatedAt,
+				UpdatedAt: user.UpdatedAt,
+			},
+		}); err != nil {
+			s.logger.Printf("Failed to enqueue event: %v", err)
+			return fmt.Errorf("failed to enqueue event: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	message := map[string]interface{}{
-		"event": "user_created",
-		"user": map[string]interface{}{
-			"id":    user.ID,
-			"name":  user.Name,
-			"email": user.Email,
-		},
-	}
-
-	s.logger.Printf("Publishing user creation event for user ID: %d", user.ID)
-	if err := s.publishMessage(message); err != nil {
-		s.logger.Printf("Failed to publish message: %v", err)
-		return nil, fmt.Errorf("failed to publish message: %w", err)
-	}
-
 	s.logger.Printf("User registered successfully: %s", user.Email)
 	return user, nil
 }
@@ -100,24 +106,6 @@ func (s *userService) LoginUser(ctx context.Context, req *models.LoginRequest) (
 	return token, nil
 }
 
-func (s *userService) publishMessage(message interface{}) error {
-	s.logger.Println("Marshalling message for Kafka")
-	valueBytes, err := json.Marshal(message)
-	if err != nil {
-		s.logger.Printf("Failed to marshal message: %v", err)
-		return fmt.Errorf("failed to marshal message: %w", err)
-	}
-
-	s.logger.Println("Publishing message to Kafka")
-	if err := s.kafka.PublishMessage(s.topic, nil, valueBytes); err != nil {
-		s.logger.Printf("Failed to publish message to Kafka: %v", err)
-		return err
-	}
-
-	s.logger.Println("Message published to Kafka successfully")
-	return nil
-}
-
 func verifyPassword(hashedPassword, password string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 }
@@ -46,6 +46,7 @@ func NewFiberApp(h *Handler, jwtSecret string) *fiber.App {
 
 	users.Post("/:id/like", h.LikeProduct)
 	users.Post("/:id/dislike", h.DislikeProduct)
+	users.Post("/:id/view", h.ViewProduct)
 
 	users.Get("/:id/actions", h.GetUserActions)
 	users.Get("/:id/purchases", h.GetUserPurchases)
@@ -299,6 +300,50 @@ func (h *Handler) DislikeProduct(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"message": "Product disliked successfully"})
 }
 
+// ViewProduct godoc
+// @Summary      View a product
+// @Description  Record that the user viewed a product. Views are counted by the analytics service for the conversion funnel.
+// @Tags         users :8080
+// @Accept       json
+// @Produce      json
+// @Param        id          path      int  true  "User ID"
+// @Param        product_id  query     int  true  "Product ID"
+// @Param Authorization header string true "Bearer {token}"
+// @Security     BearerAuth
+// @Success      200         {object}  map[string]interface{}
+// @Failure      400         {object}  map[string]interface{}
+// @Failure      500         {object}  map[string]interface{}
+// @Router       /users/{id}/view [post]
+func (h *Handler) ViewProduct(c *fiber.Ctx) error {
+	h.logger.Println("Handling ViewProduct request")
+	userID, err := c.ParamsInt("id")
+	if err != nil {
+		h.logger.Printf("Invalid user ID: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID"})
+	}
+
+	productIDStr := c.Query("product_id")
+	if productIDStr == "" {
+		h.logger.Println("Product ID is required")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Product ID is required"})
+	}
+
+	productID, err := strconv.ParseInt(productIDStr, 10, 64)
+	if err != nil || productID <= 0 {
+		h.logger.Printf("Invalid product ID: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid product ID"})
+	}
+
+	h.logger.Printf("User ID %d is viewing product ID %d", userID, productID)
+	if err := h.service.ViewProduct(c.Context(), int64(userID), productID); err != nil {
+		h.logger.Printf("Failed to record product view: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	h.logger.Printf("Successfully recorded view of product ID %d by user ID %d", productID, userID)
+	return c.JSON(fiber.Map{"message": "Product view recorded successfully"})
+}
+
 // GetUserActions godoc
 // @Summary      Get user actions
 // @Description  Retrieve all likes and dislikes of a user, with optional filtering by product ID.
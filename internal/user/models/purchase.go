@@ -6,5 +6,6 @@ type Purchase struct {
     ID         int64     `db:"id" json:"id"`
     UserID     int64     `db:"user_id" json:"user_id"`
     ProductID  int64     `db:"product_id" json:"product_id"`
+    Price      float64   `db:"price" json:"price"`
     PurchasedAt time.Time `db:"purchased_at" json:"purchased_at"`
 }
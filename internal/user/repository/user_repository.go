@@ -10,6 +10,8 @@ import (
 )
 
 type UserRepository interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+
 	CreateUser(ctx context.Context, user *models.User) error
 	GetUserByID(ctx context.Context, id int64) (*models.User, error)
 	UpdateUser(ctx context.Context, user *models.User) error
@@ -21,6 +23,7 @@ type UserRepository interface {
 	DislikeExists(ctx context.Context, userID, productID int64) (bool, error)
 	RemoveLikeByUserAndProduct(ctx context.Context, userID, productID int64) error
 	RemoveDislikeByUserAndProduct(ctx context.Context, userID, productID int64) error
+	ProductExists(ctx context.Context, productID int64) (bool, error)
 	GetUserActions(ctx context.Context, userID int64, productID *int64) (map[string][]interface{}, error)
 	GetUserPurchases(ctx context.Context, userID int64, limit, offset int) ([]*models.Purchase, error)
 }
@@ -34,6 +37,10 @@ func NewUserRepository(database *db.DB, logger *log.Logger) UserRepository {
 	return &userRepository{db: database, logger: logger}
 }
 
+func (r *userRepository) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return r.db.WithinTx(ctx, fn)
+}
+
 func (r *userRepository) CreateUser(ctx context.Context, user *models.User) error {
 	r.logger.Println("Creating a new user")
 	query := `
@@ -41,7 +48,7 @@ func (r *userRepository) CreateUser(ctx context.Context, user *models.User) erro
         VALUES ($1, $2, NOW(), NOW())
         RETURNING id, created_at, updated_at
     `
-	err := r.db.Pool.QueryRow(ctx, query, user.Name, user.Email).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+	err := r.db.Conn(ctx).QueryRow(ctx, query, user.Name, user.Email).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		r.logger.Printf("Failed to create user: %v", err)
 		return fmt.Errorf("failed to create user: %w", err)
@@ -58,7 +65,7 @@ func (r *userRepository) GetUserByID(ctx context.Context, id int64) (*models.Use
         FROM users
         WHERE id = $1
     `
-	err := r.db.Pool.QueryRow(ctx, query, id).Scan(
+	err := r.db.Conn(ctx).QueryRow(ctx, query, id).Scan(
 		&user.ID, &user.Name, &user.Email, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err != nil {
@@ -77,7 +84,7 @@ func (r *userRepository) UpdateUser(ctx context.Context, user *models.User) erro
         WHERE id = $3
         RETURNING updated_at
     `
-	err := r.db.Pool.QueryRow(ctx, query, user.Name, user.Email, user.ID).Scan(&user.UpdatedAt)
+	err := r.db.Conn(ctx).QueryRow(ctx, query, user.Name, user.Email, user.ID).Scan(&user.UpdatedAt)
 	if err != nil {
 		r.logger.Printf("Failed to update user with ID %d: %v", user.ID, err)
 		return fmt.Errorf("failed to update user: %w", err)
@@ -95,7 +102,7 @@ func (r *userRepository) GetAllUsers(ctx context.Context, limit, offset int) ([]
         ORDER BY id
         LIMIT $1 OFFSET $2
     `
-	rows, err := r.db.Pool.Query(ctx, query, limit, offset)
+	rows, err := r.db.Conn(ctx).Query(ctx, query, limit, offset)
 	if err != nil {
 		r.logger.Printf("Failed to fetch users: %v", err)
 		return nil, fmt.Errorf("failed to get users: %w", err)
@@ -123,11 +130,13 @@ func (r *userRepository) GetAllUsers(ctx context.Context, limit, offset int) ([]
 func (r *userRepository) CreatePurchase(ctx context.Context, purchase *models.Purchase) error {
 	r.logger.Printf("Creating purchase for user ID: %d and product ID: %d", purchase.UserID, purchase.ProductID)
 	query := `
-        INSERT INTO purchases (user_id, product_id, purchased_at)
-        VALUES ($1, $2, NOW())
-        RETURNING id, purchased_at
+        INSERT INTO purchases (user_id, product_id, price, purchased_at)
+        SELECT $1, id, price, NOW()
+        FROM products
+        WHERE id = $2
+        RETURNING id, price::float8, purchased_at
     `
-	err := r.db.Pool.QueryRow(ctx, query, purchase.UserID, purchase.ProductID).Scan(&purchase.ID, &purchase.PurchasedAt)
+	err := r.db.Conn(ctx).QueryRow(ctx, query, purchase.UserID, purchase.ProductID).Scan(&purchase.ID, &purchase.Price, &purchase.PurchasedAt)
 	if err != nil {
 		r.logger.Printf("Failed to create purchase: %v", err)
 		return fmt.Errorf("failed to create purchase: %w", err)
@@ -145,7 +154,7 @@ func (r *userRepository) LikeExists(ctx context.Context, userID, productID int64
         LIMIT 1
     `
 	var dummy int
-	err := r.db.Pool.QueryRow(ctx, query, userID, productID).Scan(&dummy)
+	err := r.db.Conn(ctx).QueryRow(ctx, query, userID, productID).Scan(&dummy)
 	if err != nil {
 		r.logger.Printf("Like does not exist for user ID: %d and product ID: %d", userID, productID)
 		return false, nil
@@ -161,7 +170,7 @@ func (r *userRepository) CreateLike(ctx context.Context, like *models.Like) erro
         VALUES ($1, $2, NOW())
         RETURNING id, liked_at
     `
-	err := r.db.Pool.QueryRow(ctx, query, like.UserID, like.ProductID).Scan(&like.ID, &like.LikedAt)
+	err := r.db.Conn(ctx).QueryRow(ctx, query, like.UserID, like.ProductID).Scan(&like.ID, &like.LikedAt)
 	if err != nil {
 		r.logger.Printf("Failed to create like: %v", err)
 		return fmt.Errorf("failed to create like: %w", err)
@@ -179,7 +188,7 @@ func (r *userRepository) DislikeExists(ctx context.Context, userID, productID in
         LIMIT 1
     `
 	var dummy int
-	err := r.db.Pool.QueryRow(ctx, query, userID, productID).Scan(&dummy)
+	err := r.db.Conn(ctx).QueryRow(ctx, query, userID, productID).Scan(&dummy)
 	if err != nil {
 		r.logger.Printf("Dislike does not exist for user ID: %d and product ID: %d", userID, productID)
 		return false, nil
@@ -195,7 +204,7 @@ func (r *userRepository) CreateDislike(ctx context.Context, dislike *models.Disl
         VALUES ($1, $2, NOW())
         RETURNING id, disliked_at
     `
-	err := r.db.Pool.QueryRow(ctx, query, dislike.UserID, dislike.ProductID).Scan(&dislike.ID, &dislike.DislikedAt)
+	err := r.db.Conn(ctx).QueryRow(ctx, query, dislike.UserID, dislike.ProductID).Scan(&dislike.ID, &dislike.DislikedAt)
 	if err != nil {
 		r.logger.Printf("Failed to create dislike: %v", err)
 		return fmt.Errorf("failed to create dislike: %w", err)
@@ -207,7 +216,7 @@ func (r *userRepository) CreateDislike(ctx context.Context, dislike *models.Disl
 func (r *userRepository) RemoveLikeByUserAndProduct(ctx context.Context, userID, productID int64) error {
 	r.logger.Printf("Removing like for user ID: %d and product ID: %d", userID, productID)
 	query := `DELETE FROM likes WHERE user_id = $1 AND product_id = $2`
-	_, err := r.db.Pool.Exec(ctx, query, userID, productID)
+	_, err := r.db.Conn(ctx).Exec(ctx, query, userID, productID)
 	if err != nil {
 		r.logger.Printf("Failed to remove like: %v", err)
 		return fmt.Errorf("failed to remove like: %w", err)
@@ -219,7 +228,7 @@ func (r *userRepository) RemoveLikeByUserAndProduct(ctx context.Context, userID,
 func (r *userRepository) RemoveDislikeByUserAndProduct(ctx context.Context, userID, productID int64) error {
 	r.logger.Printf("Removing dislike for user ID: %d and product ID: %d", userID, productID)
 	query := `DELETE FROM dislikes WHERE user_id = $1 AND product_id = $2`
-	_, err := r.db.Pool.Exec(ctx, query, userID, productID)
+	_, err := r.db.Conn(ctx).Exec(ctx, query, userID, productID)
 	if err != nil {
 		r.logger.Printf("Failed to remove dislike: %v", err)
 		return fmt.Errorf("failed to remove dislike: %w", err)
@@ -228,6 +237,18 @@ func (r *userRepository) RemoveDislikeByUserAndProduct(ctx context.Context, user
 	return nil
 }
 
+func (r *userRepository) ProductExists(ctx context.Context, productID int64) (bool, error) {
+	r.logger.Printf("Checking if product ID: %d exists", productID)
+	query := `SELECT EXISTS (SELECT 1 FROM products WHERE id = $1)`
+	var exists bool
+	if err := r.db.Conn(ctx).QueryRow(ctx, query, productID).Scan(&exists); err != nil {
+		r.logger.Printf("Failed to check if product exists: %v", err)
+		return false, fmt.Errorf("failed to check if product exists: %w", err)
+	}
+	r.logger.Printf("Product ID: %d exists: %t", productID, exists)
+	return exists, nil
+}
+
 func (r *userRepository) GetUserActions(ctx context.Context, userID int64, productID *int64) (map[string][]interface{}, error) {
 	r.logger.Printf("Fetching actions for user ID: %d", userID)
 	actions := make(map[string][]interface{})
@@ -250,7 +271,7 @@ func (r *userRepository) GetUserActions(ctx context.Context, userID int64, produ
 		likesArgs = []interface{}{userID}
 	}
 
-	rows, err := r.db.Pool.Query(ctx, likesQuery, likesArgs...)
+	rows, err := r.db.Conn(ctx).Query(ctx, likesQuery, likesArgs...)
 	if err != nil {
 		r.logger.Printf("Failed to get likes: %v", err)
 		return nil, fmt.Errorf("failed to get likes: %w", err)
@@ -294,7 +315,7 @@ func (r *userRepository) GetUserActions(ctx context.Context, userID int64, produ
 		dislikesArgs = []interface{}{userID}
 	}
 
-	rows, err = r.db.Pool.Query(ctx, dislikesQuery, dislikesArgs...)
+	rows, err = r.db.Conn(ctx).Query(ctx, dislikesQuery, dislikesArgs...)
 	if err != nil {
 		r.logger.Printf("Failed to get dislikes: %v", err)
 		return nil, fmt.Errorf("failed to get dislikes: %w", err)
@@ -342,13 +363,13 @@ func (r *userRepository) GetUserPurchases(ctx context.Context, userID int64, lim
 	r.logger.Printf("Fetching purchases for user ID: %d with limit %d and offset %d", userID, limit, offset)
 	var purchases []*models.Purchase
 	query := `
-        SELECT id, user_id, product_id, purchased_at
+        SELECT id, user_id, product_id, price::float8, purchased_at
         FROM purchases
         WHERE user_id = $1
         ORDER BY purchased_at DESC
         LIMIT $2 OFFSET $3
     `
-	rows, err := r.db.Pool.Query(ctx, query, userID, limit, offset)
+	rows, err := r.db.Conn(ctx).Query(ctx, query, userID, limit, offset)
 	if err != nil {
 		r.logger.Printf("Failed to get purchases: %v", err)
 		return nil, fmt.Errorf("failed to get purchases: %w", err)
@@ -357,7 +378,7 @@ func (r *userRepository) GetUserPurchases(ctx context.Context, userID int64, lim
 
 	for rows.Next() {
 		var purchase models.Purchase
-		if err := rows.Scan(&purchase.ID, &purchase.UserID, &purchase.ProductID, &purchase.PurchasedAt); err != nil {
+		if err := rows.Scan(&purchase.ID, &purchase.UserID, &purchase.ProductID, &purchase.Price, &purchase.PurchasedAt); err != nil {
 			r.logger.Printf("Failed to scan purchase: %v", err)
 			return nil, fmt.Errorf("failed to scan purchase: %w", err)
 		}
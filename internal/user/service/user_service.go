@@ -4,13 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"time"
 
 	log "recommendation-system/pkg/logger"
 
 	"recommendation-system/internal/user/models"
 	"recommendation-system/internal/user/repository"
-	"recommendation-system/pkg/kafka"
+	"recommendation-system/pkg/events"
+	"recommendation-system/pkg/outbox"
 	"recommendation-system/pkg/redis"
 )
 
@@ -21,22 +23,23 @@ type UserService interface {
 	PurchaseProduct(ctx context.Context, userID, productID int64) error
 	LikeProduct(ctx context.Context, userID, productID int64) error
 	DislikeProduct(ctx context.Context, userID, productID int64) error
+	ViewProduct(ctx context.Context, userID, productID int64) error
 	GetUserActions(ctx context.Context, userID int64, productID *int64) (map[string][]interface{}, error)
 	GetUserPurchases(ctx context.Context, userID int64, limit, offset int) ([]*models.Purchase, error)
 }
 
 type userService struct {
 	repo        repository.UserRepository
-	kafka       *kafka.KafkaClient
+	outbox      *outbox.Store
 	topic       string
 	redisClient *redis.RedisClient
 	logger      *log.Logger
 }
 
-func NewUserService(repo repository.UserRepository, kafkaClient *kafka.KafkaClient, redisClient *redis.RedisClient, logger *log.Logger) UserService {
+func NewUserService(repo repository.UserRepository, outboxStore *outbox.Store, redisClient *redis.RedisClient, logger *log.Logger) UserService {
 	return &userService{
 		repo:        repo,
-		kafka:       kafkaClient,
+		outbox:      outboxStore,
 		topic:       "user_updates",
 		redisClient: redisClient,
 		logger:      logger,
@@ -72,21 +75,31 @@ func (s *userService) GetUser(ctx context.Context, id int64) (*models.User, erro
 
 func (s *userService) UpdateUser(ctx context.Context, user *models.User) error {
 	s.logger.Printf("Updating user with ID: %d", user.ID)
-	if err := s.repo.UpdateUser(ctx, user); err != nil {
-		s.logger.Printf("Failed to update user: %v", err)
+	err := s.repo.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.repo.UpdateUser(ctx, user); err != nil {
+			s.logger.Printf("Failed to update user: %v", err)
+			return err
+		}
+
+		s.logger.Println("Enqueueing user update event")
+		return s.enqueueEvent(ctx, user.ID, events.UserUpdated, events.UserUpdatedEvent{
+			User: events.User{
+				ID:        user.ID,
+				Name:      user.Name,
+				Email:     user.Email,
+				CreatedAt: user.CreatedAt,
+				UpdatedAt: user.UpdatedAt,
+			},
+		})
+	})
+	if err != nil {
 		return err
 	}
 
 	cacheKey := fmt.Sprintf("user:%d", user.ID)
 	s.redisClient.Delete(ctx, cacheKey)
 	s.logger.Printf("Cache invalidated for user ID: %d", user.ID)
-
-	message := map[string]interface{}{
-		"event": "user_updated",
-		"user":  user,
-	}
-	s.logger.Println("Publishing user update event")
-	return s.publishMessage(message)
+	return nil
 }
 
 func (s *userService) GetAllUsers(ctx context.Context, limit, offset int) ([]*models.User, error) {
@@ -105,91 +118,112 @@ func (s *userService) PurchaseProduct(ctx context.Context, userID, productID int
 		ProductID: productID,
 	}
 
-	if err := s.repo.CreatePurchase(ctx, purchase); err != nil {
-		s.logger.Printf("Failed to record purchase: %v", err)
-		return err
-	}
+	return s.repo.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.repo.CreatePurchase(ctx, purchase); err != nil {
+			s.logger.Printf("Failed to record purchase: %v", err)
+			return err
+		}
 
-	message := map[string]interface{}{
-		"event":      "user_purchased",
-		"user_id":    userID,
-		"product_id": productID,
-		"purchase":   purchase,
-	}
-	s.logger.Println("Publishing purchase event")
-	return s.publishMessage(message)
+		s.logger.Println("Enqueueing purchase event")
+		return s.enqueueEvent(ctx, userID, events.UserPurchased, events.UserPurchasedEvent{
+			Interaction: events.Interaction{UserID: userID, ProductID: productID},
+			PurchaseID:  purchase.ID,
+			Price:       purchase.Price,
+			PurchasedAt: purchase.PurchasedAt,
+		})
+	})
 }
 
 func (s *userService) LikeProduct(ctx context.Context, userID, productID int64) error {
 	s.logger.Printf("User %d liking product %d", userID, productID)
-	if err := s.repo.RemoveDislikeByUserAndProduct(ctx, userID, productID); err != nil {
-		s.logger.Printf("Failed to remove existing dislike: %v", err)
-		return fmt.Errorf("failed to remove existing dislike: %w", err)
-	}
+	return s.repo.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.repo.RemoveDislikeByUserAndProduct(ctx, userID, productID); err != nil {
+			s.logger.Printf("Failed to remove existing dislike: %v", err)
+			return fmt.Errorf("failed to remove existing dislike: %w", err)
+		}
 
-	exists, err := s.repo.LikeExists(ctx, userID, productID)
-	if err != nil {
-		s.logger.Printf("Failed to check if like exists: %v", err)
-		return err
-	}
-	if exists {
-		s.logger.Printf("Like already exists for user %d and product %d", userID, productID)
-		return fmt.Errorf("like already exists for user %d and product %d", userID, productID)
-	}
+		exists, err := s.repo.LikeExists(ctx, userID, productID)
+		if err != nil {
+			s.logger.Printf("Failed to check if like exists: %v", err)
+			return err
+		}
+		if exists {
+			s.logger.Printf("Like already exists for user %d and product %d", userID, productID)
+			return fmt.Errorf("like already exists for user %d and product %d", userID, productID)
+		}
 
-	like := &models.Like{
-		UserID:    userID,
-		ProductID: productID,
-	}
-	if err := s.repo.CreateLike(ctx, like); err != nil {
-		s.logger.Printf("Failed to create like: %v", err)
-		return err
-	}
+		like := &models.Like{
+			UserID:    userID,
+			ProductID: productID,
+		}
+		if err := s.repo.CreateLike(ctx, like); err != nil {
+			s.logger.Printf("Failed to create like: %v", err)
+			return err
+		}
 
-	message := map[string]interface{}{
-		"event":      "user_liked",
-		"user_id":    userID,
-		"product_id": productID,
-		"like":       like,
-	}
-	s.logger.Println("Publishing like event")
-	return s.publishMessage(message)
+		s.logger.Println("Enqueueing like event")
+		return s.enqueueEvent(ctx, userID, events.UserLiked, events.UserLikedEvent{
+			Interaction: events.Interaction{UserID: userID, ProductID: productID},
+			LikedAt:     like.LikedAt,
+		})
+	})
 }
 
 func (s *userService) DislikeProduct(ctx context.Context, userID, productID int64) error {
 	s.logger.Printf("User %d disliking product %d", userID, productID)
-	if err := s.repo.RemoveLikeByUserAndProduct(ctx, userID, productID); err != nil {
-		s.logger.Printf("Failed to remove existing like: %v", err)
-		return fmt.Errorf("failed to remove existing like: %w", err)
-	}
+	return s.repo.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.repo.RemoveLikeByUserAndProduct(ctx, userID, productID); err != nil {
+			s.logger.Printf("Failed to remove existing like: %v", err)
+			return fmt.Errorf("failed to remove existing like: %w", err)
+		}
 
-	exists, err := s.repo.DislikeExists(ctx, userID, productID)
-	if err != nil {
-		s.logger.Printf("Failed to check if dislike exists: %v", err)
-		return err
-	}
-	if exists {
-		s.logger.Printf("Dislike already exists for user %d and product %d", userID, productID)
-		return fmt.Errorf("dislike already exists for user %d and product %d", userID, productID)
-	}
+		exists, err := s.repo.DislikeExists(ctx, userID, productID)
+		if err != nil {
+			s.logger.Printf("Failed to check if dislike exists: %v", err)
+			return err
+		}
+		if exists {
+			s.logger.Printf("Dislike already exists for user %d and product %d", userID, productID)
+			return fmt.Errorf("dislike already exists for user %d and product %d", userID, productID)
+		}
 
-	dislike := &models.Dislike{
-		UserID:    userID,
-		ProductID: productID,
-	}
-	if err := s.repo.CreateDislike(ctx, dislike); err != nil {
-		s.logger.Printf("Failed to create dislike: %v", err)
-		return err
-	}
+		dislike := &models.Dislike{
+			UserID:    userID,
+			ProductID: productID,
+		}
+		if err := s.repo.CreateDislike(ctx, dislike); err != nil {
+			s.logger.Printf("Failed to create dislike: %v", err)
+			return err
+		}
 
-	message := map[string]interface{}{
-		"event":      "user_disliked",
-		"user_id":    userID,
-		"product_id": productID,
-		"dislike":    dislike,
-	}
-	s.logger.Println("Publishing dislike event")
-	return s.publishMessage(message)
+		s.logger.Println("Enqueueing dislike event")
+		return s.enqueueEvent(ctx, userID, events.UserDisliked, events.UserDislikedEvent{
+			Interaction: events.Interaction{UserID: userID, ProductID: productID},
+			DislikedAt:  dislike.DislikedAt,
+		})
+	})
+}
+
+// ViewProduct records nothing in the user tables: a view only exists as the
+// user_viewed event consumed by the analytics service.
+func (s *userService) ViewProduct(ctx context.Context, userID, productID int64) error {
+	s.logger.Printf("User %d viewing product %d", userID, productID)
+	return s.repo.WithinTx(ctx, func(ctx context.Context) error {
+		exists, err := s.repo.ProductExists(ctx, productID)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			s.logger.Printf("Product %d not found", productID)
+			return fmt.Errorf("product %d not found", productID)
+		}
+
+		s.logger.Println("Enqueueing view event")
+		return s.enqueueEvent(ctx, userID, events.UserViewed, events.UserViewedEvent{
+			Interaction: events.Interaction{UserID: userID, ProductID: productID},
+			ViewedAt:    time.Now().UTC(),
+		})
+	})
 }
 
 func (s *userService) GetUserActions(ctx context.Context, userID int64, productID *int64) (map[string][]interface{}, error) {
@@ -210,13 +244,13 @@ func (s *userService) GetUserPurchases(ctx context.Context, userID int64, limit,
 	return purchases, err
 }
 
-func (s *userService) publishMessage(message interface{}) error {
-	valueBytes, err := json.Marshal(message)
-	if err != nil {
-		s.logger.Printf("Failed to marshal message: %v", err)
-		return fmt.Errorf("failed to marshal message: %w", err)
+// enqueueEvent stores the event in the outbox as part of the current
+// transaction; events of a user are keyed by the user ID.
+func (s *userService) enqueueEvent(ctx context.Context, userID int64, eventType string, payload interface{}) error {
+	s.logger.Printf("Enqueueing %s event for topic %s", eventType, s.topic)
+	if err := s.outbox.Enqueue(ctx, s.topic, strconv.FormatInt(userID, 10), eventType, payload); err != nil {
+		s.logger.Printf("Failed to enqueue event: %v", err)
+		return err
 	}
-
-	s.logger.Printf("Publishing message to topic %s", s.topic)
-	return s.kafka.PublishMessage(s.topic, nil, valueBytes)
+	return nil
 }
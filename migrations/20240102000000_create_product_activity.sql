@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS product_activity (
+    product_id INT NOT NULL,
+    bucket_start TIMESTAMP NOT NULL,
+    likes INT NOT NULL DEFAULT 0,
+    purchases INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (product_id, bucket_start)
+);
+
+CREATE INDEX IF NOT EXISTS idx_product_activity_bucket_start ON product_activity (bucket_start);
+
+-- +goose Down
+DROP TABLE product_activity;
@@ -0,0 +1,50 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS product_analytics_hourly (
+    product_id INT NOT NULL,
+    bucket_start TIMESTAMP NOT NULL,
+    likes INT NOT NULL DEFAULT 0,
+    dislikes INT NOT NULL DEFAULT 0,
+    purchases INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (product_id, bucket_start)
+);
+
+CREATE INDEX IF NOT EXISTS idx_product_analytics_hourly_bucket_start ON product_analytics_hourly (bucket_start);
+
+CREATE TABLE IF NOT EXISTS product_analytics_daily (
+    product_id INT NOT NULL,
+    bucket_start TIMESTAMP NOT NULL,
+    likes INT NOT NULL DEFAULT 0,
+    dislikes INT NOT NULL DEFAULT 0,
+    purchases INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (product_id, bucket_start)
+);
+
+CREATE INDEX IF NOT EXISTS idx_product_analytics_daily_bucket_start ON product_analytics_daily (bucket_start);
+
+CREATE TABLE IF NOT EXISTS user_analytics_hourly (
+    user_id INT NOT NULL,
+    bucket_start TIMESTAMP NOT NULL,
+    likes INT NOT NULL DEFAULT 0,
+    dislikes INT NOT NULL DEFAULT 0,
+    purchases INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, bucket_start)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_analytics_hourly_bucket_start ON user_analytics_hourly (bucket_start);
+
+CREATE TABLE IF NOT EXISTS user_analytics_daily (
+    user_id INT NOT NULL,
+    bucket_start TIMESTAMP NOT NULL,
+    likes INT NOT NULL DEFAULT 0,
+    dislikes INT NOT NULL DEFAULT 0,
+    purchases INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, bucket_start)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_analytics_daily_bucket_start ON user_analytics_daily (bucket_start);
+
+-- +goose Down
+DROP TABLE user_analytics_daily;
+DROP TABLE user_analytics_hourly;
+DROP TABLE product_analytics_daily;
+DROP TABLE product_analytics_hourly;
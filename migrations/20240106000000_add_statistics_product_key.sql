@@ -0,0 +1,20 @@
+-- +goose Up
+-- statistics is written by the analytics consumer, which must not fail on
+-- events of products that were deleted in the meantime, so the table is keyed
+-- by product like product_analytics instead of referencing products.
+ALTER TABLE statistics DROP CONSTRAINT IF EXISTS statistics_product_id_fkey;
+
+DELETE FROM statistics a
+USING statistics b
+WHERE a.product_id = b.product_id AND a.id > b.id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_statistics_product_id ON statistics (product_id);
+
+INSERT INTO statistics (product_id, purchases)
+SELECT product_id, purchases FROM product_analytics
+ON CONFLICT (product_id) DO UPDATE SET purchases = EXCLUDED.purchases, updated_at = NOW();
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_statistics_product_id;
+ALTER TABLE statistics ADD CONSTRAINT statistics_product_id_fkey
+    FOREIGN KEY (product_id) REFERENCES products(id) NOT VALID;
@@ -0,0 +1,69 @@
+-- +goose Up
+-- A purchase keeps the price the product had when it was bought, so later
+-- price changes do not alter revenue. Existing purchases only know the current
+-- price.
+ALTER TABLE purchases ADD COLUMN IF NOT EXISTS price NUMERIC(10, 2);
+UPDATE purchases pu SET price = p.price FROM products p WHERE p.id = pu.product_id AND pu.price IS NULL;
+UPDATE purchases SET price = 0 WHERE price IS NULL;
+ALTER TABLE purchases ALTER COLUMN price SET DEFAULT 0;
+ALTER TABLE purchases ALTER COLUMN price SET NOT NULL;
+
+ALTER TABLE product_analytics ADD COLUMN IF NOT EXISTS revenue NUMERIC(14, 2) NOT NULL DEFAULT 0;
+ALTER TABLE user_analytics ADD COLUMN IF NOT EXISTS total_revenue NUMERIC(14, 2) NOT NULL DEFAULT 0;
+ALTER TABLE product_analytics_hourly ADD COLUMN IF NOT EXISTS revenue NUMERIC(14, 2) NOT NULL DEFAULT 0;
+ALTER TABLE product_analytics_daily ADD COLUMN IF NOT EXISTS revenue NUMERIC(14, 2) NOT NULL DEFAULT 0;
+ALTER TABLE user_analytics_hourly ADD COLUMN IF NOT EXISTS revenue NUMERIC(14, 2) NOT NULL DEFAULT 0;
+ALTER TABLE user_analytics_daily ADD COLUMN IF NOT EXISTS revenue NUMERIC(14, 2) NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS category_revenue_daily (
+    category VARCHAR(255) NOT NULL,
+    bucket_start TIMESTAMP NOT NULL,
+    purchases INT NOT NULL DEFAULT 0,
+    revenue NUMERIC(14, 2) NOT NULL DEFAULT 0,
+    PRIMARY KEY (category, bucket_start)
+);
+
+CREATE INDEX IF NOT EXISTS idx_category_revenue_daily_bucket_start ON category_revenue_daily (bucket_start);
+
+UPDATE product_analytics pa SET revenue = r.revenue
+FROM (SELECT product_id, SUM(price) AS revenue FROM purchases GROUP BY product_id) r
+WHERE r.product_id = pa.product_id;
+
+UPDATE user_analytics ua SET total_revenue = r.revenue
+FROM (SELECT user_id, SUM(price) AS revenue FROM purchases GROUP BY user_id) r
+WHERE r.user_id = ua.user_id;
+
+-- Revenue of purchases of deleted products is kept under the empty category.
+INSERT INTO category_revenue_daily (category, bucket_start, purchases, revenue)
+SELECT COALESCE(p.category, ''), date_trunc('day', pu.purchased_at), COUNT(*), SUM(pu.price)
+FROM purchases pu
+LEFT JOIN products p ON p.id = pu.product_id
+GROUP BY 1, 2
+ON CONFLICT (category, bucket_start) DO NOTHING;
+
+-- The series only keep the buckets that are still within their retention.
+UPDATE product_analytics_hourly h SET revenue = r.revenue
+FROM (SELECT product_id, date_trunc('hour', purchased_at) AS bucket_start, SUM(price) AS revenue FROM purchases GROUP BY 1, 2) r
+WHERE r.product_id = h.product_id AND r.bucket_start = h.bucket_start;
+
+UPDATE product_analytics_daily d SET revenue = r.revenue
+FROM (SELECT product_id, date_trunc('day', purchased_at) AS bucket_start, SUM(price) AS revenue FROM purchases GROUP BY 1, 2) r
+WHERE r.product_id = d.product_id AND r.bucket_start = d.bucket_start;
+
+UPDATE user_analytics_hourly h SET revenue = r.revenue
+FROM (SELECT user_id, date_trunc('hour', purchased_at) AS bucket_start, SUM(price) AS revenue FROM purchases GROUP BY 1, 2) r
+WHERE r.user_id = h.user_id AND r.bucket_start = h.bucket_start;
+
+UPDATE user_analytics_daily d SET revenue = r.revenue
+FROM (SELECT user_id, date_trunc('day', purchased_at) AS bucket_start, SUM(price) AS revenue FROM purchases GROUP BY 1, 2) r
+WHERE r.user_id = d.user_id AND r.bucket_start = d.bucket_start;
+
+-- +goose Down
+DROP TABLE IF EXISTS category_revenue_daily;
+ALTER TABLE user_analytics_daily DROP COLUMN IF EXISTS revenue;
+ALTER TABLE user_analytics_hourly DROP COLUMN IF EXISTS revenue;
+ALTER TABLE product_analytics_daily DROP COLUMN IF EXISTS revenue;
+ALTER TABLE product_analytics_hourly DROP COLUMN IF EXISTS revenue;
+ALTER TABLE user_analytics DROP COLUMN IF EXISTS total_revenue;
+ALTER TABLE product_analytics DROP COLUMN IF EXISTS revenue;
+ALTER TABLE purchases DROP COLUMN IF EXISTS price;
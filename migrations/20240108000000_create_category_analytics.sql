@@ -0,0 +1,55 @@
+-- +goose Up
+-- product_categories is the analytics service's copy of the category of each
+-- product, maintained from product events. Interactions are counted in the
+-- category the product has when they are processed.
+CREATE TABLE IF NOT EXISTS product_categories (
+    product_id INT PRIMARY KEY,
+    category VARCHAR(255) NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS category_analytics (
+    category VARCHAR(255) PRIMARY KEY,
+    likes INT NOT NULL DEFAULT 0,
+    dislikes INT NOT NULL DEFAULT 0,
+    purchases INT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS category_users (
+    category VARCHAR(255) NOT NULL,
+    user_id INT NOT NULL,
+    last_active_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (category, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_category_users_last_active_at ON category_users (category, last_active_at);
+
+INSERT INTO product_categories (product_id, category, updated_at)
+SELECT id, category, updated_at FROM products
+ON CONFLICT (product_id) DO NOTHING;
+
+INSERT INTO category_analytics (category, likes, dislikes, purchases)
+SELECT p.category, SUM(pa.likes), SUM(pa.dislikes), SUM(pa.purchases)
+FROM product_analytics pa
+JOIN products p ON p.id = pa.product_id
+GROUP BY p.category
+ON CONFLICT (category) DO NOTHING;
+
+INSERT INTO category_users (category, user_id, last_active_at)
+SELECT p.category, i.user_id, MAX(i.occurred_at)
+FROM (
+    SELECT user_id, product_id, liked_at AS occurred_at FROM likes
+    UNION ALL
+    SELECT user_id, product_id, disliked_at FROM dislikes
+    UNION ALL
+    SELECT user_id, product_id, purchased_at FROM purchases
+) i
+JOIN products p ON p.id = i.product_id
+GROUP BY p.category, i.user_id
+ON CONFLICT (category, user_id) DO NOTHING;
+
+-- +goose Down
+DROP TABLE IF EXISTS category_users;
+DROP TABLE IF EXISTS category_analytics;
+DROP TABLE IF EXISTS product_categories;
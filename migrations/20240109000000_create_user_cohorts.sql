@@ -0,0 +1,36 @@
+-- +goose Up
+-- user_cohorts assigns each user to the week (starting on Monday, UTC) they
+-- registered in, from user_created events. user_activity_weeks holds the weeks
+-- in which a user had any interaction, views included.
+CREATE TABLE IF NOT EXISTS user_cohorts (
+    user_id INT PRIMARY KEY,
+    cohort_week DATE NOT NULL,
+    registered_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_cohorts_cohort_week ON user_cohorts (cohort_week);
+
+CREATE TABLE IF NOT EXISTS user_activity_weeks (
+    user_id INT NOT NULL,
+    week DATE NOT NULL,
+    PRIMARY KEY (user_id, week)
+);
+
+INSERT INTO user_cohorts (user_id, cohort_week, registered_at)
+SELECT id, date_trunc('week', created_at)::date, created_at FROM users
+ON CONFLICT (user_id) DO NOTHING;
+
+INSERT INTO user_activity_weeks (user_id, week)
+SELECT DISTINCT user_id, date_trunc('week', occurred_at)::date
+FROM (
+    SELECT user_id, liked_at AS occurred_at FROM likes
+    UNION ALL
+    SELECT user_id, disliked_at FROM dislikes
+    UNION ALL
+    SELECT user_id, purchased_at FROM purchases
+) i
+ON CONFLICT (user_id, week) DO NOTHING;
+
+-- +goose Down
+DROP TABLE IF EXISTS user_activity_weeks;
+DROP TABLE IF EXISTS user_cohorts;
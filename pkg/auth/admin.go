@@ -0,0 +1,22 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var ErrForbidden = errors.New("admin token required")
+
+// AdminTokenMiddleware lets a request through only when its X-Admin-Token
+// header matches token. An empty token closes the route to everyone.
+func AdminTokenMiddleware(token string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		provided := c.Get("X-Admin-Token")
+		if token == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": ErrForbidden.Error()})
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,149 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// CloudEvents 1.0 attributes and content types of its Kafka protocol binding.
+const (
+	SpecVersion            = "1.0"
+	ContentTypeCloudEvents = "application/cloudevents+json"
+	ContentTypeJSON        = "application/json"
+
+	HeaderContentType = "content-type"
+	headerPrefix      = "ce_"
+)
+
+// Mode selects how an event is laid out in a Kafka message. Structured mode
+// carries the whole CloudEvent as JSON in the value; binary mode carries the
+// attributes in ce_ headers and only the payload in the value.
+type Mode string
+
+const (
+	ModeStructured Mode = "structured"
+	ModeBinary     Mode = "binary"
+)
+
+func ParseMode(s string) (Mode, error) {
+	switch Mode(s) {
+	case ModeStructured, ModeBinary:
+		return Mode(s), nil
+	case "":
+		return ModeStructured, nil
+	}
+	return "", fmt.Errorf("unknown CloudEvents mode %q", s)
+}
+
+// cloudEvent is the JSON format of a CloudEvent. The producer is the source and
+// the payload version, which has no CloudEvents counterpart, travels in the
+// dataversion extension; events without it are taken to be of CurrentVersion.
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	DataVersion     int             `json:"dataversion"`
+	Data            json.RawMessage `json:"data"`
+}
+
+func toCloudEvent(env *Envelope) cloudEvent {
+	return cloudEvent{
+		SpecVersion:     SpecVersion,
+		ID:              env.ID,
+		Source:          env.Producer,
+		Type:            env.Type,
+		Time:            env.Timestamp,
+		DataContentType: ContentTypeJSON,
+		DataVersion:     env.Version,
+		Data:            env.Data,
+	}
+}
+
+// NewMessage lays env out as a Kafka message for topic in the given mode.
+func NewMessage(topic string, key []byte, env *Envelope, mode Mode) (kafka.Message, error) {
+	m := kafka.Message{Topic: topic, Key: key}
+
+	switch mode {
+	case ModeBinary:
+		if env.Type == "" {
+			return kafka.Message{}, ErrMissingType
+		}
+		if len(env.Data) == 0 {
+			return kafka.Message{}, ErrMissingData
+		}
+		m.Value = env.Data
+		m.Headers = []kafka.Header{
+			{Key: HeaderContentType, Value: []byte(ContentTypeJSON)},
+			{Key: headerPrefix + "specversion", Value: []byte(SpecVersion)},
+			{Key: headerPrefix + "id", Value: []byte(env.ID)},
+			{Key: headerPrefix + "source", Value: []byte(env.Producer)},
+			{Key: headerPrefix + "type", Value: []byte(env.Type)},
+			{Key: headerPrefix + "time", Value: []byte(env.Timestamp.Format(time.RFC3339Nano))},
+			{Key: headerPrefix + "dataversion", Value: []byte(strconv.Itoa(env.Version))},
+		}
+
+	default:
+		value, err := Encode(env)
+		if err != nil {
+			return kafka.Message{}, err
+		}
+		m.Value = value
+		m.Headers = []kafka.Header{
+			{Key: HeaderContentType, Value: []byte(ContentTypeCloudEvents)},
+		}
+	}
+	return m, nil
+}
+
+// DecodeMessage decodes a consumed message in any format published so far:
+// binary mode CloudEvents are recognized by their ce_specversion header, all
+// other messages are passed to Decode.
+func DecodeMessage(m kafka.Message) (*Envelope, error) {
+	headers := make(map[string]string)
+	for _, h := range m.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+	if headers[headerPrefix+"specversion"] == "" {
+		return Decode(m.Value)
+	}
+
+	env := Envelope{
+		ID:       headers[headerPrefix+"id"],
+		Type:     headers[headerPrefix+"type"],
+		Producer: headers[headerPrefix+"source"],
+		Version:  CurrentVersion,
+		Data:     json.RawMessage(m.Value),
+	}
+	if env.Type == "" {
+		return nil, ErrMissingType
+	}
+	if len(env.Data) == 0 {
+		return nil, ErrMissingData
+	}
+	if t := headers[headerPrefix+"time"]; t != "" {
+		ts, err := time.Parse(time.RFC3339Nano, t)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse event time: %w", err)
+		}
+		env.Timestamp = ts
+	}
+	if v := headers[headerPrefix+"dataversion"]; v != "" {
+		version, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse event data version: %w", err)
+		}
+		env.Version = version
+	}
+
+	if err := upgrade(&env); err != nil {
+		return nil, err
+	}
+	return &env, nil
+}
@@ -0,0 +1,118 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func headerValue(m kafka.Message, key string) string {
+	for _, h := range m.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	env := &Envelope{
+		ID:        "e1",
+		Type:      UserLiked,
+		Version:   CurrentVersion,
+		Timestamp: time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC),
+		Producer:  "user-service",
+		Data:      json.RawMessage(`{"user_id":1,"product_id":2,"liked_at":"2024-01-02T03:04:05Z"}`),
+	}
+
+	tests := []struct {
+		mode    Mode
+		headers map[string]string
+	}{
+		{
+			mode:    ModeStructured,
+			headers: map[string]string{HeaderContentType: ContentTypeCloudEvents, "ce_specversion": ""},
+		},
+		{
+			mode: ModeBinary,
+			headers: map[string]string{
+				HeaderContentType: ContentTypeJSON,
+				"ce_specversion":  SpecVersion,
+				"ce_id":           "e1",
+				"ce_source":       "user-service",
+				"ce_type":         UserLiked,
+				"ce_time":         "2024-01-02T03:04:05.000000006Z",
+				"ce_dataversion":  "1",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			m, err := NewMessage("user_updates", []byte("1"), env, tt.mode)
+			if err != nil {
+				t.Fatalf("NewMessage() error = %v", err)
+			}
+			if m.Topic != "user_updates" || string(m.Key) != "1" {
+				t.Errorf("message for %s with key %q, want user_updates with key 1", m.Topic, m.Key)
+			}
+			for key, want := range tt.headers {
+				if got := headerValue(m, key); got != want {
+					t.Errorf("header %s = %q, want %q", key, got, want)
+				}
+			}
+			if tt.mode == ModeBinary {
+				assertJSON(t, m.Value, string(env.Data))
+			}
+
+			got, err := DecodeMessage(m)
+			if err != nil {
+				t.Fatalf("DecodeMessage() error = %v", err)
+			}
+			if got.ID != env.ID || got.Type != env.Type || got.Producer != env.Producer || got.Version != env.Version || !got.Timestamp.Equal(env.Timestamp) {
+				t.Errorf("DecodeMessage() = %+v, want %+v", got, env)
+			}
+			assertJSON(t, got.Data, string(env.Data))
+		})
+	}
+}
+
+func TestDecodeMessageBinary(t *testing.T) {
+	m := kafka.Message{
+		Value: []byte(`{"user_id":1,"product_id":2,"like":{"liked_at":"2024-01-02T03:04:05Z"}}`),
+		Headers: []kafka.Header{
+			{Key: "ce_specversion", Value: []byte(SpecVersion)},
+			{Key: "ce_id", Value: []byte("e1")},
+			{Key: "ce_type", Value: []byte(UserLiked)},
+			{Key: "ce_dataversion", Value: []byte("0")},
+		},
+	}
+	env, err := DecodeMessage(m)
+	if err != nil {
+		t.Fatalf("DecodeMessage() error = %v", err)
+	}
+	if env.Version != CurrentVersion || !env.Timestamp.IsZero() {
+		t.Errorf("DecodeMessage() = version %d at %v, want version %d without a time", env.Version, env.Timestamp, CurrentVersion)
+	}
+	assertJSON(t, env.Data, `{"user_id":1,"product_id":2,"liked_at":"2024-01-02T03:04:05Z"}`)
+
+	// A later header overrides an earlier one, so these replace valid attributes
+	// with an empty type or malformed values, which are rejected.
+	invalid := []struct {
+		header, value string
+		err           error
+	}{
+		{"ce_type", "", ErrMissingType},
+		{"ce_time", "yesterday", nil},
+		{"ce_dataversion", "one", nil},
+	}
+	for _, tt := range invalid {
+		bad := kafka.Message{Value: m.Value, Headers: append(append([]kafka.Header(nil), m.Headers...), kafka.Header{Key: tt.header, Value: []byte(tt.value)})}
+		_, err := DecodeMessage(bad)
+		if err == nil || (tt.err != nil && !errors.Is(err, tt.err)) {
+			t.Errorf("DecodeMessage() with %s %q error = %v, want an error", tt.header, tt.value, err)
+		}
+	}
+}
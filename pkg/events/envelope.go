@@ -0,0 +1,134 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrMissingType = errors.New("event type missing")
+	ErrMissingData = errors.New("event data missing")
+)
+
+// Envelope is the decoded form of an event. Until CloudEvents were adopted it
+// was also the JSON format published to Kafka, which Decode still accepts.
+type Envelope struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Version   int             `json:"version"`
+	Timestamp time.Time       `json:"timestamp"`
+	Producer  string          `json:"producer"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// New builds an envelope of the current version around payload. Payloads that
+// do not match the schema of eventType are rejected, so invalid events never
+// reach Kafka.
+func New(producer, eventType string, payload interface{}) (*Envelope, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s payload: %w", eventType, err)
+	}
+
+	env := &Envelope{
+		ID:        uuid.NewString(),
+		Type:      eventType,
+		Version:   CurrentVersion,
+		Timestamp: time.Now().UTC(),
+		Producer:  producer,
+		Data:      data,
+	}
+	if err := Validate(env); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// Encode returns env as a structured mode CloudEvent.
+func Encode(env *Envelope) ([]byte, error) {
+	if env.Type == "" {
+		return nil, ErrMissingType
+	}
+	if len(env.Data) == 0 {
+		return nil, ErrMissingData
+	}
+	return json.Marshal(toCloudEvent(env))
+}
+
+// Marshal is New followed by Encode.
+func Marshal(producer, eventType string, payload interface{}) ([]byte, error) {
+	env, err := New(producer, eventType, payload)
+	if err != nil {
+		return nil, err
+	}
+	return Encode(env)
+}
+
+// Decode parses a Kafka message value. Structured mode CloudEvents, the
+// envelope published before them and the legacy flat {"event": ...} messages
+// are accepted; the payload of older versions is upgraded to CurrentVersion so
+// that DecodeData always sees the current structs. Payloads of newer versions
+// are passed through as is, relying on new fields being additive.
+func Decode(value []byte) (*Envelope, error) {
+	var probe struct {
+		Envelope
+		SpecVersion string    `json:"specversion"`
+		Source      string    `json:"source"`
+		Time        time.Time `json:"time"`
+		DataVersion *int      `json:"dataversion"`
+		Event       string    `json:"event"`
+	}
+	if err := json.Unmarshal(value, &probe); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal event: %w", err)
+	}
+
+	env := probe.Envelope
+	if probe.SpecVersion != "" {
+		env.Version = CurrentVersion
+		if probe.DataVersion != nil {
+			env.Version = *probe.DataVersion
+		}
+		env.Timestamp = probe.Time
+		env.Producer = probe.Source
+	}
+	if env.Type == "" || len(env.Data) == 0 {
+		if probe.Event == "" {
+			return nil, ErrMissingType
+		}
+		env = Envelope{
+			Type:    probe.Event,
+			Version: 0,
+			Data:    json.RawMessage(value),
+		}
+	}
+
+	if err := upgrade(&env); err != nil {
+		return nil, err
+	}
+	return &env, nil
+}
+
+func upgrade(env *Envelope) error {
+	for env.Version < CurrentVersion {
+		if fn, ok := upgrades[env.Type][env.Version]; ok {
+			data, err := fn(env.Data)
+			if err != nil {
+				return fmt.Errorf("failed to upgrade %s from version %d: %w", env.Type, env.Version, err)
+			}
+			env.Data = data
+		}
+		env.Version++
+	}
+	return nil
+}
+
+func (e *Envelope) DecodeData(v interface{}) error {
+	if err := json.Unmarshal(e.Data, v); err != nil {
+		return fmt.Errorf("failed to decode %s payload: %w", e.Type, err)
+	}
+	return nil
+}
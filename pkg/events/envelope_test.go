@@ -0,0 +1,158 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		typ     string
+		version int
+		id      string
+		data    string
+		err     error
+	}{
+		{
+			name:    "legacy like",
+			value:   `{"event":"user_liked","user_id":1,"product_id":2,"like":{"liked_at":"2024-01-02T03:04:05Z"}}`,
+			typ:     UserLiked,
+			version: CurrentVersion,
+			data:    `{"user_id":1,"product_id":2,"liked_at":"2024-01-02T03:04:05Z"}`,
+		},
+		{
+			name:    "legacy dislike",
+			value:   `{"event":"user_disliked","user_id":1,"product_id":2,"dislike":{"disliked_at":"2024-01-02T03:04:05Z"}}`,
+			typ:     UserDisliked,
+			version: CurrentVersion,
+			data:    `{"user_id":1,"product_id":2,"disliked_at":"2024-01-02T03:04:05Z"}`,
+		},
+		{
+			name:    "legacy purchase",
+			value:   `{"event":"user_purchased","user_id":1,"product_id":2,"purchase":{"id":7,"purchased_at":"2024-01-02T03:04:05Z"}}`,
+			typ:     UserPurchased,
+			version: CurrentVersion,
+			data:    `{"user_id":1,"product_id":2,"purchase_id":7,"price":0,"purchased_at":"2024-01-02T03:04:05Z"}`,
+		},
+		{
+			name:    "legacy recommendation",
+			value:   `{"event":"recommendation_created","recommendation":{"id":3,"user_id":1,"product_ids":[2,4],"created_at":"2024-01-02T03:04:05Z"}}`,
+			typ:     RecommendationCreated,
+			version: CurrentVersion,
+			data:    `{"recommendation_id":3,"user_id":1,"product_ids":[2,4],"created_at":"2024-01-02T03:04:05Z"}`,
+		},
+		{
+			name:    "legacy type without upgrade",
+			value:   `{"event":"user_created","user":{"id":1,"name":"Ann"}}`,
+			typ:     UserCreated,
+			version: CurrentVersion,
+			data:    `{"event":"user_created","user":{"id":1,"name":"Ann"}}`,
+		},
+		{
+			name:    "envelope version 0",
+			value:   `{"id":"e1","type":"user_liked","version":0,"producer":"user-service","data":{"user_id":1,"product_id":2,"like":{"liked_at":"2024-01-02T03:04:05Z"}}}`,
+			typ:     UserLiked,
+			version: CurrentVersion,
+			id:      "e1",
+			data:    `{"user_id":1,"product_id":2,"liked_at":"2024-01-02T03:04:05Z"}`,
+		},
+		{
+			name:    "envelope current version",
+			value:   `{"id":"e1","type":"user_liked","version":1,"producer":"user-service","data":{"user_id":1,"product_id":2,"liked_at":"2024-01-02T03:04:05Z"}}`,
+			typ:     UserLiked,
+			version: CurrentVersion,
+			id:      "e1",
+			data:    `{"user_id":1,"product_id":2,"liked_at":"2024-01-02T03:04:05Z"}`,
+		},
+		{
+			name:    "cloudevent",
+			value:   `{"specversion":"1.0","id":"e1","source":"user-service","type":"user_liked","time":"2024-01-02T03:04:05Z","dataversion":1,"data":{"user_id":1,"product_id":2,"liked_at":"2024-01-02T03:04:05Z"}}`,
+			typ:     UserLiked,
+			version: CurrentVersion,
+			id:      "e1",
+			data:    `{"user_id":1,"product_id":2,"liked_at":"2024-01-02T03:04:05Z"}`,
+		},
+		{
+			name:    "cloudevent without dataversion",
+			value:   `{"specversion":"1.0","id":"e1","source":"user-service","type":"user_liked","data":{"user_id":1,"product_id":2,"liked_at":"2024-01-02T03:04:05Z"}}`,
+			typ:     UserLiked,
+			version: CurrentVersion,
+			id:      "e1",
+			data:    `{"user_id":1,"product_id":2,"liked_at":"2024-01-02T03:04:05Z"}`,
+		},
+		{
+			name:    "cloudevent version 0",
+			value:   `{"specversion":"1.0","id":"e1","source":"user-service","type":"user_liked","dataversion":0,"data":{"user_id":1,"product_id":2,"like":{"liked_at":"2024-01-02T03:04:05Z"}}}`,
+			typ:     UserLiked,
+			version: CurrentVersion,
+			id:      "e1",
+			data:    `{"user_id":1,"product_id":2,"liked_at":"2024-01-02T03:04:05Z"}`,
+		},
+		{
+			name:    "newer version",
+			value:   `{"specversion":"1.0","id":"e1","source":"user-service","type":"user_liked","dataversion":2,"data":{"user_id":1,"product_id":2,"liked_at":"2024-01-02T03:04:05Z","page":"home"}}`,
+			typ:     UserLiked,
+			version: 2,
+			id:      "e1",
+			data:    `{"user_id":1,"product_id":2,"liked_at":"2024-01-02T03:04:05Z","page":"home"}`,
+		},
+		{
+			name:  "missing type",
+			value: `{"id":"e1","data":{"user_id":1}}`,
+			err:   ErrMissingType,
+		},
+		{
+			name:  "not an event",
+			value: `{"user_id":1}`,
+			err:   ErrMissingType,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, err := Decode([]byte(tt.value))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Decode() error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if env.Type != tt.typ || env.Version != tt.version || env.ID != tt.id {
+				t.Errorf("Decode() = %s version %d with id %q, want %s version %d with id %q", env.Type, env.Version, env.ID, tt.typ, tt.version, tt.id)
+			}
+			assertJSON(t, env.Data, tt.data)
+		})
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	for _, value := range []string{
+		`not json`,
+		`{"event":"user_liked","like":"yesterday"}`,
+	} {
+		if env, err := Decode([]byte(value)); err == nil {
+			t.Errorf("Decode(%s) = %+v, want an error", value, env)
+		}
+	}
+}
+
+func assertJSON(t *testing.T, got json.RawMessage, want string) {
+	t.Helper()
+
+	var g, w interface{}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("invalid JSON %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("invalid JSON %s: %v", want, err)
+	}
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("data = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,99 @@
+package events
+
+import "time"
+
+// Event types published on the user_updates, product_updates and
+// recommendation_updates topics.
+const (
+	UserCreated           = "user_created"
+	UserUpdated           = "user_updated"
+	UserLiked             = "user_liked"
+	UserDisliked          = "user_disliked"
+	UserPurchased         = "user_purchased"
+	UserViewed            = "user_viewed"
+	ProductCreated        = "product_created"
+	ProductUpdated        = "product_updated"
+	ProductDeleted        = "product_deleted"
+	RecommendationCreated = "recommendation_created"
+)
+
+// CurrentVersion is the payload version written by Encode. Messages without an
+// envelope are the legacy {"event": ...} format and are treated as version 0.
+const CurrentVersion = 1
+
+type User struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type Product struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Price       float64   `json:"price"`
+	Category    string    `json:"category"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Interaction holds the fields shared by user_liked, user_disliked,
+// user_purchased and user_viewed, so consumers that only need the pair can decode into it.
+type Interaction struct {
+	UserID    int64 `json:"user_id"`
+	ProductID int64 `json:"product_id"`
+}
+
+type UserCreatedEvent struct {
+	User User `json:"user"`
+}
+
+type UserUpdatedEvent struct {
+	User User `json:"user"`
+}
+
+type UserLikedEvent struct {
+	Interaction
+	LikedAt time.Time `json:"liked_at"`
+}
+
+type UserDislikedEvent struct {
+	Interaction
+	DislikedAt time.Time `json:"disliked_at"`
+}
+
+// UserPurchasedEvent carries the price of the product at the time of the
+// purchase. Events published before prices were captured have none and count
+// as zero revenue.
+type UserPurchasedEvent struct {
+	Interaction
+	PurchaseID  int64     `json:"purchase_id"`
+	Price       float64   `json:"price"`
+	PurchasedAt time.Time `json:"purchased_at"`
+}
+
+type UserViewedEvent struct {
+	Interaction
+	ViewedAt time.Time `json:"viewed_at"`
+}
+
+type ProductCreatedEvent struct {
+	Product Product `json:"product"`
+}
+
+type ProductUpdatedEvent struct {
+	Product Product `json:"product"`
+}
+
+type ProductDeletedEvent struct {
+	ProductID int64 `json:"product_id"`
+}
+
+type RecommendationCreatedEvent struct {
+	RecommendationID int64     `json:"recommendation_id"`
+	UserID           int64     `json:"user_id"`
+	ProductIDs       []int64   `json:"product_ids"`
+	CreatedAt        time.Time `json:"created_at"`
+}
@@ -0,0 +1,99 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"recommendation-system/pkg/db"
+)
+
+// ProcessedStore remembers which events a consumer has already applied. Calls
+// made inside db.WithinTx take part in that transaction, so marking an event
+// and writing its effects either both happen or neither does.
+type ProcessedStore struct {
+	db       *db.DB
+	consumer string
+}
+
+func NewProcessedStore(database *db.DB, consumer string) *ProcessedStore {
+	return &ProcessedStore{db: database, consumer: consumer}
+}
+
+// MarkProcessed records the event and reports whether this is the first time
+// it was seen by the consumer.
+func (s *ProcessedStore) MarkProcessed(ctx context.Context, eventID string) (bool, error) {
+	query := `
+        INSERT INTO processed_events (consumer, event_id, processed_at)
+        VALUES ($1, $2, NOW())
+        ON CONFLICT (consumer, event_id) DO NOTHING
+    `
+	tag, err := s.db.Conn(ctx).Exec(ctx, query, s.consumer, eventID)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark event as processed: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// MarkProcessedBatch records the events and returns the IDs that were seen for
+// the first time.
+func (s *ProcessedStore) MarkProcessedBatch(ctx context.Context, eventIDs []string) (map[string]bool, error) {
+	query := `
+        INSERT INTO processed_events (consumer, event_id, processed_at)
+        SELECT $1, event_id, NOW() FROM unnest($2::text[]) AS event_id
+        ON CONFLICT (consumer, event_id) DO NOTHING
+        RETURNING event_id
+    `
+	rows, err := s.db.Conn(ctx).Query(ctx, query, s.consumer, eventIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark events as processed: %w", err)
+	}
+	defer rows.Close()
+
+	first := make(map[string]bool, len(eventIDs))
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan processed event: %w", err)
+		}
+		first[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to mark events as processed: %w", err)
+	}
+	return first, nil
+}
+
+func (s *ProcessedStore) DeleteProcessedBefore(ctx context.Context, before time.Time) (int64, error) {
+	query := `
+        DELETE FROM processed_events
+        WHERE consumer = $1 AND processed_at < $2
+    `
+	tag, err := s.db.Conn(ctx).Exec(ctx, query, s.consumer, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete processed events: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// Clear forgets every event of the consumer.
+func (s *ProcessedStore) Clear(ctx context.Context) error {
+	query := `
+        DELETE FROM processed_events
+        WHERE consumer = $1
+    `
+	if _, err := s.db.Conn(ctx).Exec(ctx, query, s.consumer); err != nil {
+		return fmt.Errorf("failed to clear processed events: %w", err)
+	}
+	return nil
+}
+
+// MessageID returns the ID used to deduplicate a consumed event. Legacy
+// messages carry no event ID; their position in the topic identifies them
+// instead, which still catches redeliveries of the same message.
+func MessageID(env *Envelope, topic string, partition int, offset int64) string {
+	if env.ID != "" {
+		return env.ID
+	}
+	return fmt.Sprintf("%s-%d-%d", topic, partition, offset)
+}
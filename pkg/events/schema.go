@@ -0,0 +1,93 @@
+package events
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// ErrInvalidEvent is wrapped by the errors of Validate.
+var ErrInvalidEvent = errors.New("invalid event")
+
+// The schemas describe the payload (the data of an envelope) of each event
+// type at CurrentVersion. They allow unknown properties, so additive changes
+// of newer versions still validate.
+//
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+// schemaBaseURL names the embedded schemas for the compiler, which would
+// otherwise resolve them against the working directory.
+const schemaBaseURL = "mem://events/"
+
+var (
+	schemaSources = make(map[string]json.RawMessage)
+	schemas       = make(map[string]*jsonschema.Schema)
+)
+
+func init() {
+	entries, err := schemaFiles.ReadDir("schemas")
+	if err != nil {
+		panic(err)
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft2020
+	compiler.AssertFormat = true
+	for _, entry := range entries {
+		source, err := schemaFiles.ReadFile(path.Join("schemas", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		eventType := strings.TrimSuffix(entry.Name(), ".json")
+		if err := compiler.AddResource(schemaBaseURL+entry.Name(), bytes.NewReader(source)); err != nil {
+			panic(fmt.Sprintf("invalid schema of %s: %v", eventType, err))
+		}
+		schemaSources[eventType] = source
+	}
+	for eventType := range schemaSources {
+		schemas[eventType] = compiler.MustCompile(schemaBaseURL + eventType + ".json")
+	}
+}
+
+// Validate checks the payload of env against the schema of its type. Events of
+// types without a schema are valid, so that consumers can skip event types
+// added after they were deployed.
+func Validate(env *Envelope) error {
+	schema, ok := schemas[env.Type]
+	if !ok {
+		return nil
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(env.Data, &data); err != nil {
+		return fmt.Errorf("%w: %s payload is not JSON: %v", ErrInvalidEvent, env.Type, err)
+	}
+	if err := schema.Validate(data); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidEvent, env.Type, err)
+	}
+	return nil
+}
+
+// Schema returns the JSON Schema of the payload of eventType.
+func Schema(eventType string) (json.RawMessage, bool) {
+	source, ok := schemaSources[eventType]
+	return source, ok
+}
+
+// SchemaTypes returns the event types that have a schema, sorted.
+func SchemaTypes() []string {
+	types := make([]string, 0, len(schemaSources))
+	for eventType := range schemaSources {
+		types = append(types, eventType)
+	}
+	sort.Strings(types)
+	return types
+}
@@ -0,0 +1,77 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValidateValid(t *testing.T) {
+	now := time.Now().UTC()
+	user := User{ID: 1, Name: "Ann", Email: "ann@example.com", CreatedAt: now, UpdatedAt: now}
+	product := Product{ID: 2, Name: "Book", Price: 9.99, Category: "books", CreatedAt: now, UpdatedAt: now}
+	interaction := Interaction{UserID: 1, ProductID: 2}
+	payloads := map[string]interface{}{
+		UserCreated:           UserCreatedEvent{User: user},
+		UserUpdated:           UserUpdatedEvent{User: user},
+		UserLiked:             UserLikedEvent{Interaction: interaction, LikedAt: now},
+		UserDisliked:          UserDislikedEvent{Interaction: interaction, DislikedAt: now},
+		UserPurchased:         UserPurchasedEvent{Interaction: interaction, PurchaseID: 3, Price: 9.99, PurchasedAt: now},
+		UserViewed:            UserViewedEvent{Interaction: interaction, ViewedAt: now},
+		ProductCreated:        ProductCreatedEvent{Product: product},
+		ProductUpdated:        ProductUpdatedEvent{Product: product},
+		ProductDeleted:        ProductDeletedEvent{ProductID: 2},
+		RecommendationCreated: RecommendationCreatedEvent{RecommendationID: 4, UserID: 1, ProductIDs: []int64{2, 5}, CreatedAt: now},
+	}
+
+	for _, eventType := range SchemaTypes() {
+		payload, ok := payloads[eventType]
+		if !ok {
+			t.Errorf("no valid %s payload to test its schema with", eventType)
+			continue
+		}
+		if _, err := New("test", eventType, payload); err != nil {
+			t.Errorf("New(%s) error = %v", eventType, err)
+		}
+	}
+}
+
+func TestValidateInvalid(t *testing.T) {
+	tests := []struct {
+		name      string
+		eventType string
+		data      string
+	}{
+		{"missing user", UserLiked, `{"product_id":2}`},
+		{"zero user", UserLiked, `{"user_id":0,"product_id":2}`},
+		{"string product", UserDisliked, `{"user_id":1,"product_id":"2"}`},
+		{"bad time", UserLiked, `{"user_id":1,"product_id":2,"liked_at":"yesterday"}`},
+		{"negative price", UserPurchased, `{"user_id":1,"product_id":2,"price":-1}`},
+		{"product without category", ProductCreated, `{"product":{"id":2,"name":"Book","price":9.99}}`},
+		{"recommended product zero", RecommendationCreated, `{"recommendation_id":1,"user_id":1,"product_ids":[0]}`},
+		{"not an object", UserViewed, `[1,2]`},
+		{"not JSON", UserLiked, `{"user_id":`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(&Envelope{Type: tt.eventType, Data: json.RawMessage(tt.data)})
+			if !errors.Is(err, ErrInvalidEvent) {
+				t.Errorf("Validate(%s) error = %v, want ErrInvalidEvent", tt.data, err)
+			}
+		})
+	}
+}
+
+func TestValidateUnknownType(t *testing.T) {
+	if err := Validate(&Envelope{Type: "user_archived", Data: json.RawMessage(`{"user_id":0}`)}); err != nil {
+		t.Errorf("Validate() of a type without a schema error = %v", err)
+	}
+}
+
+func TestNewRejectsInvalidPayload(t *testing.T) {
+	env, err := New("test", UserLiked, UserLikedEvent{Interaction: Interaction{ProductID: 2}})
+	if !errors.Is(err, ErrInvalidEvent) {
+		t.Errorf("New() = %+v, %v, want ErrInvalidEvent", env, err)
+	}
+}
@@ -0,0 +1,82 @@
+package events
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type upgrader func(data json.RawMessage) (json.RawMessage, error)
+
+// upgrades maps an event type and the version it upgrades from to the function
+// rewriting the payload into the next version. Types missing here kept the same
+// payload shape between versions.
+var upgrades = map[string]map[int]upgrader{
+	UserLiked:             {0: upgradeUserLikedV0},
+	UserDisliked:          {0: upgradeUserDislikedV0},
+	UserPurchased:         {0: upgradeUserPurchasedV0},
+	RecommendationCreated: {0: upgradeRecommendationCreatedV0},
+}
+
+func upgradeUserLikedV0(data json.RawMessage) (json.RawMessage, error) {
+	var v0 struct {
+		Interaction
+		Like struct {
+			LikedAt time.Time `json:"liked_at"`
+		} `json:"like"`
+	}
+	if err := json.Unmarshal(data, &v0); err != nil {
+		return nil, err
+	}
+	return json.Marshal(UserLikedEvent{Interaction: v0.Interaction, LikedAt: v0.Like.LikedAt})
+}
+
+func upgradeUserDislikedV0(data json.RawMessage) (json.RawMessage, error) {
+	var v0 struct {
+		Interaction
+		Dislike struct {
+			DislikedAt time.Time `json:"disliked_at"`
+		} `json:"dislike"`
+	}
+	if err := json.Unmarshal(data, &v0); err != nil {
+		return nil, err
+	}
+	return json.Marshal(UserDislikedEvent{Interaction: v0.Interaction, DislikedAt: v0.Dislike.DislikedAt})
+}
+
+func upgradeUserPurchasedV0(data json.RawMessage) (json.RawMessage, error) {
+	var v0 struct {
+		Interaction
+		Purchase struct {
+			ID          int64     `json:"id"`
+			PurchasedAt time.Time `json:"purchased_at"`
+		} `json:"purchase"`
+	}
+	if err := json.Unmarshal(data, &v0); err != nil {
+		return nil, err
+	}
+	return json.Marshal(UserPurchasedEvent{
+		Interaction: v0.Interaction,
+		PurchaseID:  v0.Purchase.ID,
+		PurchasedAt: v0.Purchase.PurchasedAt,
+	})
+}
+
+func upgradeRecommendationCreatedV0(data json.RawMessage) (json.RawMessage, error) {
+	var v0 struct {
+		Recommendation struct {
+			ID         int64     `json:"id"`
+			UserID     int64     `json:"user_id"`
+			ProductIDs []int64   `json:"product_ids"`
+			CreatedAt  time.Time `json:"created_at"`
+		} `json:"recommendation"`
+	}
+	if err := json.Unmarshal(data, &v0); err != nil {
+		return nil, err
+	}
+	return json.Marshal(RecommendationCreatedEvent{
+		RecommendationID: v0.Recommendation.ID,
+		UserID:           v0.Recommendation.UserID,
+		ProductIDs:       v0.Recommendation.ProductIDs,
+		CreatedAt:        v0.Recommendation.CreatedAt,
+	})
+}
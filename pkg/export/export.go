@@ -0,0 +1,260 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+const (
+	FormatCSV     = "csv"
+	FormatNDJSON  = "ndjson"
+	FormatParquet = "parquet"
+)
+
+type ColumnType int
+
+const (
+	Int64 ColumnType = iota
+	Float64
+	Time
+	String
+)
+
+type Column struct {
+	Name string
+	Type ColumnType
+}
+
+// Writer encodes rows whose values are int64, float64, time.Time or string,
+// in the order and of the types of the columns it was created with.
+type Writer interface {
+	Write(row []interface{}) error
+	// Flush writes the buffered rows to the output; for Parquet it ends the
+	// current row group.
+	Flush() error
+	// Close flushes the remaining rows and writes the trailer of the format,
+	// if any. It does not close the output.
+	Close() error
+}
+
+func NewWriter(format string, w io.Writer, columns []Column) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w, columns)
+	case FormatNDJSON:
+		return newNDJSONWriter(w, columns), nil
+	case FormatParquet:
+		return newParquetWriter(w, columns), nil
+	default:
+		return nil, fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	default:
+		return "application/vnd.apache.parquet"
+	}
+}
+
+// ParseTime parses a bound of an export range: an RFC 3339 timestamp or a
+// plain date, which is taken as midnight UTC. The result is in UTC, since the
+// bounds are compared with TIMESTAMP columns, which keep the wall clock of a
+// parameter and drop its offset. An empty value is the zero time.
+func ParseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
+func ValidFormat(format string) bool {
+	return format == FormatCSV || format == FormatNDJSON || format == FormatParquet
+}
+
+// flushOutput flushes w if it is buffered, so that a flushed chunk reaches
+// the client of a streamed response.
+func flushOutput(w io.Writer) error {
+	if f, ok := w.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+type csvWriter struct {
+	out    io.Writer
+	w      *csv.Writer
+	record []string
+}
+
+func newCSVWriter(w io.Writer, columns []Column) (*csvWriter, error) {
+	cw := &csvWriter{out: w, w: csv.NewWriter(w), record: make([]string, len(columns))}
+	for i, c := range columns {
+		cw.record[i] = c.Name
+	}
+	if err := cw.w.Write(cw.record); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+func (cw *csvWriter) Write(row []interface{}) error {
+	for i, v := range row {
+		switch v := v.(type) {
+		case int64:
+			cw.record[i] = strconv.FormatInt(v, 10)
+		case float64:
+			cw.record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		case time.Time:
+			cw.record[i] = v.UTC().Format(time.RFC3339Nano)
+		case string:
+			cw.record[i] = v
+		case nil:
+			cw.record[i] = ""
+		default:
+			return fmt.Errorf("unsupported export value %T", v)
+		}
+	}
+	return cw.w.Write(cw.record)
+}
+
+func (cw *csvWriter) Flush() error {
+	cw.w.Flush()
+	if err := cw.w.Error(); err != nil {
+		return err
+	}
+	return flushOutput(cw.out)
+}
+
+func (cw *csvWriter) Close() error {
+	return cw.Flush()
+}
+
+type ndjsonWriter struct {
+	out     io.Writer
+	w       *bufio.Writer
+	columns []Column
+}
+
+func newNDJSONWriter(w io.Writer, columns []Column) *ndjsonWriter {
+	return &ndjsonWriter{out: w, w: bufio.NewWriter(w), columns: columns}
+}
+
+// Write encodes the row as one JSON object with the keys in column order.
+func (nw *ndjsonWriter) Write(row []interface{}) error {
+	nw.w.WriteByte('{')
+	for i, v := range row {
+		if i > 0 {
+			nw.w.WriteByte(',')
+		}
+		key, _ := json.Marshal(nw.columns[i].Name)
+		nw.w.Write(key)
+		nw.w.WriteByte(':')
+		if t, ok := v.(time.Time); ok {
+			v = t.UTC()
+		}
+		value, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		nw.w.Write(value)
+	}
+	nw.w.WriteByte('}')
+	_, err := nw.w.WriteString("\n")
+	return err
+}
+
+func (nw *ndjsonWriter) Flush() error {
+	if err := nw.w.Flush(); err != nil {
+		return err
+	}
+	return flushOutput(nw.out)
+}
+
+func (nw *ndjsonWriter) Close() error {
+	return nw.Flush()
+}
+
+// parquetWriter writes one row group per Flush, so only the rows between two
+// flushes are held in memory.
+type parquetWriter struct {
+	out io.Writer
+	w   *parquet.Writer
+	// index maps a column to its position in the schema, which orders the
+	// columns by name.
+	index []int
+}
+
+func newParquetWriter(w io.Writer, columns []Column) *parquetWriter {
+	group := make(parquet.Group, len(columns))
+	for _, c := range columns {
+		switch c.Type {
+		case Int64:
+			group[c.Name] = parquet.Int(64)
+		case Float64:
+			group[c.Name] = parquet.Leaf(parquet.DoubleType)
+		case Time:
+			group[c.Name] = parquet.Timestamp(parquet.Millisecond)
+		default:
+			group[c.Name] = parquet.String()
+		}
+	}
+	schema := parquet.NewSchema("export", group)
+
+	pw := &parquetWriter{out: w, w: parquet.NewWriter(w, schema), index: make([]int, len(columns))}
+	for i, c := range columns {
+		leaf, _ := schema.Lookup(c.Name)
+		pw.index[i] = leaf.ColumnIndex
+	}
+	return pw
+}
+
+func (pw *parquetWriter) Write(row []interface{}) error {
+	values := make(parquet.Row, len(row))
+	for i, v := range row {
+		var value parquet.Value
+		switch v := v.(type) {
+		case int64:
+			value = parquet.Int64Value(v)
+		case float64:
+			value = parquet.DoubleValue(v)
+		case time.Time:
+			value = parquet.Int64Value(v.UnixMilli())
+		case string:
+			value = parquet.ByteArrayValue([]byte(v))
+		default:
+			return fmt.Errorf("unsupported export value %T", v)
+		}
+		values[pw.index[i]] = value.Level(0, 0, pw.index[i])
+	}
+	_, err := pw.w.WriteRows([]parquet.Row{values})
+	return err
+}
+
+func (pw *parquetWriter) Flush() error {
+	if err := pw.w.Flush(); err != nil {
+		return err
+	}
+	return flushOutput(pw.out)
+}
+
+func (pw *parquetWriter) Close() error {
+	if err := pw.w.Close(); err != nil {
+		return err
+	}
+	return flushOutput(pw.out)
+}
@@ -0,0 +1,39 @@
+package export
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Time
+		err   bool
+	}{
+		{value: "", want: time.Time{}},
+		{value: "2024-01-01", want: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{value: "2024-01-01T03:00:00Z", want: time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC)},
+		{value: "2024-01-01T03:00:00+03:00", want: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{value: "2024-01-01T01:30:00-02:00", want: time.Date(2024, 1, 1, 3, 30, 0, 0, time.UTC)},
+		{value: "01/02/2024", err: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTime(tt.value)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ParseTime(%q) = %v, want an error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseTime(%q) failed: %v", tt.value, err)
+			continue
+		}
+		// The wall clock is what reaches a TIMESTAMP column, so it must be
+		// the UTC one, not just the same instant.
+		if got != tt.want {
+			t.Errorf("ParseTime(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
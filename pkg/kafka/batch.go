@@ -0,0 +1,128 @@
+package kafka
+
+import (
+	"context"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type BatchConfig struct {
+	// Size is the maximum number of messages handed to the handler at once.
+	Size int
+	// Linger is how long to wait for more messages once the first message of
+	// a batch has arrived.
+	Linger time.Duration
+}
+
+func (c BatchConfig) withDefaults() BatchConfig {
+	if c.Size <= 0 {
+		c.Size = 500
+	}
+	if c.Linger <= 0 {
+		c.Linger = 200 * time.Millisecond
+	}
+	return c
+}
+
+// batchConsumer hands the messages of every partition to its own worker, like
+// consumer, and the worker handles them in micro-batches. Offsets of a batch
+// are committed only after batchHandler succeeded, so partitions are still
+// processed concurrently and each in order. On shutdown the batch being
+// collected is still handled and committed before run returns. A batch that
+// still fails after the retries is handled message by message through the
+// consumer, which isolates the failing message and moves it to the
+// dead-letter topic; if that fails too, run stops and returns the error.
+type batchConsumer struct {
+	consumer
+	cfg          BatchConfig
+	batchHandler func(messages []kafka.Message) error
+}
+
+func (c *batchConsumer) run(parent context.Context, reader fetcher) error {
+	return c.runPartitions(parent, reader, c.consumeBatches)
+}
+
+func (c *batchConsumer) consumeBatches(ctx context.Context, stop context.CancelCauseFunc, reader fetcher, queue <-chan kafka.Message) {
+	for {
+		batch, open := c.collectBatch(ctx, queue)
+		if len(batch) > 0 {
+			if err := c.handleBatch(ctx, batch); err != nil {
+				if ctx.Err() == nil {
+					stop(err)
+				}
+			} else {
+				c.commit(ctx, reader, batch...)
+			}
+		}
+		if !open {
+			return
+		}
+	}
+}
+
+// collectBatch waits for a message and then for up to Linger for more, until
+// the batch is full. Messages that arrive after ctx is done are dropped and
+// redelivered after a restart. It reports false once queue is closed.
+func (c *batchConsumer) collectBatch(ctx context.Context, queue <-chan kafka.Message) ([]kafka.Message, bool) {
+	first, ok := <-queue
+	if !ok {
+		return nil, false
+	}
+	if ctx.Err() != nil {
+		return nil, true
+	}
+
+	batch := []kafka.Message{first}
+	linger := time.NewTimer(c.cfg.Linger)
+	defer linger.Stop()
+
+	for len(batch) < c.cfg.Size {
+		select {
+		case m, ok := <-queue:
+			if !ok {
+				return batch, false
+			}
+			batch = append(batch, m)
+		case <-linger.C:
+			return batch, true
+		case <-ctx.Done():
+			return batch, true
+		}
+	}
+	return batch, true
+}
+
+// handleBatch returns an error when ctx is done before every message of the
+// batch was either handled or dead-lettered, or when dead-lettering failed.
+func (c *batchConsumer) handleBatch(ctx context.Context, batch []kafka.Message) error {
+	topic := batch[0].Topic
+
+	var err error
+	for attempts := 1; ; attempts++ {
+		start := time.Now()
+		err = c.batchHandler(batch)
+		consumerHandlerDuration.WithLabelValues(c.groupID, topic).Observe(time.Since(start).Seconds())
+		if err == nil {
+			for _, m := range batch {
+				consumerMessages.WithLabelValues(c.groupID, m.Topic, partitionLabel(m.Partition), "processed").Inc()
+			}
+			return nil
+		}
+		consumerHandlerErrors.WithLabelValues(c.groupID, topic).Inc()
+
+		if IsPermanent(err) || attempts >= c.retry.MaxAttempts {
+			break
+		}
+		if sleepErr := sleepContext(ctx, c.retry.backoff(attempts)); sleepErr != nil {
+			return sleepErr
+		}
+	}
+
+	for _, m := range batch {
+		if err := c.handleWithRetry(ctx, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
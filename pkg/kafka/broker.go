@@ -0,0 +1,44 @@
+package kafka
+
+import (
+	"context"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type Publisher interface {
+	PublishMessage(topic string, key, value []byte) error
+	PublishMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// Subscriber calls block until ctx is done and every handler has returned,
+// with the offsets of the handled messages committed. Callers that shut down
+// wait for the call to return before closing what the handlers use. Group
+// consumption also stops early, returning the error, when a failed message
+// cannot be moved to its dead-letter topic.
+type Subscriber interface {
+	// SubscribeToTopicsFallback consumes the topics as a member of the
+	// consumer group until ctx is done.
+	SubscribeToTopicsFallback(ctx context.Context, topics []string, groupID string, handler func(message kafka.Message) error) error
+	// SubscribeToTopicsBatch is SubscribeToTopicsFallback handing messages
+	// to batchHandler in micro-batches; handler is used for the messages of
+	// a batch that keeps failing.
+	SubscribeToTopicsBatch(ctx context.Context, topics []string, groupID string, cfg BatchConfig, batchHandler func(messages []kafka.Message) error, handler func(message kafka.Message) error) error
+	// SubscribeToTopicBroadcast delivers every message published to the
+	// topic after the call, independently of other subscribers. Handler
+	// errors are logged and counted but the message is not delivered again.
+	SubscribeToTopicBroadcast(ctx context.Context, topic string, handler func(message kafka.Message) error) error
+}
+
+// Broker is implemented by KafkaClient and MemoryBroker.
+type Broker interface {
+	Publisher
+	Subscriber
+	CreateTopic(topic string, numPartitions, replicationFactor int) error
+	Close() error
+}
+
+var (
+	_ Broker = (*KafkaClient)(nil)
+	_ Broker = (*MemoryBroker)(nil)
+)
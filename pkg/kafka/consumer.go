@@ -0,0 +1,188 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	log "recommendation-system/pkg/logger"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// fetcher is the part of a consumer group reader used by consumer. It is
+// implemented by *kafka.Reader and by the reader of MemoryBroker.
+type fetcher interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+const partitionQueueSize = 64
+
+// consumer runs the group consumption loop shared by all brokers: one worker
+// per partition, retries with backoff, dead-lettering and committing only
+// handled messages. When ctx is done it stops fetching, lets every worker
+// finish the message it is handling, commits it and returns; messages still
+// queued are left uncommitted and redelivered after a restart.
+//
+// A message that can be neither handled nor dead-lettered stops the consumer
+// the same way, and run returns the error: committing the messages after it
+// would skip it for good.
+type consumer struct {
+	retry       RetryConfig
+	deadLetters Publisher
+	groupID     string
+	handler     func(message kafka.Message) error
+	logger      *log.Logger
+	lag         *partitionLag
+}
+
+// partitionWorker handles the messages of one partition in queue order. It
+// calls stop with the error that makes the consumer give up.
+type partitionWorker func(ctx context.Context, stop context.CancelCauseFunc, reader fetcher, queue <-chan kafka.Message)
+
+func (c *consumer) run(parent context.Context, reader fetcher) error {
+	return c.runPartitions(parent, reader, c.consumePartition)
+}
+
+// runPartitions fetches messages and hands every partition to its own worker.
+func (c *consumer) runPartitions(parent context.Context, reader fetcher, worker partitionWorker) error {
+	defer reader.Close()
+	c.lag = newPartitionLag(c.groupID)
+
+	ctx, stop := context.WithCancelCause(parent)
+	defer stop(nil)
+
+	var wg sync.WaitGroup
+	queues := make(map[int]chan kafka.Message)
+	defer func() {
+		for _, q := range queues {
+			close(q)
+		}
+		wg.Wait()
+	}()
+
+	readFailures := 0
+	for {
+		m, err := reader.FetchMessage(ctx)
+		if ctx.Err() != nil {
+			return stopCause(parent, ctx)
+		} else if err != nil {
+			readFailures++
+			if sleepContext(ctx, c.retry.backoff(readFailures)) != nil {
+				return stopCause(parent, ctx)
+			}
+			continue
+		}
+		readFailures = 0
+		c.lag.fetched(m)
+
+		q, ok := queues[m.Partition]
+		if !ok {
+			q = make(chan kafka.Message, partitionQueueSize)
+			queues[m.Partition] = q
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				worker(ctx, stop, reader, q)
+			}()
+		}
+
+		select {
+		case q <- m:
+		case <-ctx.Done():
+			return stopCause(parent, ctx)
+		}
+	}
+}
+
+// stopCause returns why a partition worker stopped the consumer, or nil when
+// it stopped because parent is done.
+func stopCause(parent, ctx context.Context) error {
+	if parent.Err() != nil {
+		return nil
+	}
+	return context.Cause(ctx)
+}
+
+func (c *consumer) consumePartition(ctx context.Context, stop context.CancelCauseFunc, reader fetcher, queue <-chan kafka.Message) {
+	for m := range queue {
+		if ctx.Err() != nil {
+			continue
+		}
+		if err := c.handleWithRetry(ctx, m); err != nil {
+			if ctx.Err() == nil {
+				stop(err)
+			}
+			continue
+		}
+		c.commit(ctx, reader, m)
+	}
+}
+
+// commit commits the offsets of handled messages. A failed commit only means
+// the messages are redelivered, so it is logged and counted but not retried.
+func (c *consumer) commit(ctx context.Context, reader fetcher, msgs ...kafka.Message) {
+	// The commit must outlive the cancellation that stops the consumer,
+	// otherwise the last handled message of every partition is redelivered.
+	if err := reader.CommitMessages(context.WithoutCancel(ctx), msgs...); err != nil {
+		consumerCommitErrors.WithLabelValues(c.groupID, msgs[0].Topic).Inc()
+		c.logf("Failed to commit %d messages of %s for group %s: %v", len(msgs), msgs[0].Topic, c.groupID, err)
+		return
+	}
+	c.lag.committed(msgs...)
+}
+
+func (c *consumer) logf(format string, v ...interface{}) {
+	if c.logger != nil {
+		c.logger.Printf(format, v...)
+	}
+}
+
+// handleWithRetry returns an error when ctx is done before the message was
+// either handled or dead-lettered, or when publishing to the dead-letter topic
+// still fails after retry.MaxAttempts attempts.
+func (c *consumer) handleWithRetry(ctx context.Context, m kafka.Message) error {
+	attempts := 0
+	var err error
+	for {
+		attempts++
+		start := time.Now()
+		err = c.handler(m)
+		consumerHandlerDuration.WithLabelValues(c.groupID, m.Topic).Observe(time.Since(start).Seconds())
+		if err == nil {
+			consumerMessages.WithLabelValues(c.groupID, m.Topic, partitionLabel(m.Partition), "processed").Inc()
+			return nil
+		}
+		consumerHandlerErrors.WithLabelValues(c.groupID, m.Topic).Inc()
+		if IsPermanent(err) || attempts >= c.retry.MaxAttempts {
+			break
+		}
+		if sleepErr := sleepContext(ctx, c.retry.backoff(attempts)); sleepErr != nil {
+			return sleepErr
+		}
+	}
+
+	dlq := deadLetterMessage(m, c.groupID, attempts, err)
+	outcome := "dead_lettered"
+	if IsQuarantined(err) {
+		outcome = "quarantined"
+	}
+	for failures := 1; ; failures++ {
+		publishErr := c.deadLetters.PublishMessages(ctx, dlq)
+		if publishErr == nil {
+			consumerMessages.WithLabelValues(c.groupID, m.Topic, partitionLabel(m.Partition), outcome).Inc()
+			return nil
+		}
+		consumerDeadLetterErrors.WithLabelValues(c.groupID, m.Topic).Inc()
+		if failures >= c.retry.MaxAttempts {
+			c.logf("Failed to move message %d of %s/%d to %s, stopping the consumer: %v", m.Offset, m.Topic, m.Partition, dlq.Topic, publishErr)
+			return fmt.Errorf("failed to move message %d of %s/%d to %s: %w", m.Offset, m.Topic, m.Partition, dlq.Topic, publishErr)
+		}
+		if sleepErr := sleepContext(ctx, c.retry.backoff(failures)); sleepErr != nil {
+			return sleepErr
+		}
+	}
+}
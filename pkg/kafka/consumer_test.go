@@ -0,0 +1,202 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestRetryConfigBackoff(t *testing.T) {
+	cfg := RetryConfig{MaxAttempts: 5, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{10, time.Second},
+	}
+	for _, tt := range tests {
+		if got := cfg.backoff(tt.attempt); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestConsumerRetriesWithBackoff(t *testing.T) {
+	b := NewMemoryBroker(1)
+	b.Retry = RetryConfig{MaxAttempts: 5, InitialBackoff: 20 * time.Millisecond, MaxBackoff: 40 * time.Millisecond}
+	defer b.Close()
+
+	publish(t, b, "events", "a", "b")
+
+	var mu sync.Mutex
+	var attempts []time.Time
+	handled := make(chan kafka.Message, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- b.SubscribeToTopicsFallback(ctx, []string{"events"}, "group", func(m kafka.Message) error {
+			if string(m.Value) == "a" {
+				mu.Lock()
+				defer mu.Unlock()
+				attempts = append(attempts, time.Now())
+				if len(attempts) < 3 {
+					return errors.New("temporary failure")
+				}
+			}
+			handled <- m
+			return nil
+		})
+	}()
+
+	for _, want := range []string{"a", "b"} {
+		select {
+		case m := <-handled:
+			if string(m.Value) != want {
+				t.Errorf("handled %q, want %q", m.Value, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%q was not handled", want)
+		}
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("consumer stopped with error: %v", err)
+	}
+
+	if len(attempts) != 3 {
+		t.Fatalf("handled the message %d times, want 3", len(attempts))
+	}
+	for i, want := range []time.Duration{20 * time.Millisecond, 40 * time.Millisecond} {
+		if gap := attempts[i+1].Sub(attempts[i]); gap < want {
+			t.Errorf("retry %d after %v, want a backoff of at least %v", i+1, gap, want)
+		}
+	}
+	publish(t, b, DeadLetterTopic("events"), "marker")
+	if got := consume(t, b, DeadLetterTopic("events"), "reader", 1); string(got[0].Value) != "marker" {
+		t.Errorf("dead-lettered %q after a successful retry", got[0].Value)
+	}
+}
+
+func TestConsumerDeadLetters(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		topic    string
+		attempts int
+	}{
+		{name: "permanent", err: Permanent(errors.New("cannot decode")), topic: "events.dlq", attempts: 1},
+		{name: "exhausted", err: errors.New("database down"), topic: "events.dlq", attempts: 3},
+		{name: "quarantined", err: Quarantine(errors.New("invalid event")), topic: "events.quarantine", attempts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewMemoryBroker(2)
+			b.Retry = RetryConfig{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+			defer b.Close()
+
+			original := kafka.Message{
+				Topic:   "events",
+				Key:     []byte("key"),
+				Value:   []byte("value"),
+				Headers: []kafka.Header{{Key: "ce_type", Value: []byte("user_liked")}},
+			}
+			if err := b.PublishMessages(context.Background(), original); err != nil {
+				t.Fatalf("failed to publish: %v", err)
+			}
+
+			calls := 0
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() {
+				done <- b.SubscribeToTopicsFallback(ctx, []string{"events"}, "group", func(m kafka.Message) error {
+					calls++
+					original = m
+					return tt.err
+				})
+			}()
+
+			dl := consume(t, b, tt.topic, "reader", 1)[0]
+			cancel()
+			if err := <-done; err != nil {
+				t.Fatalf("consumer stopped with error: %v", err)
+			}
+
+			if calls != tt.attempts {
+				t.Errorf("handler called %d times, want %d", calls, tt.attempts)
+			}
+			if string(dl.Key) != "key" || string(dl.Value) != "value" || HeaderValue(dl, "ce_type") != "user_liked" {
+				t.Errorf("dead-lettered message %q/%q lost its key, value or headers", dl.Key, dl.Value)
+			}
+			headers := map[string]string{
+				HeaderDLQTopic:     "events",
+				HeaderDLQPartition: strconv.Itoa(original.Partition),
+				HeaderDLQOffset:    "0",
+				HeaderDLQGroup:     "group",
+				HeaderDLQError:     tt.err.Error(),
+				HeaderDLQAttempts:  strconv.Itoa(tt.attempts),
+			}
+			for key, want := range headers {
+				if got := HeaderValue(dl, key); got != want {
+					t.Errorf("header %s = %q, want %q", key, got, want)
+				}
+			}
+			if _, err := time.Parse(time.RFC3339Nano, HeaderValue(dl, HeaderDLQFailedAt)); err != nil {
+				t.Errorf("header %s: %v", HeaderDLQFailedAt, err)
+			}
+
+			redriven, err := RedriveMessage(dl)
+			if err != nil {
+				t.Fatalf("failed to redrive: %v", err)
+			}
+			if redriven.Topic != "events" || string(redriven.Value) != "value" || len(redriven.Headers) != 1 {
+				t.Errorf("redriven message = %s %q with headers %v, want the original", redriven.Topic, redriven.Value, redriven.Headers)
+			}
+
+			// The message was committed once it was dead-lettered, so the group
+			// resumes with the next message of its partition.
+			publish(t, b, "events", "key")
+			if got := consume(t, b, "events", "group", 1); string(got[0].Value) != "key" {
+				t.Errorf("redelivered %q after dead-lettering", got[0].Value)
+			}
+		})
+	}
+}
+
+// TestConsumerStopsWhenDeadLetteringFails checks that a message that can be
+// neither handled nor dead-lettered stops the consumer without committing it.
+func TestConsumerStopsWhenDeadLetteringFails(t *testing.T) {
+	b := NewMemoryBroker(1)
+	defer b.Close()
+	publish(t, b, "events", "a")
+
+	closed := NewMemoryBroker(1)
+	closed.Close()
+
+	c := &consumer{
+		retry:       RetryConfig{MaxAttempts: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+		deadLetters: closed,
+		groupID:     "group",
+		handler: func(m kafka.Message) error {
+			return Permanent(errors.New("cannot decode"))
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.run(ctx, b.newGroupReader("events", "group")); !errors.Is(err, ErrBrokerClosed) {
+		t.Fatalf("consumer stopped with %v, want the dead-letter error", err)
+	}
+
+	if got := consume(t, b, "events", "group", 1); string(got[0].Value) != "a" {
+		t.Errorf("redelivered %q, want the message that was not dead-lettered", got[0].Value)
+	}
+}
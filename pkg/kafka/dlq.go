@@ -0,0 +1,97 @@
+package kafka
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	DeadLetterSuffix = ".dlq"
+	QuarantineSuffix = ".quarantine"
+)
+
+// Headers added to a message when it is moved to a dead-letter topic.
+const (
+	HeaderDLQTopic     = "x-dlq-original-topic"
+	HeaderDLQPartition = "x-dlq-original-partition"
+	HeaderDLQOffset    = "x-dlq-original-offset"
+	HeaderDLQGroup     = "x-dlq-consumer-group"
+	HeaderDLQError     = "x-dlq-error"
+	HeaderDLQAttempts  = "x-dlq-attempts"
+	HeaderDLQFailedAt  = "x-dlq-failed-at"
+)
+
+func DeadLetterTopic(topic string) string {
+	return topic + DeadLetterSuffix
+}
+
+// QuarantineTopic receives the invalid messages of topic. They carry the same
+// headers as dead-lettered messages and can be re-driven the same way.
+func QuarantineTopic(topic string) string {
+	return topic + QuarantineSuffix
+}
+
+func deadLetterMessage(m kafka.Message, groupID string, attempts int, cause error) kafka.Message {
+	target := DeadLetterTopic(m.Topic)
+	if IsQuarantined(cause) {
+		target = QuarantineTopic(m.Topic)
+	}
+
+	headers := make([]kafka.Header, 0, len(m.Headers)+7)
+	headers = append(headers, m.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: HeaderDLQTopic, Value: []byte(m.Topic)},
+		kafka.Header{Key: HeaderDLQPartition, Value: []byte(strconv.Itoa(m.Partition))},
+		kafka.Header{Key: HeaderDLQOffset, Value: []byte(strconv.FormatInt(m.Offset, 10))},
+		kafka.Header{Key: HeaderDLQGroup, Value: []byte(groupID)},
+		kafka.Header{Key: HeaderDLQError, Value: []byte(cause.Error())},
+		kafka.Header{Key: HeaderDLQAttempts, Value: []byte(strconv.Itoa(attempts))},
+		kafka.Header{Key: HeaderDLQFailedAt, Value: []byte(time.Now().UTC().Format(time.RFC3339Nano))},
+	)
+
+	return kafka.Message{
+		Topic:   target,
+		Key:     m.Key,
+		Value:   m.Value,
+		Headers: headers,
+	}
+}
+
+// RedriveMessage turns a dead-lettered message back into a message for its
+// source topic, with the original key, value and headers.
+func RedriveMessage(m kafka.Message) (kafka.Message, error) {
+	topic := HeaderValue(m, HeaderDLQTopic)
+	if topic == "" {
+		topic = strings.TrimSuffix(strings.TrimSuffix(m.Topic, DeadLetterSuffix), QuarantineSuffix)
+	}
+	if topic == "" || topic == m.Topic {
+		return kafka.Message{}, fmt.Errorf("cannot determine source topic of message at %s/%d/%d", m.Topic, m.Partition, m.Offset)
+	}
+
+	var headers []kafka.Header
+	for _, h := range m.Headers {
+		if !strings.HasPrefix(h.Key, "x-dlq-") {
+			headers = append(headers, h)
+		}
+	}
+
+	return kafka.Message{
+		Topic:   topic,
+		Key:     m.Key,
+		Value:   m.Value,
+		Headers: headers,
+	}, nil
+}
+
+func HeaderValue(m kafka.Message, key string) string {
+	for i := len(m.Headers) - 1; i >= 0; i-- {
+		if m.Headers[i].Key == key {
+			return string(m.Headers[i].Value)
+		}
+	}
+	return ""
+}
@@ -5,25 +5,37 @@ import (
 	"errors"
 	"net"
 	"strconv"
+	"sync"
+
+	log "recommendation-system/pkg/logger"
 
 	"github.com/segmentio/kafka-go"
 )
 
 type KafkaClient struct {
 	Brokers []string
-	writer  *kafka.Writer
+	Retry   RetryConfig
+	// Logger receives the failures of consumers that are not returned to the
+	// handler, e.g. failed offset commits. It may be nil.
+	Logger *log.Logger
+	writer *kafka.Writer
 }
 
 func NewKafkaClient(brokers []string) *KafkaClient {
 	return &KafkaClient{
 		Brokers: brokers,
+		Retry:   DefaultRetryConfig(),
 		writer: &kafka.Writer{
 			Addr:     kafka.TCP(brokers...),
-			Balancer: &kafka.LeastBytes{},
+			Balancer: &kafka.Hash{},
 		},
 	}
 }
 
+// CreateTopic creates the topic, or grows it to numPartitions when it already
+// exists with fewer partitions. Keys are mapped to partitions by hash, so
+// growing a topic moves keys to other partitions; only do it while the
+// consumers are caught up.
 func (k *KafkaClient) CreateTopic(topic string, numPartitions, replicationFactor int) error {
 	conn, err := kafka.Dial("tcp", k.Brokers[0])
 	if err != nil {
@@ -50,7 +62,26 @@ func (k *KafkaClient) CreateTopic(topic string, numPartitions, replicationFactor
 		},
 	}
 
-	return controllerConn.CreateTopics(topicConfigs...)
+	if err := controllerConn.CreateTopics(topicConfigs...); err != nil {
+		return err
+	}
+
+	partitions, err := controllerConn.ReadPartitions(topic)
+	if err != nil {
+		return err
+	}
+	if len(partitions) >= numPartitions {
+		return nil
+	}
+
+	client := &kafka.Client{Addr: kafka.TCP(k.Brokers...)}
+	resp, err := client.CreatePartitions(context.Background(), &kafka.CreatePartitionsRequest{
+		Topics: []kafka.TopicPartitionsConfig{{Name: topic, Count: int32(numPartitions)}},
+	})
+	if err != nil {
+		return err
+	}
+	return resp.Errors[topic]
 }
 
 func (k *KafkaClient) PublishMessage(topic string, key, value []byte) error {
@@ -63,6 +94,10 @@ func (k *KafkaClient) PublishMessage(topic string, key, value []byte) error {
 	return k.writer.WriteMessages(context.Background(), msg)
 }
 
+func (k *KafkaClient) PublishMessages(ctx context.Context, msgs ...kafka.Message) error {
+	return k.writer.WriteMessages(ctx, msgs...)
+}
+
 func (k *KafkaClient) SubscribeToTopic(ctx context.Context, topic, groupID string) error {
 	r := kafka.NewReader(kafka.ReaderConfig{
 		Brokers:  k.Brokers,
@@ -112,33 +147,125 @@ func (k *KafkaClient) Close() error {
 	return nil
 }
 
+// SubscribeToTopicsFallback consumes the topics as part of the consumer group.
+// Every assigned partition is handled by its own worker, so partitions are
+// processed concurrently while messages of one partition, and therefore of one
+// key, are handled in order. Offsets are committed only once the handler
+// succeeded or the message was moved to the dead-letter topic, so a crash
+// never loses a message.
 func (k *KafkaClient) SubscribeToTopicsFallback(ctx context.Context, topics []string, groupID string, handler func(message kafka.Message) error) error {
-	for _, topic := range topics {
-		go func(topic string) {
+	var wg sync.WaitGroup
+	errs := make([]error, len(topics))
+	for i, topic := range topics {
+		reader := kafka.NewReader(kafka.ReaderConfig{
+			Brokers:  k.Brokers,
+			GroupID:  groupID,
+			Topic:    topic,
+			MinBytes: 10e3,
+			MaxBytes: 10e6,
+		})
+		c := &consumer{retry: k.Retry, deadLetters: k, groupID: groupID, handler: handler, logger: k.Logger}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = c.run(ctx, reader)
+		}()
+	}
+
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// SubscribeToTopicsBatch consumes the topics as part of the consumer group in
+// micro-batches of up to cfg.Size messages. Like SubscribeToTopicsFallback it
+// runs a worker per partition, and a batch only holds messages of one
+// partition. Offsets of a batch are committed after batchHandler returned nil.
+func (k *KafkaClient) SubscribeToTopicsBatch(ctx context.Context, topics []string, groupID string, cfg BatchConfig, batchHandler func(messages []kafka.Message) error, handler func(message kafka.Message) error) error {
+	cfg = cfg.withDefaults()
+	var wg sync.WaitGroup
+	errs := make([]error, len(topics))
+	for i, topic := range topics {
+		reader := kafka.NewReader(kafka.ReaderConfig{
+			Brokers:  k.Brokers,
+			GroupID:  groupID,
+			Topic:    topic,
+			MinBytes: 10e3,
+			MaxBytes: 10e6,
+		})
+		c := &batchConsumer{
+			consumer:     consumer{retry: k.Retry, deadLetters: k, groupID: groupID, handler: handler, logger: k.Logger},
+			cfg:          cfg,
+			batchHandler: batchHandler,
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = c.run(ctx, reader)
+		}()
+	}
+
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// SubscribeToTopicBroadcast reads every partition of the topic starting from
+// the newest offset without joining a consumer group, so each running
+// instance receives every message published after it subscribed.
+func (k *KafkaClient) SubscribeToTopicBroadcast(ctx context.Context, topic string, handler func(message kafka.Message) error) error {
+	partitions, err := kafka.LookupPartitions(ctx, "tcp", k.Brokers[0], topic)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	for _, p := range partitions {
+		wg.Add(1)
+		go func(partition int) {
+			defer wg.Done()
 			reader := kafka.NewReader(kafka.ReaderConfig{
-				Brokers:  k.Brokers,
-				GroupID:  groupID,
-				Topic:    topic,
-				MinBytes: 10e3,
-				MaxBytes: 10e6,
+				Brokers:   k.Brokers,
+				Topic:     topic,
+				Partition: partition,
+				MinBytes:  1,
+				MaxBytes:  10e6,
 			})
 			defer reader.Close()
 
+			if err := reader.SetOffset(kafka.LastOffset); err != nil {
+				return
+			}
+
+			readFailures := 0
 			for {
 				m, err := reader.ReadMessage(ctx)
-				if errors.Is(err, context.Canceled) {
+				if ctx.Err() != nil {
 					break
 				} else if err != nil {
+					readFailures++
+					if sleepContext(ctx, k.Retry.backoff(readFailures)) != nil {
+						break
+					}
 					continue
 				}
+				readFailures = 0
 
-				if err := handler(m); err != nil {
-					continue
-				}
+				handleBroadcast(k.Logger, m, handler)
 			}
-		}(topic)
+		}(p.ID)
 	}
 
-	<-ctx.Done()
+	wg.Wait()
 	return nil
 }
+
+// handleBroadcast records a failed handler instead of retrying it: without a
+// consumer group there is no offset to hold back, and a broadcast subscriber
+// only needs the messages published while it is running.
+func handleBroadcast(logger *log.Logger, m kafka.Message, handler func(message kafka.Message) error) {
+	if err := handler(m); err != nil {
+		broadcastHandlerErrors.WithLabelValues(m.Topic).Inc()
+		if logger != nil {
+			logger.Printf("Failed to handle broadcast message %d of %s/%d: %v", m.Offset, m.Topic, m.Partition, err)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	log "recommendation-system/pkg/logger"
+
+	"github.com/segmentio/kafka-go"
+)
+
+var ErrBrokerClosed = errors.New("broker closed")
+
+// MemoryBroker is an in-process Broker keeping every topic as a set of
+// partition logs. Messages are routed to partitions by key like KafkaClient
+// does, consumer groups track committed offsets per partition, and group
+// consumption goes through the same retry and dead-letter loop, so the event
+// pipeline can run in a single process without a Kafka cluster.
+//
+// Partitions of a topic are assigned to the first group member that asks for
+// them and released when that member stops; there is no rebalancing between
+// live members.
+type MemoryBroker struct {
+	Retry  RetryConfig
+	Logger *log.Logger
+
+	mu                sync.Mutex
+	defaultPartitions int
+	topics            map[string][][]kafka.Message
+	groups            map[memoryGroupKey]*memoryGroup
+	changed           chan struct{}
+	closed            bool
+	balancer          kafka.Hash
+}
+
+type memoryGroupKey struct {
+	groupID string
+	topic   string
+}
+
+type memoryGroup struct {
+	committed map[int]int64
+	owners    map[int]*memoryReader
+}
+
+// NewMemoryBroker creates a broker whose topics are created on first use with
+// defaultPartitions partitions.
+func NewMemoryBroker(defaultPartitions int) *MemoryBroker {
+	if defaultPartitions <= 0 {
+		defaultPartitions = 1
+	}
+	return &MemoryBroker{
+		Retry:             DefaultRetryConfig(),
+		defaultPartitions: defaultPartitions,
+		topics:            make(map[string][][]kafka.Message),
+		groups:            make(map[memoryGroupKey]*memoryGroup),
+		changed:           make(chan struct{}),
+	}
+}
+
+func (b *MemoryBroker) CreateTopic(topic string, numPartitions, replicationFactor int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	partitions := b.topics[topic]
+	for len(partitions) < numPartitions {
+		partitions = append(partitions, nil)
+	}
+	b.topics[topic] = partitions
+	return nil
+}
+
+// partitionsLocked returns the partition logs of topic, creating the topic
+// when it does not exist yet.
+func (b *MemoryBroker) partitionsLocked(topic string) [][]kafka.Message {
+	partitions, ok := b.topics[topic]
+	if !ok {
+		partitions = make([][]kafka.Message, b.defaultPartitions)
+		b.topics[topic] = partitions
+	}
+	return partitions
+}
+
+func (b *MemoryBroker) PublishMessage(topic string, key, value []byte) error {
+	return b.PublishMessages(context.Background(), kafka.Message{Topic: topic, Key: key, Value: value})
+}
+
+func (b *MemoryBroker) PublishMessages(ctx context.Context, msgs ...kafka.Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrBrokerClosed
+	}
+
+	for _, m := range msgs {
+		partitions := b.partitionsLocked(m.Topic)
+		ids := make([]int, len(partitions))
+		for i := range ids {
+			ids[i] = i
+		}
+
+		m.Partition = b.balancer.Balance(m, ids...)
+		m.Offset = int64(len(partitions[m.Partition]))
+		if m.Time.IsZero() {
+			m.Time = time.Now()
+		}
+		partitions[m.Partition] = append(partitions[m.Partition], m)
+	}
+
+	b.notifyLocked()
+	return nil
+}
+
+func (b *MemoryBroker) notifyLocked() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+func (b *MemoryBroker) SubscribeToTopicsFallback(ctx context.Context, topics []string, groupID string, handler func(message kafka.Message) error) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(topics))
+	for i, topic := range topics {
+		reader := b.newGroupReader(topic, groupID)
+		c := &consumer{retry: b.Retry, deadLetters: b, groupID: groupID, handler: handler, logger: b.Logger}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = c.run(ctx, reader)
+		}()
+	}
+
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (b *MemoryBroker) SubscribeToTopicsBatch(ctx context.Context, topics []string, groupID string, cfg BatchConfig, batchHandler func(messages []kafka.Message) error, handler func(message kafka.Message) error) error {
+	cfg = cfg.withDefaults()
+	var wg sync.WaitGroup
+	errs := make([]error, len(topics))
+	for i, topic := range topics {
+		reader := b.newGroupReader(topic, groupID)
+		c := &batchConsumer{
+			consumer:     consumer{retry: b.Retry, deadLetters: b, groupID: groupID, handler: handler, logger: b.Logger},
+			cfg:          cfg,
+			batchHandler: batchHandler,
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = c.run(ctx, reader)
+		}()
+	}
+
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (b *MemoryBroker) newGroupReader(topic, groupID string) *memoryReader {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.partitionsLocked(topic)
+	key := memoryGroupKey{groupID: groupID, topic: topic}
+	group, ok := b.groups[key]
+	if !ok {
+		group = &memoryGroup{committed: make(map[int]int64), owners: make(map[int]*memoryReader)}
+		b.groups[key] = group
+	}
+	return &memoryReader{broker: b, topic: topic, group: group, positions: make(map[int]int64)}
+}
+
+func (b *MemoryBroker) SubscribeToTopicBroadcast(ctx context.Context, topic string, handler func(message kafka.Message) error) error {
+	b.mu.Lock()
+	reader := &memoryReader{broker: b, topic: topic, positions: make(map[int]int64)}
+	for p, log := range b.partitionsLocked(topic) {
+		reader.positions[p] = int64(len(log))
+	}
+	b.mu.Unlock()
+
+	defer reader.Close()
+	for {
+		m, err := reader.FetchMessage(ctx)
+		if err != nil {
+			return nil
+		}
+		handleBroadcast(b.Logger, m, handler)
+	}
+}
+
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.closed {
+		b.closed = true
+		b.notifyLocked()
+	}
+	return nil
+}
+
+// memoryReader reads one topic of a MemoryBroker, either as a member of a
+// consumer group or, with a nil group, on its own.
+type memoryReader struct {
+	broker    *MemoryBroker
+	topic     string
+	group     *memoryGroup
+	positions map[int]int64
+	next      int
+}
+
+func (r *memoryReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	b := r.broker
+	for {
+		b.mu.Lock()
+		if b.closed {
+			b.mu.Unlock()
+			return kafka.Message{}, ErrBrokerClosed
+		}
+
+		partitions := b.partitionsLocked(r.topic)
+		for i := 0; i < len(partitions); i++ {
+			p := (r.next + i) % len(partitions)
+			if r.group != nil {
+				owner, ok := r.group.owners[p]
+				if !ok {
+					r.group.owners[p] = r
+					r.positions[p] = r.group.committed[p]
+				} else if owner != r {
+					continue
+				}
+			}
+
+			pos := r.positions[p]
+			if pos >= int64(len(partitions[p])) {
+				continue
+			}
+
+			m := partitions[p][pos]
+			m.HighWaterMark = int64(len(partitions[p]))
+			r.positions[p] = pos + 1
+			r.next = p + 1
+			b.mu.Unlock()
+			return m, nil
+		}
+
+		changed := b.changed
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return kafka.Message{}, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+func (r *memoryReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if r.group == nil {
+		return nil
+	}
+
+	r.broker.mu.Lock()
+	defer r.broker.mu.Unlock()
+
+	for _, m := range msgs {
+		if r.group.committed[m.Partition] < m.Offset+1 {
+			r.group.committed[m.Partition] = m.Offset + 1
+		}
+	}
+	return nil
+}
+
+// Close releases the partitions owned by the reader, so another member of
+// the group resumes them from the committed offsets.
+func (r *memoryReader) Close() error {
+	if r.group == nil {
+		return nil
+	}
+
+	r.broker.mu.Lock()
+	defer r.broker.mu.Unlock()
+
+	for p, owner := range r.group.owners {
+		if owner == r {
+			delete(r.group.owners, p)
+		}
+	}
+	r.broker.notifyLocked()
+	return nil
+}
@@ -0,0 +1,160 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// consume runs a group subscription until n messages were handled and
+// returns them.
+func consume(t *testing.T, b *MemoryBroker, topic, groupID string, n int) []kafka.Message {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan kafka.Message, n)
+	done := make(chan error, 1)
+	go func() {
+		done <- b.SubscribeToTopicsFallback(ctx, []string{topic}, groupID, func(m kafka.Message) error {
+			received <- m
+			return nil
+		})
+	}()
+
+	msgs := make([]kafka.Message, 0, n)
+	for len(msgs) < n {
+		select {
+		case m := <-received:
+			msgs = append(msgs, m)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("read %d of %d messages from %s", len(msgs), n, topic)
+		}
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("consumer stopped with error: %v", err)
+	}
+	return msgs
+}
+
+func publish(t *testing.T, b *MemoryBroker, topic string, keys ...string) {
+	t.Helper()
+
+	msgs := make([]kafka.Message, len(keys))
+	for i, key := range keys {
+		msgs[i] = kafka.Message{Topic: topic, Key: []byte(key), Value: []byte(key)}
+	}
+	if err := b.PublishMessages(context.Background(), msgs...); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+}
+
+func TestMemoryBrokerGroupOffsets(t *testing.T) {
+	b := NewMemoryBroker(1)
+	defer b.Close()
+
+	publish(t, b, "events", "a", "b", "c")
+	if got := consume(t, b, "events", "first", 3); got[2].Offset != 2 {
+		t.Fatalf("last message at offset %d, want 2", got[2].Offset)
+	}
+
+	// The group resumes after its committed offsets, another group starts
+	// from the beginning.
+	publish(t, b, "events", "d", "e")
+	got := consume(t, b, "events", "first", 2)
+	if string(got[0].Value) != "d" || got[0].Offset != 3 || string(got[1].Value) != "e" {
+		t.Errorf("group resumed with %q at offset %d, want d at offset 3", got[0].Value, got[0].Offset)
+	}
+	if got := consume(t, b, "events", "second", 5); string(got[0].Value) != "a" {
+		t.Errorf("new group started with %q, want a", got[0].Value)
+	}
+}
+
+func TestMemoryBrokerPartitioning(t *testing.T) {
+	b := NewMemoryBroker(4)
+	defer b.Close()
+
+	keys := []string{"a", "b", "c", "d", "a", "b", "c", "d", "a"}
+	publish(t, b, "events", keys...)
+
+	partitions := make(map[string]int)
+	offsets := make(map[int]int64)
+	for _, m := range consume(t, b, "events", "group", len(keys)) {
+		p, ok := partitions[string(m.Key)]
+		if !ok {
+			partitions[string(m.Key)] = m.Partition
+		} else if p != m.Partition {
+			t.Errorf("key %s published to partitions %d and %d", m.Key, p, m.Partition)
+		}
+		if last, ok := offsets[m.Partition]; ok && m.Offset <= last {
+			t.Errorf("partition %d delivered offset %d after %d", m.Partition, m.Offset, last)
+		}
+		offsets[m.Partition] = m.Offset
+	}
+}
+
+func TestMemoryBrokerPartitionOwnership(t *testing.T) {
+	b := NewMemoryBroker(1)
+	defer b.Close()
+
+	publish(t, b, "events", "a", "b")
+	first := b.newGroupReader("events", "group")
+	second := b.newGroupReader("events", "group")
+
+	m, err := first.FetchMessage(context.Background())
+	if err != nil {
+		t.Fatalf("failed to fetch: %v", err)
+	}
+	if err := first.CommitMessages(context.Background(), m); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	// The partition belongs to the first reader until it stops.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if m, err := second.FetchMessage(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("second reader fetched %q from an owned partition, err %v", m.Value, err)
+	}
+
+	first.Close()
+	m, err = second.FetchMessage(context.Background())
+	if err != nil {
+		t.Fatalf("failed to fetch after release: %v", err)
+	}
+	if string(m.Value) != "b" || m.Offset != 1 {
+		t.Errorf("second reader resumed with %q at offset %d, want b at the committed offset 1", m.Value, m.Offset)
+	}
+}
+
+func TestMemoryBrokerClose(t *testing.T) {
+	b := NewMemoryBroker(1)
+	publish(t, b, "events", "a")
+	reader := b.newGroupReader("events", "group")
+	b.Close()
+
+	if err := b.PublishMessage("events", []byte("b"), []byte("b")); !errors.Is(err, ErrBrokerClosed) {
+		t.Errorf("publish after Close returned %v, want ErrBrokerClosed", err)
+	}
+	if _, err := reader.FetchMessage(context.Background()); !errors.Is(err, ErrBrokerClosed) {
+		t.Errorf("fetch after Close returned %v, want ErrBrokerClosed", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- b.SubscribeToTopicBroadcast(context.Background(), "events", func(m kafka.Message) error {
+			t.Errorf("broadcast delivered %q after Close", m.Value)
+			return nil
+		})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("broadcast stopped with error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("broadcast subscription did not stop after Close")
+	}
+}
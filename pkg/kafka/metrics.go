@@ -0,0 +1,117 @@
+package kafka
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/segmentio/kafka-go"
+)
+
+var (
+	consumerLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kafka_consumer_lag",
+		Help: "Messages between the next offset to commit and the end of the partition.",
+	}, []string{"group", "topic", "partition"})
+
+	consumerMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_consumer_messages_total",
+		Help: "Messages finished by the consumer, by outcome (processed or dead_lettered).",
+	}, []string{"group", "topic", "partition", "outcome"})
+
+	consumerHandlerErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_consumer_handler_errors_total",
+		Help: "Failed handler attempts, including the ones that were retried.",
+	}, []string{"group", "topic"})
+
+	consumerCommitErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_consumer_commit_errors_total",
+		Help: "Failed offset commits; the messages are redelivered.",
+	}, []string{"group", "topic"})
+
+	consumerDeadLetterErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_consumer_dead_letter_errors_total",
+		Help: "Failed attempts to publish a message to its dead-letter or quarantine topic.",
+	}, []string{"group", "topic"})
+
+	broadcastHandlerErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_broadcast_handler_errors_total",
+		Help: "Broadcast messages whose handler failed; they are not redelivered.",
+	}, []string{"topic"})
+
+	consumerHandlerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kafka_consumer_handler_duration_seconds",
+		Help:    "Duration of a single handler attempt.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 14),
+	}, []string{"group", "topic"})
+)
+
+func partitionLabel(partition int) string {
+	return strconv.Itoa(partition)
+}
+
+type topicPartition struct {
+	topic     string
+	partition int
+}
+
+// partitionLag keeps the lag gauge of the partitions read by one consumer.
+// The end of a partition is the high-water mark of the newest fetch and the
+// position is the next offset to commit, so messages fetched but still queued
+// or being handled count as lag and the gauge moves on every fetch.
+type partitionLag struct {
+	groupID string
+
+	mu        sync.Mutex
+	highWater map[topicPartition]int64
+	next      map[topicPartition]int64
+}
+
+func newPartitionLag(groupID string) *partitionLag {
+	return &partitionLag{
+		groupID:   groupID,
+		highWater: make(map[topicPartition]int64),
+		next:      make(map[topicPartition]int64),
+	}
+}
+
+func (l *partitionLag) fetched(m kafka.Message) {
+	tp := topicPartition{m.Topic, m.Partition}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if m.HighWaterMark > l.highWater[tp] {
+		l.highWater[tp] = m.HighWaterMark
+	}
+	// The committed offset is not known before the first commit; the first
+	// fetched message is where the consumer resumed.
+	if _, ok := l.next[tp]; !ok {
+		l.next[tp] = m.Offset
+	}
+	l.setLocked(tp)
+}
+
+func (l *partitionLag) committed(msgs ...kafka.Message) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, m := range msgs {
+		tp := topicPartition{m.Topic, m.Partition}
+		if m.Offset+1 > l.next[tp] {
+			l.next[tp] = m.Offset + 1
+		}
+		l.setLocked(tp)
+	}
+}
+
+func (l *partitionLag) setLocked(tp topicPartition) {
+	hw, ok := l.highWater[tp]
+	if !ok || hw == 0 {
+		return
+	}
+	lag := hw - l.next[tp]
+	if lag < 0 {
+		lag = 0
+	}
+	consumerLag.WithLabelValues(l.groupID, tp.topic, partitionLabel(tp.partition)).Set(float64(lag))
+}
@@ -0,0 +1,66 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// OffsetsAt returns, for every partition of the topic, the offset of the first
+// message written at or after t. A zero t selects the first available offset.
+func (k *KafkaClient) OffsetsAt(ctx context.Context, topic string, t time.Time) (map[int]int64, error) {
+	partitions, err := kafka.LookupPartitions(ctx, "tcp", k.Brokers[0], topic)
+	if err != nil {
+		return nil, err
+	}
+
+	offsets := make(map[int]int64, len(partitions))
+	for _, p := range partitions {
+		conn, err := kafka.DialLeader(ctx, "tcp", k.Brokers[0], topic, p.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		var offset int64
+		if t.IsZero() {
+			offset, err = conn.ReadFirstOffset()
+		} else {
+			offset, err = conn.ReadOffset(t)
+		}
+		conn.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read offset of partition %d: %w", p.ID, err)
+		}
+		offsets[p.ID] = offset
+	}
+	return offsets, nil
+}
+
+// CommitGroupOffsets overwrites the committed offsets of a consumer group for
+// the topic. Kafka accepts this only while the group has no active members, so
+// the consuming services have to be stopped first.
+func (k *KafkaClient) CommitGroupOffsets(ctx context.Context, groupID, topic string, offsets map[int]int64) error {
+	commits := make([]kafka.OffsetCommit, 0, len(offsets))
+	for partition, offset := range offsets {
+		commits = append(commits, kafka.OffsetCommit{Partition: partition, Offset: offset})
+	}
+
+	client := &kafka.Client{Addr: kafka.TCP(k.Brokers...)}
+	resp, err := client.OffsetCommit(ctx, &kafka.OffsetCommitRequest{
+		GroupID:      groupID,
+		GenerationID: -1,
+		Topics:       map[string][]kafka.OffsetCommit{topic: commits},
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, p := range resp.Topics[topic] {
+		if p.Error != nil {
+			return fmt.Errorf("failed to commit offset of partition %d: %w", p.Partition, p.Error)
+		}
+	}
+	return nil
+}
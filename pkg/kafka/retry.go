@@ -0,0 +1,86 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// RetryConfig controls how SubscribeToTopicsFallback handles a message whose
+// handler returns an error. The handler is called up to MaxAttempts times with
+// exponential backoff between attempts; after that the message is moved to the
+// dead-letter topic of its source topic.
+type RetryConfig struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+func DefaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		MaxAttempts:    5,
+		InitialBackoff: 200 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
+	}
+}
+
+func (c RetryConfig) backoff(attempt int) time.Duration {
+	d := c.InitialBackoff
+	for i := 1; i < attempt && d < c.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > c.MaxBackoff {
+		d = c.MaxBackoff
+	}
+	return d
+}
+
+type permanentError struct {
+	err        error
+	quarantine bool
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks a handler error as not worth retrying, e.g. a message that
+// cannot be decoded. Such messages go to the dead-letter topic right away.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// Quarantine marks a handler error caused by an invalid message, e.g. one that
+// does not match its schema. Like a permanent error it is not retried, but the
+// message goes to the quarantine topic instead of the dead-letter topic, which
+// keeps producer bugs apart from failures of the consumer.
+func Quarantine(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err, quarantine: true}
+}
+
+func IsQuarantined(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p) && p.quarantine
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
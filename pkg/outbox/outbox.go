@@ -0,0 +1,112 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"recommendation-system/pkg/db"
+	"recommendation-system/pkg/events"
+)
+
+// Store writes events to the outbox table instead of publishing them directly.
+// Called inside db.WithinTx, the event is stored atomically with the domain
+// change; the Relay publishes it to Kafka afterwards.
+type Store struct {
+	db       *db.DB
+	producer string
+}
+
+func NewStore(database *db.DB, producer string) *Store {
+	return &Store{db: database, producer: producer}
+}
+
+// Enqueue stores an event for topic. Events sharing an aggregate key are
+// published in the order they were enqueued, with the key as the message key.
+func (s *Store) Enqueue(ctx context.Context, topic, aggregateKey, eventType string, payload interface{}) error {
+	value, err := events.Marshal(s.producer, eventType, payload)
+	if err != nil {
+		return err
+	}
+
+	query := `
+        INSERT INTO outbox (producer, topic, aggregate_key, payload, created_at)
+        VALUES ($1, $2, $3, $4, NOW())
+    `
+	if _, err := s.db.Conn(ctx).Exec(ctx, query, s.producer, topic, aggregateKey, value); err != nil {
+		return fmt.Errorf("failed to enqueue %s event: %w", eventType, err)
+	}
+	return nil
+}
+
+type message struct {
+	id           int64
+	topic        string
+	aggregateKey string
+	payload      []byte
+}
+
+func (s *Store) pending(ctx context.Context, limit int) ([]*message, error) {
+	query := `
+        SELECT id, topic, aggregate_key, payload
+        FROM outbox
+        WHERE producer = $1 AND published_at IS NULL
+        ORDER BY id
+        LIMIT $2
+    `
+	rows, err := s.db.Conn(ctx).Query(ctx, query, s.producer, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending outbox messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []*message
+	for rows.Next() {
+		var m message
+		if err := rows.Scan(&m.id, &m.topic, &m.aggregateKey, &m.payload); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox message: %w", err)
+		}
+		messages = append(messages, &m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return messages, nil
+}
+
+func (s *Store) markPublished(ctx context.Context, ids []int64) error {
+	query := `
+        UPDATE outbox
+        SET published_at = NOW(), attempts = attempts + 1, last_error = NULL
+        WHERE id = ANY($1)
+    `
+	if _, err := s.db.Conn(ctx).Exec(ctx, query, ids); err != nil {
+		return fmt.Errorf("failed to mark outbox messages as published: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) markFailed(ctx context.Context, ids []int64, cause error) error {
+	query := `
+        UPDATE outbox
+        SET attempts = attempts + 1, last_error = $2
+        WHERE id = ANY($1)
+    `
+	if _, err := s.db.Conn(ctx).Exec(ctx, query, ids, cause.Error()); err != nil {
+		return fmt.Errorf("failed to record outbox publish failure: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) DeletePublishedBefore(ctx context.Context, before time.Time) (int64, error) {
+	query := `
+        DELETE FROM outbox
+        WHERE producer = $1 AND published_at < $2
+    `
+	tag, err := s.db.Conn(ctx).Exec(ctx, query, s.producer, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete published outbox messages: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,167 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"recommendation-system/pkg/db"
+	"recommendation-system/pkg/events"
+	"recommendation-system/pkg/kafka"
+	log "recommendation-system/pkg/logger"
+
+	kafkaGo "github.com/segmentio/kafka-go"
+)
+
+type RelayConfig struct {
+	PollInterval time.Duration
+	BatchSize    int
+	MaxBackoff   time.Duration
+	// Retention is how long published rows are kept before they are deleted.
+	Retention time.Duration
+	// Mode is the CloudEvents layout of the published messages. Rows always
+	// hold structured events and are converted when published in binary mode.
+	Mode events.Mode
+}
+
+// Relay publishes pending outbox rows of one producer to Kafka. Rows are sent
+// strictly in id order and a failed batch is retried before anything newer,
+// so events of an aggregate never overtake each other. An advisory lock keeps
+// several instances of a service from relaying at the same time.
+type Relay struct {
+	db     *db.DB
+	store  *Store
+	kafka  kafka.Publisher
+	cfg    RelayConfig
+	logger *log.Logger
+}
+
+var errNotLeader = errors.New("outbox relay lock held by another instance")
+
+func NewRelay(database *db.DB, store *Store, kafkaClient kafka.Publisher, cfg RelayConfig, logger *log.Logger) *Relay {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 500 * time.Millisecond
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.MaxBackoff < cfg.PollInterval {
+		cfg.MaxBackoff = 30 * time.Second
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = 24 * time.Hour
+	}
+	if cfg.Mode == "" {
+		cfg.Mode = events.ModeStructured
+	}
+	return &Relay{db: database, store: store, kafka: kafkaClient, cfg: cfg, logger: logger}
+}
+
+// Run relays until ctx is done.
+func (r *Relay) Run(ctx context.Context) {
+	r.logger.Printf("Outbox relay started for producer %s", r.store.producer)
+
+	delay := r.cfg.PollInterval
+	lastCleanup := time.Time{}
+	for {
+		published, err := r.relayBatch(ctx)
+		switch {
+		case errors.Is(err, errNotLeader):
+			delay = r.cfg.PollInterval
+		case err != nil:
+			if ctx.Err() == nil {
+				r.logger.Printf("Outbox relay failed: %v", err)
+			}
+			delay *= 2
+			if delay > r.cfg.MaxBackoff {
+				delay = r.cfg.MaxBackoff
+			}
+		case published == r.cfg.BatchSize:
+			delay = 0
+		default:
+			delay = r.cfg.PollInterval
+		}
+
+		if time.Since(lastCleanup) > time.Hour {
+			if n, err := r.store.DeletePublishedBefore(ctx, time.Now().Add(-r.cfg.Retention)); err != nil {
+				r.logger.Printf("Failed to clean up outbox: %v", err)
+			} else if n > 0 {
+				r.logger.Printf("Deleted %d published outbox messages", n)
+			}
+			lastCleanup = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			r.logger.Printf("Outbox relay stopped for producer %s", r.store.producer)
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (r *Relay) relayBatch(ctx context.Context) (int, error) {
+	published := 0
+	var publishErr error
+	err := r.db.WithinTx(ctx, func(ctx context.Context) error {
+		var locked bool
+		if err := r.db.Conn(ctx).QueryRow(ctx, `SELECT pg_try_advisory_xact_lock(hashtext('outbox:' || $1))`, r.store.producer).Scan(&locked); err != nil {
+			return err
+		}
+		if !locked {
+			return errNotLeader
+		}
+
+		pending, err := r.store.pending(ctx, r.cfg.BatchSize)
+		if err != nil || len(pending) == 0 {
+			return err
+		}
+
+		ids := make([]int64, len(pending))
+		for i, m := range pending {
+			ids[i] = m.id
+		}
+
+		// The failure is recorded and committed; the batch is retried as a
+		// whole on the next round.
+		if publishErr = r.publish(ctx, pending); publishErr != nil {
+			return r.store.markFailed(ctx, ids, publishErr)
+		}
+
+		if err := r.store.markPublished(ctx, ids); err != nil {
+			return err
+		}
+		published = len(pending)
+		return nil
+	})
+	if err == nil && publishErr != nil {
+		err = fmt.Errorf("failed to publish outbox messages: %w", publishErr)
+	}
+	return published, err
+}
+
+// publish sends the rows in one write, so they keep their order.
+func (r *Relay) publish(ctx context.Context, pending []*message) error {
+	msgs := make([]kafkaGo.Message, len(pending))
+	for i, m := range pending {
+		msgs[i] = r.message(m)
+	}
+	return r.kafka.PublishMessages(ctx, msgs...)
+}
+
+// message lays a row out in the configured mode. Rows written before the
+// CloudEvents format hold the previous envelope, which Decode still reads; a
+// row that cannot be decoded at all is published unchanged rather than
+// blocking the outbox.
+func (r *Relay) message(m *message) kafkaGo.Message {
+	env, err := events.Decode(m.payload)
+	if err == nil {
+		var msg kafkaGo.Message
+		if msg, err = events.NewMessage(m.topic, []byte(m.aggregateKey), env, r.cfg.Mode); err == nil {
+			return msg
+		}
+	}
+	r.logger.Printf("Failed to convert outbox message %d, publishing it unchanged: %v", m.id, err)
+	return kafkaGo.Message{Topic: m.topic, Key: []byte(m.aggregateKey), Value: m.payload}
+}
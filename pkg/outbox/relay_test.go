@@ -0,0 +1,102 @@
+package outbox
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"recommendation-system/pkg/events"
+	"recommendation-system/pkg/kafka"
+	log "recommendation-system/pkg/logger"
+
+	kafkaGo "github.com/segmentio/kafka-go"
+)
+
+func TestRelayPublish(t *testing.T) {
+	for _, mode := range []events.Mode{events.ModeStructured, events.ModeBinary} {
+		t.Run(string(mode), func(t *testing.T) {
+			testRelayPublish(t, mode)
+		})
+	}
+}
+
+func testRelayPublish(t *testing.T, mode events.Mode) {
+	logger, err := log.NewLogger(filepath.Join(t.TempDir(), "test.log"), "test", "recommendation-system", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	broker := kafka.NewMemoryBroker(1)
+	defer broker.Close()
+	relay := NewRelay(nil, nil, broker, RelayConfig{Mode: mode}, logger)
+
+	var rows []*message
+	for i, productID := range []int64{10, 11, 12} {
+		payload, err := events.Marshal("user-service", events.UserLiked, events.UserLikedEvent{
+			Interaction: events.Interaction{UserID: 1, ProductID: productID},
+			LikedAt:     time.Now().UTC(),
+		})
+		if err != nil {
+			t.Fatalf("failed to marshal event: %v", err)
+		}
+		rows = append(rows, &message{id: int64(i + 1), topic: "user_updates", aggregateKey: "1", payload: payload})
+	}
+	// A row that cannot be decoded is published unchanged instead of blocking
+	// the rows after it.
+	rows = append(rows, &message{id: 4, topic: "user_updates", aggregateKey: "1", payload: []byte("not an event")})
+
+	if err := relay.publish(context.Background(), rows); err != nil {
+		t.Fatalf("failed to publish rows: %v", err)
+	}
+
+	msgs := readTopic(t, broker, "user_updates", len(rows))
+	for i, m := range msgs[:3] {
+		if string(m.Key) != "1" {
+			t.Errorf("message %d has key %q, want the aggregate key", i, m.Key)
+		}
+		binary := kafka.HeaderValue(m, "ce_specversion") != ""
+		if binary != (mode == events.ModeBinary) {
+			t.Errorf("message %d is not laid out in %s mode", i, mode)
+		}
+
+		env, err := events.DecodeMessage(m)
+		if err != nil {
+			t.Fatalf("failed to decode message %d: %v", i, err)
+		}
+		var e events.UserLikedEvent
+		if err := env.DecodeData(&e); err != nil {
+			t.Fatalf("failed to decode data of message %d: %v", i, err)
+		}
+		if want := int64(10 + i); e.ProductID != want {
+			t.Errorf("message %d likes product %d, want %d", i, e.ProductID, want)
+		}
+	}
+	if string(msgs[3].Value) != "not an event" || len(msgs[3].Headers) != 0 {
+		t.Errorf("invalid row published as %q with headers %v, want it unchanged", msgs[3].Value, msgs[3].Headers)
+	}
+}
+
+func readTopic(t *testing.T, broker *kafka.MemoryBroker, topic string, n int) []kafkaGo.Message {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan kafkaGo.Message, n)
+	go broker.SubscribeToTopicsFallback(ctx, []string{topic}, "test_reader", func(m kafkaGo.Message) error {
+		received <- m
+		return nil
+	})
+
+	msgs := make([]kafkaGo.Message, 0, n)
+	for len(msgs) < n {
+		select {
+		case m := <-received:
+			msgs = append(msgs, m)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("read %d of %d messages from %s", len(msgs), n, topic)
+		}
+	}
+	return msgs
+}
@@ -3,6 +3,7 @@ package redis
 import (
 	"context"
 	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
 	"time"
 )
 
@@ -27,6 +28,20 @@ func (r *RedisClient) Get(ctx context.Context, key string) (string, error) {
 	return val, err
 }
 
+func (r *RedisClient) MGet(ctx context.Context, keys ...string) ([]string, error) {
+	vals, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, len(vals))
+	for i, v := range vals {
+		if s, ok := v.(string); ok {
+			result[i] = s
+		}
+	}
+	return result, nil
+}
+
 func (r *RedisClient) Set(ctx context.Context, key string, value string, expiration time.Duration) error {
 	return r.client.Set(ctx, key, value, expiration).Err()
 }
@@ -34,3 +49,192 @@ func (r *RedisClient) Set(ctx context.Context, key string, value string, expirat
 func (r *RedisClient) Delete(ctx context.Context, key string) error {
 	return r.client.Del(ctx, key).Err()
 }
+
+// ZIncr is one ZINCRBY of ZIncrBy. A non-zero ExpireAt is set on the key
+// afterwards.
+type ZIncr struct {
+	Key       string
+	Member    string
+	Increment float64
+	ExpireAt  time.Time
+}
+
+type Z struct {
+	Member string
+	Score  float64
+}
+
+// ZIncrBy applies the increments in a single pipeline.
+func (r *RedisClient) ZIncrBy(ctx context.Context, incrs []ZIncr) error {
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, incr := range incrs {
+			pipe.ZIncrBy(ctx, incr.Key, incr.Increment, incr.Member)
+			if !incr.ExpireAt.IsZero() {
+				pipe.ExpireAt(ctx, incr.Key, incr.ExpireAt)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// PFAdd is one PFADD of PFAddMany. A non-zero ExpireAt is set on the key
+// afterwards.
+type PFAdd struct {
+	Key      string
+	Members  []string
+	ExpireAt time.Time
+}
+
+// PFAddMany adds the members to the HyperLogLogs in a single pipeline.
+func (r *RedisClient) PFAddMany(ctx context.Context, adds []PFAdd) error {
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, add := range adds {
+			members := make([]interface{}, len(add.Members))
+			for i, m := range add.Members {
+				members[i] = m
+			}
+			pipe.PFAdd(ctx, add.Key, members...)
+			if !add.ExpireAt.IsZero() {
+				pipe.ExpireAt(ctx, add.Key, add.ExpireAt)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// PFCountMany estimates, in a single pipeline, the cardinality of the union of
+// each group of HyperLogLogs.
+func (r *RedisClient) PFCountMany(ctx context.Context, groups [][]string) ([]int64, error) {
+	cmds := make([]*redis.IntCmd, len(groups))
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, keys := range groups {
+			cmds[i] = pipe.PFCount(ctx, keys...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	counts := make([]int64, len(groups))
+	for i, cmd := range cmds {
+		counts[i] = cmd.Val()
+	}
+	return counts, nil
+}
+
+// ZUnionRevRange sums the sorted sets and returns the members with the highest
+// scores first, up to limit of them or all when limit is not positive.
+func (r *RedisClient) ZUnionRevRange(ctx context.Context, keys []string, limit int) ([]Z, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	stop := int64(limit) - 1
+	if limit <= 0 {
+		stop = -1
+	}
+
+	key := keys[0]
+	var rangeCmd *redis.ZSliceCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if len(keys) > 1 {
+			key = "tmp:zunion:" + uuid.NewString()
+			pipe.ZUnionStore(ctx, key, &redis.ZStore{Keys: keys, Aggregate: "SUM"})
+			rangeCmd = pipe.ZRevRangeWithScores(ctx, key, 0, stop)
+			pipe.Del(ctx, key)
+			return nil
+		}
+		rangeCmd = pipe.ZRevRangeWithScores(ctx, key, 0, stop)
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	zs := rangeCmd.Val()
+	result := make([]Z, len(zs))
+	for i, z := range zs {
+		member, _ := z.Member.(string)
+		result[i] = Z{Member: member, Score: z.Score}
+	}
+	return result, nil
+}
+
+// Exists reports whether the key is set.
+func (r *RedisClient) Exists(ctx context.Context, key string) (bool, error) {
+	n, err := r.client.Exists(ctx, key).Result()
+	return n > 0, err
+}
+
+// ZReplace replaces the sorted set at key with the members, expiring after
+// ttl, in a single transaction.
+func (r *RedisClient) ZReplace(ctx context.Context, key string, members []Z, ttl time.Duration) error {
+	const chunk = 1000
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		for start := 0; start < len(members); start += chunk {
+			end := start + chunk
+			if end > len(members) {
+				end = len(members)
+			}
+			zs := make([]*redis.Z, 0, end-start)
+			for _, m := range members[start:end] {
+				zs = append(zs, &redis.Z{Member: m.Member, Score: m.Score})
+			}
+			pipe.ZAdd(ctx, key, zs...)
+		}
+		if len(members) > 0 {
+			pipe.PExpire(ctx, key, ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+// ZScores returns the scores of the members in the sorted set at key, zero
+// for the members that are not in it.
+func (r *RedisClient) ZScores(ctx context.Context, key string, members []string) ([]float64, error) {
+	cmds := make([]*redis.FloatCmd, len(members))
+	_, err := r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, m := range members {
+			cmds[i] = pipe.ZScore(ctx, key, m)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	scores := make([]float64, len(members))
+	for i, cmd := range cmds {
+		scores[i] = cmd.Val()
+	}
+	return scores, nil
+}
+
+// DeleteByPattern removes every key matching the glob pattern.
+func (r *RedisClient) DeleteByPattern(ctx context.Context, pattern string) (int, error) {
+	deleted := 0
+	iter := r.client.Scan(ctx, 0, pattern, 500).Iterator()
+	var batch []string
+	for iter.Next(ctx) {
+		batch = append(batch, iter.Val())
+		if len(batch) == 500 {
+			if err := r.client.Del(ctx, batch...).Err(); err != nil {
+				return deleted, err
+			}
+			deleted += len(batch)
+			batch = batch[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return deleted, err
+	}
+	if len(batch) > 0 {
+		if err := r.client.Del(ctx, batch...).Err(); err != nil {
+			return deleted, err
+		}
+		deleted += len(batch)
+	}
+	return deleted, nil
+}
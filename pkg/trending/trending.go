@@ -0,0 +1,119 @@
+package trending
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"recommendation-system/pkg/db"
+)
+
+// Config describes the sliding windows used to detect trending products:
+// activity in the last Window is compared with the average rate of the rest
+// of the Baseline period. A purchase counts as PurchaseWeight likes, and
+// products with fewer than MinEvents interactions in the window are ignored.
+type Config struct {
+	Window         time.Duration
+	Baseline       time.Duration
+	PurchaseWeight float64
+	MinEvents      int
+}
+
+// WithDefaults replaces windows that cannot be compared with the defaults.
+func (c Config) WithDefaults() Config {
+	if c.Window <= 0 {
+		c.Window = time.Hour
+	}
+	if c.Baseline <= c.Window {
+		c.Baseline = 24 * c.Window
+	}
+	return c
+}
+
+// Query asks for the limit products trending at now, restricted to categories
+// when any are given.
+type Query struct {
+	Categories         []string
+	WindowStart        time.Time
+	BaselineStart      time.Time
+	WindowsPerBaseline float64
+	PurchaseWeight     float64
+	MinEvents          int
+	Limit              int
+}
+
+func (c Config) Query(now time.Time, categories []string, limit int) Query {
+	now = now.UTC()
+	if categories == nil {
+		categories = []string{}
+	}
+	return Query{
+		Categories:         categories,
+		WindowStart:        now.Add(-c.Window),
+		BaselineStart:      now.Add(-c.Baseline),
+		WindowsPerBaseline: float64(c.Baseline-c.Window) / float64(c.Window),
+		PurchaseWeight:     c.PurchaseWeight,
+		MinEvents:          c.MinEvents,
+		Limit:              limit,
+	}
+}
+
+type Product struct {
+	ProductID         int64
+	Category          string
+	WindowLikes       int
+	WindowPurchases   int
+	BaselineLikes     int
+	BaselinePurchases int
+	Velocity          float64
+}
+
+// Products reads the activity buckets kept by the analytics service and
+// orders the products by velocity: the weighted activity of the window
+// divided by the average activity of a window during the rest of the
+// baseline, both smoothed by one.
+func Products(ctx context.Context, conn db.Querier, q Query) ([]*Product, error) {
+	query := `
+        WITH activity AS (
+            SELECT a.product_id, p.category,
+                COALESCE(SUM(a.likes) FILTER (WHERE a.bucket_start >= $1), 0) AS window_likes,
+                COALESCE(SUM(a.purchases) FILTER (WHERE a.bucket_start >= $1), 0) AS window_purchases,
+                SUM(a.likes) AS baseline_likes,
+                SUM(a.purchases) AS baseline_purchases
+            FROM product_activity a
+            JOIN products p ON p.id = a.product_id
+            WHERE a.bucket_start >= $2 AND (cardinality($3::text[]) = 0 OR p.category = ANY($3))
+            GROUP BY a.product_id, p.category
+        )
+        SELECT product_id, category, window_likes, window_purchases, baseline_likes, baseline_purchases,
+            (window_likes + $4::float8 * window_purchases + 1) /
+            ((baseline_likes + $4::float8 * baseline_purchases - window_likes - $4::float8 * window_purchases) / $5::float8 + 1) AS velocity
+        FROM activity
+        WHERE window_likes + window_purchases >= $6
+        ORDER BY velocity DESC, window_likes + window_purchases DESC
+        LIMIT $7
+    `
+	rows, err := conn.Query(ctx, query,
+		q.WindowStart, q.BaselineStart, q.Categories, q.PurchaseWeight, q.WindowsPerBaseline, q.MinEvents, q.Limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trending products: %w", err)
+	}
+	defer rows.Close()
+
+	products := []*Product{}
+	for rows.Next() {
+		var p Product
+		if err := rows.Scan(
+			&p.ProductID, &p.Category, &p.WindowLikes, &p.WindowPurchases,
+			&p.BaselineLikes, &p.BaselinePurchases, &p.Velocity,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan trending product: %w", err)
+		}
+		products = append(products, &p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return products, nil
+}